@@ -0,0 +1,466 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"math"
+	"time"
+)
+
+// Adaptive sessions are built one question at a time. After every answer the learner's
+// ability is re-estimated (Rasch model, expected a posteriori with a standard normal prior)
+// and the unused question whose difficulty is closest to it is served next. The session
+// stops once the estimate's standard error drops below the target or the length cap is hit.
+const (
+	defaultAdaptiveMaxQuestions = 30
+	defaultAdaptiveTargetSE     = 0.45
+	adaptiveMinQuestions        = 5
+	adaptiveMaxQuestionsLimit   = 100
+	adaptiveGridStep            = 0.05
+	adaptiveGridLimit           = 4.0
+
+	// Questions that have not been calibrated yet fall back to their authored 1-10
+	// difficulty, mapped back onto logits with the inverse of calibratedScale.
+	questionLogitSQL = `COALESCE(q.calibrated_logit, (COALESCE(q.difficulty, 5.5) - 5.5) / 1.5)`
+)
+
+// adaptivePool describes where an adaptive session draws its questions from when it is not
+// tied to a question set. Empty fields don't filter.
+type adaptivePool struct {
+	Subject  string   `json:"subject,omitempty"`
+	Exam     string   `json:"exam,omitempty"`
+	Language string   `json:"language,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+func (p adaptivePool) empty() bool {
+	return p.Subject == "" && p.Exam == "" && p.Language == "" && len(p.Tags) == 0
+}
+
+type adaptiveResponse struct {
+	Logit   float64
+	Correct bool
+}
+
+type adaptiveCandidate struct {
+	QuestionID   int
+	Logit        float64
+	Mark         float64
+	NOptions     int
+	QuestionType string
+}
+
+// estimateAbility returns the posterior mean and standard deviation of the learner's ability.
+// With no responses this is the prior: 0 ± 1.
+func estimateAbility(responses []adaptiveResponse) (float64, float64) {
+	var total, sum, sumSq float64
+	for theta := -adaptiveGridLimit; theta <= adaptiveGridLimit+1e-9; theta += adaptiveGridStep {
+		logWeight := -theta * theta / 2
+		for _, r := range responses {
+			p := raschProbability(theta, r.Logit)
+			if r.Correct {
+				logWeight += math.Log(p)
+			} else {
+				logWeight += math.Log(1 - p)
+			}
+		}
+		w := math.Exp(logWeight)
+		total += w
+		sum += w * theta
+		sumSq += w * theta * theta
+	}
+	if total == 0 {
+		return 0, 1
+	}
+	estimate := sum / total
+	return estimate, math.Sqrt(math.Max(0, sumSq/total-estimate*estimate))
+}
+
+// pickNextQuestion returns the candidate whose difficulty is closest to the ability estimate,
+// which is where a Rasch item is most informative. Ties go to the lower question ID.
+func pickNextQuestion(candidates []adaptiveCandidate, ability float64) (adaptiveCandidate, bool) {
+	var best adaptiveCandidate
+	found := false
+	for _, c := range candidates {
+		if !found {
+			best, found = c, true
+			continue
+		}
+		d, bestD := math.Abs(c.Logit-ability), math.Abs(best.Logit-ability)
+		if d < bestD || (d == bestD && c.QuestionID < best.QuestionID) {
+			best = c
+		}
+	}
+	return best, found
+}
+
+// adaptiveStopReason reports why an adaptive session should end after answered questions,
+// or "" when it should go on.
+func adaptiveStopReason(answered, maxQuestions int, se, targetSE float64) string {
+	if answered >= maxQuestions {
+		return "max_questions"
+	}
+	if answered >= adaptiveMinQuestions && se <= targetSE {
+		return "ability_converged"
+	}
+	return ""
+}
+
+type adaptiveSessionInput struct {
+	QuestionSetID  int
+	Pool           adaptivePool
+	Mode           string
+	TimeCapSeconds int
+	MaxQuestions   int
+	TargetSE       float64
+}
+
+// createAdaptiveTestSession starts an adaptive session with a single question picked at the
+// prior ability; the rest are added by NextAdaptiveQuestion.
+func createAdaptiveTestSession(c *fiber.Ctx, user models.User, input adaptiveSessionInput) error {
+	if input.Mode == "q_timed" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Adaptive sessions support untimed and t_timed modes only"})
+	}
+	if input.QuestionSetID <= 0 && input.Pool.empty() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Adaptive sessions need a question_set_id or a pool with subject, exam, language or tags"})
+	}
+	if input.MaxQuestions == 0 {
+		input.MaxQuestions = defaultAdaptiveMaxQuestions
+	}
+	if input.MaxQuestions < 1 || input.MaxQuestions > adaptiveMaxQuestionsLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("max_questions must be between 1 and %d", adaptiveMaxQuestionsLimit)})
+	}
+	if input.TargetSE == 0 {
+		input.TargetSE = defaultAdaptiveTargetSE
+	}
+	if input.TargetSE < 0 || input.TargetSE >= 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "target_se must be between 0 and 1"})
+	}
+
+	var questionSetID *int
+	var poolSpec *string
+	name := "Adaptive test"
+	scheme := defaultMarkingScheme
+	if input.QuestionSetID > 0 {
+		questionSetID = &input.QuestionSetID
+		err := util.DB.QueryRow("SELECT name, marking_scheme, negative_mark_ratio, unanswered_penalty_ratio FROM question_sets WHERE id = $1 AND deleted <> true", input.QuestionSetID).
+			Scan(&name, &scheme.MSelectPolicy, &scheme.NegativeMarkRatio, &scheme.UnansweredPenaltyRatio)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question set not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set name"})
+		}
+	} else {
+		poolJSON, err := json.Marshal(input.Pool)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid pool"})
+		}
+		spec := string(poolJSON)
+		poolSpec = &spec
+		if input.Pool.Subject != "" {
+			name = "Adaptive test: " + input.Pool.Subject
+		}
+	}
+
+	var locked []int
+	if questionSetID == nil {
+		var err error
+		if locked, err = lockedSetIDs(util.DB, &user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access to question sets"})
+		}
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var sessionID string
+	err = tx.QueryRow(`
+		INSERT INTO test_sessions (name, question_set_id, taken_by_id, n_total_questions, current_question_num, mode, time_cap_seconds, remaining_time_seconds,
+		                           marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, current_question_started_at,
+		                           selection_mode, pool_spec, max_questions, target_se, ability_estimate, ability_se, source_type, delivery)
+		VALUES ($1, $2, $3, 0, 0, $4, $5, $5, $6, $7, $8, LOCALTIMESTAMP, 'adaptive', $9, $10, $11, 0, 1,
+		        CASE WHEN $2::int IS NULL THEN 'filters' ELSE 'question_set' END, 'stepwise')
+		RETURNING id
+	`, name, questionSetID, user.ID, input.Mode, input.TimeCapSeconds,
+		scheme.MSelectPolicy, scheme.NegativeMarkRatio, scheme.UnansweredPenaltyRatio,
+		poolSpec, input.MaxQuestions, input.TargetSE).Scan(&sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create test session " + err.Error()})
+	}
+
+	candidates, err := loadAdaptiveCandidates(tx, sessionID, questionSetID, input.Pool, locked)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch questions: " + err.Error()})
+	}
+	first, ok := pickNextQuestion(candidates, 0)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No questions match the pool"})
+	}
+	if err := appendAdaptiveQuestion(tx, sessionID, first, 0); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add question: " + err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":         "success",
+		"test_session":   sessionID,
+		"question_ids":   []int{first.QuestionID},
+		"question_set":   name,
+		"selection_mode": "adaptive",
+		"max_questions":  input.MaxQuestions,
+		"target_se":      input.TargetSE,
+	})
+}
+
+// loadAdaptiveCandidates lists the questions of the session's set or pool that it hasn't used yet.
+// Pool questions found only in the locked sets are left out.
+func loadAdaptiveCandidates(tx *sql.Tx, sessionID string, questionSetID *int, pool adaptivePool, locked []int) ([]adaptiveCandidate, error) {
+	var rows *sql.Rows
+	var err error
+	if questionSetID != nil {
+		rows, err = tx.Query(`
+			SELECT q.id, `+questionLogitSQL+`, COALESCE(qsq.mark, 1), COALESCE(array_length(q.options, 1), 0), q.question_type
+			FROM question_set_questions qsq
+			JOIN questions q ON q.id = qsq.question_id
+			WHERE qsq.question_set_id = $1 AND q.deleted <> true
+			  AND q.id NOT IN (SELECT question_id FROM test_session_question_answers WHERE test_session_id = $2)`,
+			*questionSetID, sessionID)
+	} else {
+		rows, err = tx.Query(`
+			SELECT q.id, `+questionLogitSQL+`, 1, COALESCE(array_length(q.options, 1), 0), q.question_type
+			FROM questions q
+			WHERE q.deleted <> true
+			  AND q.id NOT IN (SELECT question_id FROM test_session_question_answers WHERE test_session_id = $1)
+			  AND ($2 = '' OR q.subject ILIKE $2)
+			  AND ($3 = '' OR q.exam ILIKE $3)
+			  AND ($4 = '' OR q.language ILIKE $4)
+			  AND (cardinality($5::text[]) = 0 OR EXISTS (
+			      SELECT 1 FROM question_questiontags qqt
+			      JOIN questiontags t ON t.id = qqt.questiontags_id
+			      WHERE qqt.question_id = q.id AND t.name = ANY($5)))
+			  AND NOT (`+fmt.Sprintf(onlyInLockedSetsSQL, 6)+`)`,
+			sessionID, pool.Subject, pool.Exam, pool.Language, pq.Array(pool.Tags), pq.Array(locked))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []adaptiveCandidate
+	for rows.Next() {
+		var cand adaptiveCandidate
+		if err := rows.Scan(&cand.QuestionID, &cand.Logit, &cand.Mark, &cand.NOptions, &cand.QuestionType); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, cand)
+	}
+	return candidates, rows.Err()
+}
+
+// appendAdaptiveQuestion adds a question at position index and makes it the current one.
+func appendAdaptiveQuestion(tx *sql.Tx, sessionID string, cand adaptiveCandidate, index int) error {
+	orderList := getRandomOrderList(cand.NOptions, cand.QuestionType)
+	_, err := tx.Exec(`
+		INSERT INTO test_session_question_answers (
+			test_session_id, question_id, order_list,
+			selected_answer_list, questions_total_mark,
+			questions_scored_mark, answered, index_num
+		) VALUES ($1, $2, $3, $4, $5, 0, false, $6)`,
+		sessionID, cand.QuestionID, pq.Array(orderList), pq.Array([]int{}), cand.Mark, index)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE test_sessions
+		SET n_total_questions = $1 + 1,
+		    current_question_num = $1,
+		    current_question_started_at = LOCALTIMESTAMP,
+		    updated_time = CURRENT_TIMESTAMP
+		WHERE id = $2`, index, sessionID)
+	return err
+}
+
+// NextAdaptiveQuestion re-estimates the learner's ability from the answers so far and either
+// adds the next question to the session or finishes it.
+func NextAdaptiveQuestion(c *fiber.Ctx) error {
+	testSessionID := c.Params("test_session_id")
+	user := c.Locals("user").(models.User)
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var takenByID, maxQuestions int
+	var finished, paused bool
+	var selectionMode string
+	var questionSetID *int
+	var poolJSON []byte
+	var targetSE float64
+	var timer sessionTimer
+	var now time.Time
+	err = tx.QueryRow(`
+		SELECT taken_by_id, finished, selection_mode, question_set_id, pool_spec,
+		       COALESCE(max_questions, $2), COALESCE(target_se, $3), paused_at IS NOT NULL, `+sessionTimerColumns+`
+		FROM test_sessions
+		WHERE id = $1
+		FOR UPDATE`, testSessionID, defaultAdaptiveMaxQuestions, defaultAdaptiveTargetSE).
+		Scan(append([]interface{}{&takenByID, &finished, &selectionMode, &questionSetID, &poolJSON,
+			&maxQuestions, &targetSE, &paused}, timer.scanTargets(&now)...)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Test session not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch test session"})
+	}
+	if takenByID != user.ID {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	if finished {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Test session is already finished"})
+	}
+	if selectionMode != "adaptive" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Test session is not adaptive"})
+	}
+	if paused {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Test session is paused"})
+	}
+	if timer.expired(now) {
+		return finishAdaptiveSession(c, tx, testSessionID, "time_up", nil, nil)
+	}
+
+	var lastAnswered bool
+	err = tx.QueryRow(`
+		SELECT answered FROM test_session_question_answers
+		WHERE test_session_id = $1 AND index_num = $2`, testSessionID, timer.NTotalQuestions-1).Scan(&lastAnswered)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch current question"})
+	}
+	if err == nil && !lastAnswered {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Answer the current question before requesting the next one"})
+	}
+
+	// Answers saved before answered_correct was kept fall back to needing full marks.
+	rows, err := tx.Query(`
+		SELECT `+questionLogitSQL+`,
+		       COALESCE(tsqa.answered_correct, tsqa.questions_scored_mark > 0 AND tsqa.questions_scored_mark >= tsqa.questions_total_mark)
+		FROM test_session_question_answers tsqa
+		JOIN questions q ON q.id = tsqa.question_id
+		WHERE tsqa.test_session_id = $1 AND tsqa.answered`, testSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch answers"})
+	}
+	var responses []adaptiveResponse
+	for rows.Next() {
+		var r adaptiveResponse
+		if err := rows.Scan(&r.Logit, &r.Correct); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read answers"})
+		}
+		responses = append(responses, r)
+	}
+	rows.Close()
+
+	ability, se := estimateAbility(responses)
+	if _, err := tx.Exec(`UPDATE test_sessions SET ability_estimate = $1, ability_se = $2 WHERE id = $3`,
+		ability, se, testSessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to store ability estimate"})
+	}
+	if reason := adaptiveStopReason(timer.NTotalQuestions, maxQuestions, se, targetSE); reason != "" {
+		return finishAdaptiveSession(c, tx, testSessionID, reason, &ability, &se)
+	}
+
+	var pool adaptivePool
+	if len(poolJSON) > 0 {
+		if err := json.Unmarshal(poolJSON, &pool); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Invalid pool"})
+		}
+	}
+	var locked []int
+	if questionSetID == nil {
+		if locked, err = lockedSetIDs(util.DB, &user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access to question sets"})
+		}
+	}
+	candidates, err := loadAdaptiveCandidates(tx, testSessionID, questionSetID, pool, locked)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch questions: " + err.Error()})
+	}
+	next, ok := pickNextQuestion(candidates, ability)
+	if !ok {
+		return finishAdaptiveSession(c, tx, testSessionID, "pool_exhausted", &ability, &se)
+	}
+	if err := appendAdaptiveQuestion(tx, testSessionID, next, timer.NTotalQuestions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add question: " + err.Error()})
+	}
+
+	var question string
+	var options []string
+	var orderList []int64
+	err = tx.QueryRow(`
+		SELECT q.question, q.options, tsqa.order_list
+		FROM test_session_question_answers tsqa
+		JOIN questions q ON q.id = tsqa.question_id
+		WHERE tsqa.test_session_id = $1 AND tsqa.question_id = $2`, testSessionID, next.QuestionID).
+		Scan(&question, pq.Array(&options), pq.Array(&orderList))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	reorderedOptions := make([]string, 0, len(orderList))
+	for _, orderInd := range orderList {
+		if int(orderInd) < len(options) {
+			reorderedOptions = append(reorderedOptions, options[orderInd])
+		}
+	}
+	return c.JSON(fiber.Map{
+		"status":           "success",
+		"finished":         false,
+		"ability_estimate": ability,
+		"ability_se":       se,
+		"question": fiber.Map{
+			"id":                   next.QuestionID,
+			"question":             question,
+			"question_type":        next.QuestionType,
+			"options":              reorderedOptions,
+			"index_num":            timer.NTotalQuestions,
+			"questions_total_mark": next.Mark,
+		},
+	})
+}
+
+func finishAdaptiveSession(c *fiber.Ctx, tx *sql.Tx, testSessionID, reason string, ability, se *float64) error {
+	result, err := finalizeTestSession(tx, testSessionID, reason)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish test session"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+	return c.JSON(fiber.Map{
+		"status":           "success",
+		"finished":         true,
+		"finish_reason":    reason,
+		"ability_estimate": ability,
+		"ability_se":       se,
+		"total_marks":      result.TotalMarks,
+		"scored_marks":     result.ScoredMarks,
+		"questions":        result.TotalAnswered + result.Unanswered,
+	})
+}
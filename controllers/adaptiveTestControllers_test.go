@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"math"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEstimateAbilityFollowsResponses(t *testing.T) {
+	if theta, se := estimateAbility(nil); theta > 1e-6 || theta < -1e-6 || se < 0.99 || se > 1.01 {
+		t.Fatalf("expected the N(0,1) prior, got %v ± %v", theta, se)
+	}
+
+	var strong, weak []adaptiveResponse
+	for _, logit := range []float64{-1, 0, 0.5, 1, 1.5} {
+		strong = append(strong, adaptiveResponse{Logit: logit, Correct: true})
+		weak = append(weak, adaptiveResponse{Logit: logit, Correct: false})
+	}
+	strongTheta, strongSE := estimateAbility(strong)
+	weakTheta, _ := estimateAbility(weak)
+	if !(strongTheta > 0 && weakTheta < 0) {
+		t.Fatalf("unexpected estimates: strong %v, weak %v", strongTheta, weakTheta)
+	}
+	if strongSE >= 1 {
+		t.Fatalf("answers should shrink the standard error, got %v", strongSE)
+	}
+}
+
+func TestPickNextQuestionClosestDifficulty(t *testing.T) {
+	candidates := []adaptiveCandidate{
+		{QuestionID: 3, Logit: 1.0},
+		{QuestionID: 2, Logit: -0.5},
+		{QuestionID: 1, Logit: 0.5},
+		{QuestionID: 4, Logit: 2.0},
+	}
+	if next, _ := pickNextQuestion(candidates, 0.9); next.QuestionID != 3 {
+		t.Fatalf("expected question 3, got %d", next.QuestionID)
+	}
+	// 2 and 1 are equally far from 0; the lower ID wins.
+	if next, _ := pickNextQuestion(candidates, 0); next.QuestionID != 1 {
+		t.Fatalf("expected question 1, got %d", next.QuestionID)
+	}
+	if _, ok := pickNextQuestion(nil, 0); ok {
+		t.Fatal("an empty pool has no next question")
+	}
+}
+
+func TestAdaptiveStopReason(t *testing.T) {
+	cases := []struct {
+		answered, max int
+		se            float64
+		want          string
+	}{
+		{3, 30, 0.2, ""},
+		{5, 30, 0.2, "ability_converged"},
+		{10, 30, 0.6, ""},
+		{30, 30, 0.6, "max_questions"},
+	}
+	for _, tc := range cases {
+		if got := adaptiveStopReason(tc.answered, tc.max, tc.se, 0.45); got != tc.want {
+			t.Errorf("adaptiveStopReason(%d, %d, %v) = %q, want %q", tc.answered, tc.max, tc.se, got, tc.want)
+		}
+	}
+}
+
+// TestAdaptiveSessionFlow drives an adaptive session through create, answer and next against the
+// Postgres database in TEST_DATABASE_URL. It creates the schema there, so use a scratch database.
+func TestAdaptiveSessionFlow(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	saved := util.DB
+	util.DB = db
+	defer func() { util.DB = saved }()
+	if err := util.CreateTableIfNotExists(); err != nil {
+		t.Fatal(err)
+	}
+
+	stamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	user := models.User{Role: "user", Timezone: "UTC"}
+	if err := db.QueryRow(`INSERT INTO users (name, email) VALUES ('Adaptive', $1) RETURNING id`,
+		"adaptive-"+stamp+"@example.com").Scan(&user.ID); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	subject := "adaptive-flow-" + stamp
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec(`
+			INSERT INTO questions (question, subject, language, question_type, options, correct_options, created_by_id)
+			VALUES ($1, $2, 'english', 'm-choice', '{wrong,right,also wrong}', '{1}', $3)`,
+			"Question "+strconv.Itoa(i), subject, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		return c.Next()
+	})
+	app.Post("/test_session", CreateTestSession)
+	app.Put("/test_session/next/:test_session_id", NextAdaptiveQuestion)
+	app.Get("/test_session/:test_session_id/question", GetCurrentSessionQuestion)
+	app.Put("/test_session/:test_session_id/question/answer", AnswerSessionQuestion)
+
+	call := func(method, path string, body interface{}) map[string]interface{} {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s: %d %v", method, path, resp.StatusCode, out)
+		}
+		return out
+	}
+
+	created := call("POST", "/test_session", map[string]interface{}{
+		"selection_mode": "adaptive",
+		"pool":           map[string]string{"subject": subject},
+		"max_questions":  3,
+	})
+	sessionID, _ := created["test_session"].(string)
+	// answer picks the right option of the current question, or one of the wrong ones.
+	answer := func(pickRight bool) map[string]interface{} {
+		t.Helper()
+		current := call("GET", "/test_session/"+sessionID+"/question", nil)["question"].(map[string]interface{})
+		pick := -1
+		for i, option := range current["options"].([]interface{}) {
+			if (option == "right") == pickRight {
+				pick = i
+			}
+		}
+		call("PUT", "/test_session/"+sessionID+"/question/answer", map[string]interface{}{
+			"selected_answer_list": []int{pick},
+			"answered":             true,
+			"events":               []map[string]interface{}{{"question_id": current["id"], "type": "visit", "duration_seconds": 1}},
+		})
+		return current
+	}
+
+	first := answer(true)
+	next := call("PUT", "/test_session/next/"+sessionID, nil)
+	if next["finished"] != false || next["ability_estimate"].(float64) <= 0 {
+		t.Fatalf("a right answer should raise the estimate and serve another question, got %v", next)
+	}
+	if next["question"].(map[string]interface{})["id"] == first["id"] {
+		t.Fatal("the next question repeats the first one")
+	}
+	var correct bool
+	if err := db.QueryRow(`SELECT answered_correct FROM test_session_question_answers WHERE test_session_id = $1 AND index_num = 0`,
+		sessionID).Scan(&correct); err != nil || !correct {
+		t.Fatalf("the first answer should be stored as correct, got %v (%v)", correct, err)
+	}
+
+	afterRight := next["ability_estimate"].(float64)
+	answer(false)
+	next = call("PUT", "/test_session/next/"+sessionID, nil)
+	if next["ability_estimate"].(float64) >= afterRight {
+		t.Fatalf("a wrong answer should lower the estimate from %v, got %v", afterRight, next)
+	}
+
+	answer(true)
+	next = call("PUT", "/test_session/next/"+sessionID, nil)
+	if next["finished"] != true || next["finish_reason"] != "max_questions" {
+		t.Fatalf("the session should stop after max_questions, got %v", next)
+	}
+	var stored float64
+	if err := db.QueryRow(`SELECT ability_estimate FROM test_sessions WHERE id = $1`, sessionID).Scan(&stored); err != nil ||
+		math.Abs(stored-next["ability_estimate"].(float64)) > 1e-9 {
+		t.Fatalf("the final estimate should be stored, got %v (%v)", stored, err)
+	}
+	var visits int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM test_session_events WHERE test_session_id = $1 AND event_type = 'visit'`,
+		sessionID).Scan(&visits); err != nil || visits != 3 {
+		t.Fatalf("each answer's visit should be stored, got %d (%v)", visits, err)
+	}
+}
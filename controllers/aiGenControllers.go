@@ -61,9 +61,10 @@ func GenerateQuizFromPrompt(c *fiber.Ctx) error {
     "exam": "general",
     "language": "english",
     "difficulty": number(1-10),
-    "question_type": "m-choice" or "m-select",
-    "options": [answer options here],
-    "correct_options": [zero based index],
+    "question_type": "m-choice" or "m-select" or "numeric",
+    "options": [answer options here, empty for numeric],
+    "correct_options": [zero based index, empty for numeric],
+    "numeric_answer": only for numeric, {"value": number, "tolerance": number, "tolerance_type": "absolute" or "relative", "sig_figs": number or null, "units": [{"unit": "unit symbol", "factor": conversion factor to the unit of value}], "unit_required": true or false},
     "explanation": "explanation here",
     "tags": ["tag1", "tag2"]
   },`
@@ -510,7 +510,8 @@ func GetUserDetails(c *fiber.Ctx) error {
 
 	// Fetch user details from DB manually
 	var user models.User
-	query := `SELECT id, name, email, role, password_changed_at, verified, linkedin, facebook, instagram, profile_pic, about, deleted, created_at, updated_at ,goal, country, country_code, mobile_number
+	query := `SELECT id, name, email, role, password_changed_at, verified, linkedin, facebook, instagram, profile_pic, about, deleted, created_at, updated_at ,goal, country, country_code, mobile_number,
+			  COALESCE(profile_visibility, 'public'), COALESCE(allow_mentor_view, false), COALESCE(auto_shoutouts, false), timezone
 			  FROM users WHERE id = $1 AND deleted = false`
 
 	row := util.DB.QueryRow(query, userId)
@@ -518,6 +519,7 @@ func GetUserDetails(c *fiber.Ctx) error {
 		&user.ID, &user.Name, &user.Email, &user.Role, &user.PasswordChangedAt,
 		&user.Verified, &user.LinkedIn, &user.Facebook, &user.Instagram,
 		&user.ProfilePic, &user.About, &user.Deleted, &user.CreatedAt, &user.UpdatedAt, &user.Goal, &user.Country, &user.CountryCode, &user.MobileNumber,
+		&user.ProfileVisibility, &user.AllowMentorView, &user.AutoShoutouts, &user.Timezone,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -559,6 +561,11 @@ func EditUserProfile(c *fiber.Ctx) error {
 		Country      *string `json:"country"`
 		CountryCode  *string `json:"country_code"`
 		MobileNumber *string `json:"mobile_number"`
+		// Who can see the profile and its connections, and whether mentors may see activity by default
+		ProfileVisibility *string `json:"profile_visibility"`
+		AllowMentorView   *bool   `json:"allow_mentor_view"`
+		AutoShoutouts     *bool   `json:"auto_shoutouts"`
+		Timezone          *string `json:"timezone"`
 	}
 
 	var payload UpdatePayload
@@ -567,6 +574,20 @@ func EditUserProfile(c *fiber.Ctx) error {
 			"error": "Invalid input: " + err.Error(),
 		})
 	}
+	if payload.ProfileVisibility != nil && *payload.ProfileVisibility != "public" && *payload.ProfileVisibility != "private" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "profile_visibility must be public or private",
+		})
+	}
+	if payload.Timezone != nil {
+		tz, _, err := resolveTimezone(*payload.Timezone)
+		if err != nil || *payload.Timezone == "" || *payload.Timezone == "Local" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "timezone must be an IANA timezone name",
+			})
+		}
+		payload.Timezone = &tz
+	}
 
 	query := `
 		UPDATE users
@@ -581,6 +602,10 @@ func EditUserProfile(c *fiber.Ctx) error {
 			country =  COALESCE($8, profile_pic),
 			country_code =  COALESCE($9, country_code),
 			mobile_number =  COALESCE($10, mobile_number),
+			profile_visibility = COALESCE($12, profile_visibility),
+			allow_mentor_view = COALESCE($13, allow_mentor_view),
+			auto_shoutouts = COALESCE($14, auto_shoutouts),
+			timezone = COALESCE($15, timezone),
 			updated_at = CURRENT_TIMESTAMP
 		WHERE id = $11 AND deleted = false
 		RETURNING id
@@ -600,6 +625,10 @@ func EditUserProfile(c *fiber.Ctx) error {
 		payload.CountryCode,
 		payload.MobileNumber,
 		user.ID,
+		payload.ProfileVisibility,
+		payload.AllowMentorView,
+		payload.AutoShoutouts,
+		payload.Timezone,
 	).Scan(&updatedID)
 
 	if err != nil {
@@ -689,33 +718,42 @@ func SlugifyUsername(name string) string {
 	// Trim leading/trailing spaces and replace all internal spaces with "-"
 	return strings.ReplaceAll(strings.TrimSpace(name), " ", "-")
 }
+
+var timezoneAliases = map[string]string{
+	"Asia/Calcutta":       "Asia/Kolkata",      // Correct alias for historical reasons
+	"Asia/Chongqing":      "Asia/Shanghai",     // Chongqing to Shanghai
+	"Asia/Gaza":           "Asia/Jerusalem",    // Gaza to Jerusalem
+	"Asia/Kashgar":        "Asia/Urumqi",       // Kashgar to Urumqi
+	"Australia/Lord_Howe": "Australia/Sydney",  // Lord Howe to Sydney
+	"Europe/Chisinau":     "Europe/Bucharest",  // Chisinau to Bucharest
+	"Europe/Istanbul":     "Europe/Ankara",     // Istanbul to Ankara
+	"Europe/Minsk":        "Europe/Moscow",     // Minsk to Moscow
+	"Europe/Sofia":        "Europe/Bucharest",  // Sofia to Bucharest
+	"Indian/Antananarivo": "Indian/Reunion",    // Antananarivo to Reunion
+	"Pacific/Apia":        "Pacific/Fiji",      // Apia to Fiji
+	"Pacific/Fiji":        "Pacific/Tarawa",    // Fiji to Tarawa
+	"Pacific/Tarawa":      "Pacific/Fiji",      // Tarawa to Fiji
+	"US/Alaska":           "America/Anchorage", // Alaska to Anchorage
+}
+
+// resolveTimezone maps a client-supplied IANA timezone (aliases included) to the name the
+// database understands and its location.
+func resolveTimezone(tz string) (string, *time.Location, error) {
+	if realTz, ok := timezoneAliases[tz]; ok {
+		tz = realTz
+	}
+	loc, err := time.LoadLocation(tz)
+	return tz, loc, err
+}
+
 func GetUserActivityOverview(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	// Step 0: Get timezone from query param
-
-	var timezoneAliases = map[string]string{
-		"Asia/Calcutta":       "Asia/Kolkata",      // Correct alias for historical reasons
-		"Asia/Chongqing":      "Asia/Shanghai",     // Chongqing to Shanghai
-		"Asia/Gaza":           "Asia/Jerusalem",    // Gaza to Jerusalem
-		"Asia/Kashgar":        "Asia/Urumqi",       // Kashgar to Urumqi
-		"Australia/Lord_Howe": "Australia/Sydney",  // Lord Howe to Sydney
-		"Europe/Chisinau":     "Europe/Bucharest",  // Chisinau to Bucharest
-		"Europe/Istanbul":     "Europe/Ankara",     // Istanbul to Ankara
-		"Europe/Minsk":        "Europe/Moscow",     // Minsk to Moscow
-		"Europe/Sofia":        "Europe/Bucharest",  // Sofia to Bucharest
-		"Indian/Antananarivo": "Indian/Reunion",    // Antananarivo to Reunion
-		"Pacific/Apia":        "Pacific/Fiji",      // Apia to Fiji
-		"Pacific/Fiji":        "Pacific/Tarawa",    // Fiji to Tarawa
-		"Pacific/Tarawa":      "Pacific/Fiji",      // Tarawa to Fiji
-		"US/Alaska":           "America/Anchorage", // Alaska to Anchorage
-	}
-
-	tzQuery := c.Query("tz", "UTC")
-	if realTz, ok := timezoneAliases[tzQuery]; ok {
-		tzQuery = realTz
-	}
-	tzLoc, err := time.LoadLocation(tzQuery)
+	tzQuery, tzLoc, err := resolveTimezone(c.Query("tz", user.Timezone))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid timezone"})
+	}
 	localNow := time.Now().In(tzLoc)
 	localToday := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, tzLoc)
 	sevenDaysAgo := localToday.AddDate(0, 0, -6)
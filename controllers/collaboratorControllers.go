@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Question sets and questions can be shared with co-authors. An invite stays pending until
+// the invitee accepts it; editors can then change the item and viewers can see it, its
+// analytics and its collaborators. Deleting an item, pricing it and managing who it is shared
+// with stay with its creator and admins.
+var collaboratorRoles = map[string]bool{"editor": true, "viewer": true}
+
+// collaborationScope is one kind of shareable item and the table its collaborators live in.
+type collaborationScope struct {
+	Kind        string // question_set or question, as used in notifications
+	Label       string
+	Table       string
+	Column      string
+	ItemTable   string
+	ItemNameSQL string
+}
+
+var (
+	questionSetCollaboration = collaborationScope{
+		Kind:        "question_set",
+		Label:       "question set",
+		Table:       "user_questionsets_editors",
+		Column:      "question_set_id",
+		ItemTable:   "question_sets",
+		ItemNameSQL: "t.name",
+	}
+	questionCollaboration = collaborationScope{
+		Kind:        "question",
+		Label:       "question",
+		Table:       "user_questions_editors",
+		Column:      "question_id",
+		ItemTable:   "questions",
+		ItemNameSQL: "LEFT(t.question, 80)",
+	}
+)
+
+// collaboratorRole is what user may do with an item created by createdByID, given the role
+// of their accepted invite, if any: owner (its creator or an admin), editor, viewer or "".
+func collaboratorRole(createdByID int, user models.User, shared *string) string {
+	if user.ID == createdByID || user.Role == "admin" || user.Role == "owner" {
+		return "owner"
+	}
+	if shared != nil {
+		return *shared
+	}
+	return ""
+}
+
+func canEditRole(role string) bool {
+	return role == "owner" || role == "editor"
+}
+
+// role loads an item and returns the caller's role on it, with sql.ErrNoRows for items that
+// don't exist or were deleted.
+func (s collaborationScope) role(db queryRower, user models.User, id int) (string, error) {
+	var createdByID int
+	var shared *string
+	err := db.QueryRow(fmt.Sprintf(`
+		SELECT t.created_by_id,
+		       (SELECT role FROM %s WHERE %s = t.id AND user_id = $2 AND status = 'accepted')
+		FROM %s t
+		WHERE t.id = $1 AND COALESCE(t.deleted, false) = false`, s.Table, s.Column, s.ItemTable),
+		id, user.ID).Scan(&createdByID, &shared)
+	if err != nil {
+		return "", err
+	}
+	return collaboratorRole(createdByID, user, shared), nil
+}
+
+// itemFromParams parses the :id of an item and the caller's role on it. On failure it
+// returns the status and message to send.
+func (s collaborationScope) itemFromParams(c *fiber.Ctx, user models.User) (int, string, int, string) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return 0, "", fiber.StatusBadRequest, "Invalid " + s.Label + " ID"
+	}
+	role, err := s.role(util.DB, user, id)
+	if err == sql.ErrNoRows {
+		return 0, "", fiber.StatusNotFound, strings.ToUpper(s.Label[:1]) + s.Label[1:] + " not found"
+	}
+	if err != nil {
+		return 0, "", fiber.StatusInternalServerError, "Failed to fetch " + s.Label
+	}
+	return id, role, 0, ""
+}
+
+func (s collaborationScope) invite(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	id, role, status, msg := s.itemFromParams(c, user)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the " + s.Label + "'s creator or an admin can invite collaborators"})
+	}
+	var input struct {
+		UserID int    `json:"user_id"`
+		Email  string `json:"email"`
+		Role   string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.Role == "" {
+		input.Role = "editor"
+	}
+	if !collaboratorRoles[input.Role] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be editor or viewer"})
+	}
+	if input.UserID == 0 && input.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_id or email is required"})
+	}
+
+	var inviteeID, createdByID int
+	var itemName string
+	err := util.DB.QueryRow(fmt.Sprintf(`
+		SELECT u.id, t.created_by_id, %s
+		FROM users u, %s t
+		WHERE (u.id = $1 OR ($1 = 0 AND LOWER(u.email) = LOWER($2))) AND u.deleted = false AND t.id = $3`,
+		s.ItemNameSQL, s.ItemTable), input.UserID, strings.TrimSpace(input.Email), id).Scan(&inviteeID, &createdByID, &itemName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	if inviteeID == createdByID || inviteeID == user.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The " + s.Label + "'s creator can't be invited to it"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (user_id, %s, role, status, invited_by_id, created_at)
+		VALUES ($1, $2, $3, 'pending', $4, $5)`, s.Table, s.Column),
+		inviteeID, id, input.Role, user.ID, time.Now().UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This user is already a collaborator or has a pending invite"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to invite collaborator"})
+	}
+	err = notifyUser(tx, inviteeID, "collaboration_invite",
+		fmt.Sprintf("%s invited you as %s on the %s %q", user.Name, articled(input.Role), s.Label, itemName),
+		fiber.Map{"kind": s.Kind, s.Column: id, "role": input.Role, "invited_by_id": user.ID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to notify the invitee"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"user_id": inviteeID,
+		"role":    input.Role,
+		"state":   "pending",
+	})
+}
+
+func (s collaborationScope) accept(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + s.Label + " ID"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	var role string
+	var invitedByID *int
+	err = tx.QueryRow(fmt.Sprintf(`
+		UPDATE %s SET status = 'accepted', accepted_at = $3
+		WHERE %s = $1 AND user_id = $2 AND status = 'pending'
+		RETURNING role, invited_by_id`, s.Table, s.Column), id, user.ID, time.Now().UTC()).Scan(&role, &invitedByID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No pending invite for this " + s.Label})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to accept invite"})
+	}
+	if invitedByID != nil {
+		err = notifyUser(tx, *invitedByID, "collaboration_accepted",
+			fmt.Sprintf("%s accepted your invite to collaborate on a %s", user.Name, s.Label),
+			fiber.Map{"kind": s.Kind, s.Column: id, "user_id": user.ID, "role": role})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to notify the inviter"})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "role": role})
+}
+
+func (s collaborationScope) updateRole(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	id, role, status, msg := s.itemFromParams(c, user)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the " + s.Label + "'s creator or an admin can change roles"})
+	}
+	collaboratorID, err := strconv.Atoi(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if !collaboratorRoles[input.Role] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be editor or viewer"})
+	}
+
+	res, err := util.DB.Exec(fmt.Sprintf(`UPDATE %s SET role = $1 WHERE %s = $2 AND user_id = $3`, s.Table, s.Column),
+		input.Role, id, collaboratorID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update collaborator"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Collaborator not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "user_id": collaboratorID, "role": input.Role})
+}
+
+// remove revokes a collaborator, or lets a collaborator leave or decline an invite.
+func (s collaborationScope) remove(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + s.Label + " ID"})
+	}
+	collaboratorID, err := strconv.Atoi(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	if collaboratorID != user.ID {
+		role, err := s.role(util.DB, user, id)
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch " + s.Label})
+		}
+		if role != "owner" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the " + s.Label + "'s creator or an admin can remove collaborators"})
+		}
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND user_id = $2`, s.Table, s.Column), id, collaboratorID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove collaborator"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Collaborator not found"})
+	}
+	if collaboratorID != user.ID {
+		err = notifyUser(tx, collaboratorID, "collaboration_revoked",
+			fmt.Sprintf("You no longer have access to collaborate on a %s", s.Label),
+			fiber.Map{"kind": s.Kind, s.Column: id})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to notify the collaborator"})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Collaborator removed"})
+}
+
+func (s collaborationScope) list(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	id, role, status, msg := s.itemFromParams(c, user)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if role == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the " + s.Label + "'s creator and collaborators can see its collaborators"})
+	}
+
+	rows, err := util.DB.Query(fmt.Sprintf(`
+		SELECT e.user_id, u.name, u.profile_pic, e.role, e.status, e.invited_by_id, e.created_at, e.accepted_at
+		FROM %s e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.%s = $1
+		ORDER BY e.status = 'pending', e.created_at, e.user_id`, s.Table, s.Column), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collaborators"})
+	}
+	defer rows.Close()
+
+	collaborators := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			userID                        int
+			name, collaboratorRole, state string
+			profilePic                    *string
+			invitedByID                   *int
+			createdAt                     time.Time
+			acceptedAt                    *time.Time
+		)
+		if err := rows.Scan(&userID, &name, &profilePic, &collaboratorRole, &state, &invitedByID, &createdAt, &acceptedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read collaborator"})
+		}
+		collaborators = append(collaborators, map[string]interface{}{
+			"user_id":       userID,
+			"name":          name,
+			"profile_pic":   profilePic,
+			"role":          collaboratorRole,
+			"status":        state,
+			"invited_by_id": invitedByID,
+			"invited_at":    createdAt,
+			"accepted_at":   acceptedAt,
+		})
+	}
+	return c.JSON(fiber.Map{"status": "success", "your_role": role, "collaborators": collaborators})
+}
+
+// articled puts "an" or "a" in front of a role name.
+func articled(role string) string {
+	if strings.ContainsAny(role[:1], "aeiou") {
+		return "an " + role
+	}
+	return "a " + role
+}
+
+func InviteQuestionSetCollaborator(c *fiber.Ctx) error {
+	return questionSetCollaboration.invite(c)
+}
+func AcceptQuestionSetCollaboration(c *fiber.Ctx) error {
+	return questionSetCollaboration.accept(c)
+}
+func UpdateQuestionSetCollaborator(c *fiber.Ctx) error {
+	return questionSetCollaboration.updateRole(c)
+}
+func RemoveQuestionSetCollaborator(c *fiber.Ctx) error {
+	return questionSetCollaboration.remove(c)
+}
+func GetQuestionSetCollaborators(c *fiber.Ctx) error {
+	return questionSetCollaboration.list(c)
+}
+
+func InviteQuestionCollaborator(c *fiber.Ctx) error {
+	return questionCollaboration.invite(c)
+}
+func AcceptQuestionCollaboration(c *fiber.Ctx) error {
+	return questionCollaboration.accept(c)
+}
+func UpdateQuestionCollaborator(c *fiber.Ctx) error {
+	return questionCollaboration.updateRole(c)
+}
+func RemoveQuestionCollaborator(c *fiber.Ctx) error {
+	return questionCollaboration.remove(c)
+}
+func GetQuestionCollaborators(c *fiber.Ctx) error {
+	return questionCollaboration.list(c)
+}
+
+// GetMyCollaborations lists the question sets and questions shared with the caller,
+// pending invites first.
+func GetMyCollaborations(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	rows, err := util.DB.Query(`
+		SELECT 'question_set', e.question_set_id, t.name, e.role, e.status, e.invited_by_id, e.created_at
+		FROM user_questionsets_editors e
+		JOIN question_sets t ON t.id = e.question_set_id
+		WHERE e.user_id = $1 AND t.deleted <> true
+		UNION ALL
+		SELECT 'question', e.question_id, LEFT(t.question, 80), e.role, e.status, e.invited_by_id, e.created_at
+		FROM user_questions_editors e
+		JOIN questions t ON t.id = e.question_id
+		WHERE e.user_id = $1 AND t.deleted = false
+		ORDER BY 5 DESC, 7 DESC`, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collaborations"})
+	}
+	defer rows.Close()
+
+	collaborations := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			kind, name, role, state string
+			id                      int
+			invitedByID             *int
+			createdAt               time.Time
+		)
+		if err := rows.Scan(&kind, &id, &name, &role, &state, &invitedByID, &createdAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read collaboration"})
+		}
+		collaborations = append(collaborations, map[string]interface{}{
+			"kind":          kind,
+			"id":            id,
+			"name":          name,
+			"role":          role,
+			"status":        state,
+			"invited_by_id": invitedByID,
+			"invited_at":    createdAt,
+		})
+	}
+	return c.JSON(fiber.Map{"status": "success", "collaborations": collaborations})
+}
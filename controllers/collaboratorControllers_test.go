@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"testing"
+)
+
+func TestCollaboratorRole(t *testing.T) {
+	editor, viewer := "editor", "viewer"
+	member := models.User{ID: 2, Role: "user"}
+
+	cases := []struct {
+		name   string
+		user   models.User
+		shared *string
+		want   string
+		edit   bool
+	}{
+		{"creator", models.User{ID: 1, Role: "user"}, nil, "owner", true},
+		{"admin", models.User{ID: 9, Role: "admin"}, nil, "owner", true},
+		{"editor", member, &editor, "editor", true},
+		{"viewer", member, &viewer, "viewer", false},
+		{"stranger", member, nil, "", false},
+	}
+	for _, tc := range cases {
+		role := collaboratorRole(1, tc.user, tc.shared)
+		if role != tc.want || canEditRole(role) != tc.edit {
+			t.Errorf("%s: got %q (edit %v), want %q (edit %v)", tc.name, role, canEditRole(role), tc.want, tc.edit)
+		}
+	}
+}
+
+func TestArticled(t *testing.T) {
+	if got := articled("editor"); got != "an editor" {
+		t.Errorf("got %q", got)
+	}
+	if got := articled("viewer"); got != "a viewer" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+var connectionTypes = map[string]bool{"friend": true, "mentor-mentee": true, "follower": true}
+
+// isUniqueViolation reports whether err is Postgres' unique_violation (23505).
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// connectionConflictMessage explains why a request for an existing connection can't be sent.
+// reverse is true when the existing row was sent by the other user.
+func connectionConflictMessage(status string, reverse bool) string {
+	switch {
+	case status == "accepted":
+		return "You are already connected"
+	case status == "pending" && reverse:
+		return "This user has already sent you a request; accept it instead"
+	case status == "pending":
+		return "A request is already pending"
+	case reverse:
+		return "You have rejected this user's request; remove it before sending your own"
+	default:
+		return "Your earlier request was rejected; remove it before sending another"
+	}
+}
+
+// areConnected reports whether two users share an accepted connection of any of the given types,
+// in either direction.
+func areConnected(userA, userB int, types ...string) (bool, error) {
+	var connected bool
+	err := util.DB.QueryRow(`
+		SELECT EXISTS (
+		    SELECT 1 FROM user_connections
+		    WHERE status = 'accepted' AND connection_type = ANY($3)
+		      AND ((requester_id = $1 AND target_id = $2) OR (requester_id = $2 AND target_id = $1))
+		)`, userA, userB, pq.Array(types)).Scan(&connected)
+	return connected, err
+}
+
+// CreateConnectionRequest asks another user for a friend, follower or mentor-mentee connection.
+// Following a public profile is accepted at once; everything else waits for the target. For
+// mentor-mentee requests role says whether the requester is the mentor or the mentee, and users
+// who don't allow mentor view can't be asked to be mentored.
+func CreateConnectionRequest(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var input struct {
+		TargetID       int    `json:"target_id"`
+		ConnectionType string `json:"connection_type"`
+		Role           string `json:"role"` // mentor or mentee, for mentor-mentee requests
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if !connectionTypes[input.ConnectionType] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "connection_type must be friend, mentor-mentee or follower"})
+	}
+	if input.TargetID == user.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot connect with yourself"})
+	}
+	var mentorID *int
+	if input.ConnectionType == "mentor-mentee" {
+		switch input.Role {
+		case "mentor":
+			mentorID = &user.ID
+		case "mentee":
+			mentorID = &input.TargetID
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be mentor or mentee"})
+		}
+	}
+
+	var visibility string
+	var allowMentorView bool
+	err := util.DB.QueryRow(`
+		SELECT COALESCE(profile_visibility, 'public'), COALESCE(allow_mentor_view, false)
+		FROM users WHERE id = $1 AND deleted = false`, input.TargetID).Scan(&visibility, &allowMentorView)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	if input.Role == "mentor" && !allowMentorView {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This user does not accept mentor requests"})
+	}
+
+	// Friend and mentor-mentee connections are symmetric, so a request the other way counts too.
+	var existingStatus string
+	var existingRequester int
+	err = util.DB.QueryRow(`
+		SELECT status, requester_id FROM user_connections
+		WHERE connection_type = $3
+		  AND ((requester_id = $1 AND target_id = $2) OR (requester_id = $2 AND target_id = $1 AND connection_type <> 'follower'))
+		ORDER BY requester_id = $1 DESC
+		LIMIT 1`, user.ID, input.TargetID, input.ConnectionType).Scan(&existingStatus, &existingRequester)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check existing connections"})
+	}
+	if err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": connectionConflictMessage(existingStatus, existingRequester != user.ID),
+		})
+	}
+
+	status := "pending"
+	if input.ConnectionType == "follower" && visibility == "public" {
+		status = "accepted"
+	}
+	now := time.Now().UTC()
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var connectionID int
+	err = tx.QueryRow(`
+		INSERT INTO user_connections (requester_id, target_id, connection_type, status, mentor_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		RETURNING id`, user.ID, input.TargetID, input.ConnectionType, status, mentorID, now).Scan(&connectionID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": connectionConflictMessage("pending", false)})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create connection " + err.Error()})
+	}
+
+	kind, message := "connection_request", user.Name+" sent you a "+input.ConnectionType+" request"
+	if status == "accepted" {
+		kind, message = "new_follower", user.Name+" started following you"
+	}
+	if err := notifyUser(tx, input.TargetID, kind, message, fiber.Map{"connection_id": connectionID, "user_id": user.ID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to notify user"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":            "success",
+		"connection_id":     connectionID,
+		"connection_status": status,
+	})
+}
+
+func AcceptConnectionRequest(c *fiber.Ctx) error {
+	return respondToConnectionRequest(c, "accepted")
+}
+
+func RejectConnectionRequest(c *fiber.Ctx) error {
+	return respondToConnectionRequest(c, "rejected")
+}
+
+// respondToConnectionRequest lets the target of a pending request accept or reject it. An accepted
+// mentor-mentee connection starts with activity access as the mentee's allow_mentor_view setting says.
+func respondToConnectionRequest(c *fiber.Ctx, status string) error {
+	user := c.Locals("user").(models.User)
+	connectionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid connection ID"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var requesterID, targetID int
+	var connectionType, current string
+	err = tx.QueryRow(`
+		SELECT requester_id, target_id, connection_type, status
+		FROM user_connections WHERE id = $1
+		FOR UPDATE`, connectionID).Scan(&requesterID, &targetID, &connectionType, &current)
+	if err != nil || targetID != user.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Connection request not found"})
+	}
+	if current != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This request has already been " + current})
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_connections uc
+		SET status = $1,
+		    updated_at = $2,
+		    mentee_activity_access = CASE
+		        WHEN $1 = 'accepted' AND uc.connection_type = 'mentor-mentee' THEN COALESCE((
+		            SELECT u.allow_mentor_view FROM users u
+		            WHERE u.id = CASE WHEN uc.mentor_id = uc.requester_id THEN uc.target_id ELSE uc.requester_id END
+		        ), false)
+		        ELSE uc.mentee_activity_access
+		    END
+		WHERE uc.id = $3`, status, time.Now().UTC(), connectionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update connection"})
+	}
+	if status == "accepted" {
+		if err := notifyUser(tx, requesterID, "connection_accepted", user.Name+" accepted your "+connectionType+" request",
+			fiber.Map{"connection_id": connectionID, "user_id": user.ID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to notify user"})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "connection_status": status})
+}
+
+// RemoveConnection cancels a request, removes a rejected one, or ends a connection. Either side may do it.
+func RemoveConnection(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	connectionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid connection ID"})
+	}
+	res, err := util.DB.Exec(`
+		DELETE FROM user_connections
+		WHERE id = $1 AND (requester_id = $2 OR target_id = $2)`, connectionID, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove connection"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Connection not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Connection removed"})
+}
+
+// connectionRoleSQL describes how the other user relates to the one listing: friend, follower
+// (they follow you), following (you follow them), mentor or mentee.
+const connectionRoleSQL = `
+	CASE
+	    WHEN uc.connection_type = 'friend' THEN 'friend'
+	    WHEN uc.connection_type = 'follower' AND uc.target_id = $1 THEN 'follower'
+	    WHEN uc.connection_type = 'follower' THEN 'following'
+	    WHEN uc.mentor_id = $1 THEN 'mentee'
+	    ELSE 'mentor'
+	END`
+
+func scanConnections(rows *sql.Rows) ([]map[string]interface{}, error) {
+	connections := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, otherID                  int
+			connectionType, role, status string
+			otherName                    string
+			profilePic                   *string
+			menteeActivityAccess         bool
+			createdAt, updatedAt         time.Time
+		)
+		if err := rows.Scan(&id, &connectionType, &role, &status, &otherID, &otherName, &profilePic,
+			&menteeActivityAccess, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		connection := map[string]interface{}{
+			"id":              id,
+			"connection_type": connectionType,
+			"role":            role,
+			"status":          status,
+			"user": fiber.Map{
+				"id":          otherID,
+				"name":        otherName,
+				"profile_pic": profilePic,
+			},
+			"created_at": createdAt,
+			"updated_at": updatedAt,
+		}
+		if connectionType == "mentor-mentee" {
+			connection["mentee_activity_access"] = menteeActivityAccess
+		}
+		connections = append(connections, connection)
+	}
+	return connections, rows.Err()
+}
+
+// GetConnections lists accepted connections, optionally of one type or role. With user_id it lists
+// another user's connections, which a private profile only shows to its own connections.
+func GetConnections(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	subjectID := user.ID
+	if uid := c.Query("user_id"); uid != "" {
+		id, err := strconv.Atoi(uid)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user_id"})
+		}
+		subjectID = id
+	}
+	if subjectID != user.ID && user.Role != "admin" && user.Role != "owner" {
+		var visibility string
+		err := util.DB.QueryRow(`SELECT COALESCE(profile_visibility, 'public') FROM users WHERE id = $1 AND deleted = false`,
+			subjectID).Scan(&visibility)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		if visibility == "private" {
+			connected, err := areConnected(user.ID, subjectID, "friend", "mentor-mentee", "follower")
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check connection"})
+			}
+			if !connected {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This profile is private"})
+			}
+		}
+	}
+
+	where := "uc.status = 'accepted' AND (uc.requester_id = $1 OR uc.target_id = $1)"
+	args := []interface{}{subjectID}
+	if t := c.Query("type"); t != "" {
+		if !connectionTypes[t] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "type must be friend, mentor-mentee or follower"})
+		}
+		args = append(args, t)
+		where += fmt.Sprintf(" AND uc.connection_type = $%d", len(args))
+	}
+	if role := c.Query("role"); role != "" {
+		args = append(args, role)
+		where += fmt.Sprintf(" AND "+connectionRoleSQL+" = $%d", len(args))
+	}
+
+	rows, err := util.DB.Query(`
+		SELECT uc.id, uc.connection_type, `+connectionRoleSQL+`, uc.status, u.id, u.name, u.profile_pic,
+		       COALESCE(uc.mentee_activity_access, false), uc.created_at, uc.updated_at
+		FROM user_connections uc
+		JOIN users u ON u.id = CASE WHEN uc.requester_id = $1 THEN uc.target_id ELSE uc.requester_id END
+		WHERE u.deleted = false AND `+where+`
+		ORDER BY uc.updated_at DESC, uc.id DESC`, args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch connections " + err.Error()})
+	}
+	defer rows.Close()
+	connections, err := scanConnections(rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read connections"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "connections": connections})
+}
+
+// GetConnectionRequests lists pending requests sent to the user (direction=incoming, the default)
+// or sent by them (direction=outgoing).
+func GetConnectionRequests(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	column := "uc.target_id"
+	switch c.Query("direction", "incoming") {
+	case "incoming":
+	case "outgoing":
+		column = "uc.requester_id"
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "direction must be incoming or outgoing"})
+	}
+
+	rows, err := util.DB.Query(`
+		SELECT uc.id, uc.connection_type, `+connectionRoleSQL+`, uc.status, u.id, u.name, u.profile_pic,
+		       COALESCE(uc.mentee_activity_access, false), uc.created_at, uc.updated_at
+		FROM user_connections uc
+		JOIN users u ON u.id = CASE WHEN uc.requester_id = $1 THEN uc.target_id ELSE uc.requester_id END
+		WHERE u.deleted = false AND uc.status = 'pending' AND `+column+` = $1
+		ORDER BY uc.created_at DESC, uc.id DESC`, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch requests"})
+	}
+	defer rows.Close()
+	requests, err := scanConnections(rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read requests"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "requests": requests})
+}
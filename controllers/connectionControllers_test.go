@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"testing"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	if !isUniqueViolation(fmt.Errorf("insert: %w", &pq.Error{Code: "23505"})) {
+		t.Fatal("wrapped 23505 should be a unique violation")
+	}
+	if isUniqueViolation(&pq.Error{Code: "23503"}) || isUniqueViolation(fmt.Errorf("boom")) {
+		t.Fatal("other errors are not unique violations")
+	}
+}
+
+func TestConnectionConflictMessage(t *testing.T) {
+	if connectionConflictMessage("pending", true) == connectionConflictMessage("pending", false) {
+		t.Fatal("a request from the other user should be explained differently")
+	}
+	if got := connectionConflictMessage("accepted", true); got != "You are already connected" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultCustomSessionCount = 20
+	maxCustomSessionCount     = 200
+)
+
+// questionFilterSpec selects the questions of a custom practice session. The fields mirror the
+// GetQuestions filters; the spec is stored with the session so it can be shown and repeated.
+type questionFilterSpec struct {
+	Subject          string   `json:"subject,omitempty"`
+	Exam             string   `json:"exam,omitempty"`
+	Language         string   `json:"language,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	DifficultySource string   `json:"difficulty_source,omitempty"` // authored (default) or calibrated
+	MinDifficulty    *float64 `json:"min_difficulty,omitempty"`
+	MaxDifficulty    *float64 `json:"max_difficulty,omitempty"`
+	UnseenOnly       bool     `json:"unseen_only,omitempty"` // skip questions from the learner's earlier sessions
+	Count            int      `json:"count"`
+}
+
+func (f *questionFilterSpec) normalize() error {
+	if f.Count == 0 {
+		f.Count = defaultCustomSessionCount
+	}
+	if f.Count < 1 || f.Count > maxCustomSessionCount {
+		return fmt.Errorf("count must be between 1 and %d", maxCustomSessionCount)
+	}
+	if f.DifficultySource == "" {
+		f.DifficultySource = "authored"
+	}
+	if f.DifficultySource != "authored" && f.DifficultySource != "calibrated" {
+		return fmt.Errorf("difficulty_source must be authored or calibrated")
+	}
+	if f.MinDifficulty != nil && f.MaxDifficulty != nil && *f.MinDifficulty > *f.MaxDifficulty {
+		return fmt.Errorf("min_difficulty cannot exceed max_difficulty")
+	}
+	return nil
+}
+
+// where returns the conditions on questions q for the spec and their arguments, numbered from $1.
+// Questions found only in the locked sets are left out.
+func (f questionFilterSpec) where(userID int, locked []int) (string, []interface{}) {
+	conditions := "q.deleted = false"
+	var args []interface{}
+	add := func(format string, arg interface{}) {
+		args = append(args, arg)
+		conditions += fmt.Sprintf(" AND "+format, len(args))
+	}
+	if f.Subject != "" {
+		add("q.subject = $%d", f.Subject)
+	}
+	if f.Exam != "" {
+		add("q.exam = $%d", f.Exam)
+	}
+	if f.Language != "" {
+		add("q.language = $%d", f.Language)
+	}
+	if len(f.Tags) > 0 {
+		add(`EXISTS (
+			SELECT 1 FROM question_questiontags qqt
+			JOIN questiontags qt ON qt.id = qqt.questiontags_id
+			WHERE qqt.question_id = q.id AND qt.name = ANY($%d))`, pq.Array(f.Tags))
+	}
+	difficultyColumn := "q.difficulty"
+	if f.DifficultySource == "calibrated" {
+		difficultyColumn = "q.calibrated_difficulty"
+	}
+	if f.MinDifficulty != nil {
+		add(difficultyColumn+" >= $%d", *f.MinDifficulty)
+	}
+	if f.MaxDifficulty != nil {
+		add(difficultyColumn+" <= $%d", *f.MaxDifficulty)
+	}
+	if f.UnseenOnly {
+		add(`NOT EXISTS (
+			SELECT 1 FROM test_session_question_answers seen
+			JOIN test_sessions ts ON ts.id = seen.test_session_id
+			WHERE seen.question_id = q.id AND ts.taken_by_id = $%d)`, userID)
+	}
+	if len(locked) > 0 {
+		add("NOT ("+onlyInLockedSetsSQL+")", pq.Array(locked))
+	}
+	return conditions, args
+}
+
+func (f questionFilterSpec) sessionName() string {
+	switch {
+	case f.Subject != "":
+		return "Practice: " + f.Subject
+	case len(f.Tags) > 0:
+		return "Practice: " + f.Tags[0]
+	case f.Exam != "":
+		return "Practice: " + f.Exam
+	default:
+		return "Custom practice"
+	}
+}
+
+// createCustomTestSession draws a random selection of questions matching the filters and
+// stores it as a fixed session; the chosen questions don't change once the session exists.
+func createCustomTestSession(c *fiber.Ctx, user models.User, spec questionFilterSpec, session newTestSession) error {
+	if err := spec.normalize(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	locked, err := lockedSetIDs(util.DB, &user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access to question sets"})
+	}
+	where, args := spec.where(user.ID, locked)
+	args = append(args, spec.Count)
+	rows, err := util.DB.Query(`
+		SELECT q.id, COALESCE(array_length(q.options, 1), 0), q.question_type
+		FROM questions q
+		WHERE `+where+fmt.Sprintf(`
+		ORDER BY random()
+		LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch questions " + err.Error()})
+	}
+	var questions []sessionQuestion
+	var questionIDs []int
+	for rows.Next() {
+		q := sessionQuestion{Mark: 1}
+		if err := rows.Scan(&q.ID, &q.NOptions, &q.QuestionType); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read question"})
+		}
+		questions = append(questions, q)
+		questionIDs = append(questionIDs, q.ID)
+	}
+	rows.Close()
+	if len(questions) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No questions match the filters"})
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filters"})
+	}
+	sourceSpec := string(specJSON)
+	session.Name = spec.sessionName()
+	session.UserID = user.ID
+	session.SourceType = "filters"
+	session.SourceSpec = &sourceSpec
+	session.Scheme = defaultMarkingScheme
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+	sessionID, err := insertTestSession(tx, session, questions)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create test session " + err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":       "success",
+		"test_session": sessionID,
+		"question_ids": questionIDs,
+		"randomized":   true,
+		"question_set": session.Name,
+		"filters":      spec,
+		"requested":    spec.Count,
+	})
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuestionFilterSpecNormalize(t *testing.T) {
+	var spec questionFilterSpec
+	if err := spec.normalize(); err != nil {
+		t.Fatalf("empty spec should be valid: %v", err)
+	}
+	if spec.Count != defaultCustomSessionCount || spec.DifficultySource != "authored" {
+		t.Fatalf("unexpected defaults %+v", spec)
+	}
+
+	low, high := 7.0, 3.0
+	for _, bad := range []questionFilterSpec{
+		{Count: maxCustomSessionCount + 1},
+		{Count: -1},
+		{DifficultySource: "guessed"},
+		{MinDifficulty: &low, MaxDifficulty: &high},
+	} {
+		if err := bad.normalize(); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestQuestionFilterSpecWhere(t *testing.T) {
+	min := 4.0
+	spec := questionFilterSpec{Subject: "Physics", Tags: []string{"optics"}, DifficultySource: "calibrated", MinDifficulty: &min}
+	where, args := spec.where(42, nil)
+	if len(args) != 3 {
+		t.Fatalf("expected 3 args, got %d", len(args))
+	}
+	if !strings.Contains(where, "q.calibrated_difficulty >= $3") || strings.Contains(where, "taken_by_id") {
+		t.Fatalf("unexpected conditions %q", where)
+	}
+
+	spec.UnseenOnly = true
+	where, args = spec.where(42, nil)
+	if args[len(args)-1] != 42 || !strings.Contains(where, "ts.taken_by_id = $4") {
+		t.Fatalf("unseen filter should bind the user last, got %q %v", where, args)
+	}
+}
+
+func TestQuestionFilterSpecWhereLockedSets(t *testing.T) {
+	spec := questionFilterSpec{Subject: "Physics"}
+	where, args := spec.where(42, []int{7, 9})
+	if len(args) != 2 {
+		t.Fatalf("expected 2 args, got %d", len(args))
+	}
+	if !strings.Contains(where, "ANY($2)") || !strings.Contains(where, "<> ALL($2)") {
+		t.Fatalf("locked sets should be bound as $2, got %q", where)
+	}
+}
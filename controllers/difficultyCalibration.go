@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// Question difficulty is calibrated with a Rasch (1PL IRT) model fitted by joint maximum
+// likelihood over every answered question of every finished test session. Answers are
+// re-graded against the current answer key, so running the calibration twice on the same
+// history gives the same numbers. A weak normal prior on abilities and difficulties keeps
+// learners and questions with all-correct or all-wrong records finite.
+const (
+	defaultCalibrationMinAttempts   = 30
+	defaultCalibrationIntervalHours = 24
+	calibrationAdvisoryLock         = 7002
+	calibrationPriorVariance        = 4.0
+	calibrationMaxIterations        = 200
+	calibrationTolerance            = 1e-6
+)
+
+type calibrationResponse struct {
+	LearnerID  int
+	QuestionID int
+	Correct    bool
+}
+
+type questionCalibration struct {
+	Logit    float64 // Rasch difficulty, centred on the calibrated questions
+	Attempts int
+}
+
+// calibratedScale maps a Rasch logit onto the 1-10 scale used by questions.difficulty:
+// an average question lands at 5.5 and each logit is worth 1.5 points.
+func calibratedScale(logit float64) float64 {
+	d := 5.5 + 1.5*logit
+	return math.Round(math.Min(10, math.Max(1, d))*10) / 10
+}
+
+// calibrateRasch fits difficulties for the questions with at least minAttempts responses.
+func calibrateRasch(responses []calibrationResponse, minAttempts int) map[int]questionCalibration {
+	attempts := make(map[int]int)
+	for _, r := range responses {
+		attempts[r.QuestionID]++
+	}
+	var kept []calibrationResponse
+	for _, r := range responses {
+		if attempts[r.QuestionID] >= minAttempts {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		return map[int]questionCalibration{}
+	}
+
+	ability := make(map[int]float64)
+	difficulty := make(map[int]float64)
+	for _, r := range kept {
+		ability[r.LearnerID] = 0
+		difficulty[r.QuestionID] = 0
+	}
+	learners := sortedKeys(ability)
+	questions := sortedKeys(difficulty)
+	byLearner := make(map[int][]calibrationResponse)
+	byQuestion := make(map[int][]calibrationResponse)
+	for _, r := range kept {
+		byLearner[r.LearnerID] = append(byLearner[r.LearnerID], r)
+		byQuestion[r.QuestionID] = append(byQuestion[r.QuestionID], r)
+	}
+
+	for iter := 0; iter < calibrationMaxIterations; iter++ {
+		maxChange := 0.0
+		for _, l := range learners {
+			grad, info := -ability[l]/calibrationPriorVariance, 1/calibrationPriorVariance
+			for _, r := range byLearner[l] {
+				p := raschProbability(ability[l], difficulty[r.QuestionID])
+				grad += boolToFloat(r.Correct) - p
+				info += p * (1 - p)
+			}
+			step := grad / info
+			ability[l] += step
+			maxChange = math.Max(maxChange, math.Abs(step))
+		}
+		for _, q := range questions {
+			grad, info := -difficulty[q]/calibrationPriorVariance, 1/calibrationPriorVariance
+			for _, r := range byQuestion[q] {
+				p := raschProbability(ability[r.LearnerID], difficulty[q])
+				grad += p - boolToFloat(r.Correct)
+				info += p * (1 - p)
+			}
+			step := grad / info
+			difficulty[q] += step
+			maxChange = math.Max(maxChange, math.Abs(step))
+		}
+		if maxChange < calibrationTolerance {
+			break
+		}
+	}
+
+	// Centre difficulties so that the average calibrated question is 0 logits.
+	var total float64
+	for _, q := range questions {
+		total += difficulty[q]
+	}
+	centre := total / float64(len(questions))
+	result := make(map[int]questionCalibration, len(questions))
+	for _, q := range questions {
+		result[q] = questionCalibration{Logit: difficulty[q] - centre, Attempts: attempts[q]}
+	}
+	return result
+}
+
+func raschProbability(ability, difficulty float64) float64 {
+	return 1 / (1 + math.Exp(difficulty-ability))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[int]float64) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// runDifficultyCalibration recalibrates every question from the stored answer history.
+// It returns how many questions received a calibrated difficulty, or ok=false when another
+// instance is already calibrating.
+func runDifficultyCalibration(minAttempts int) (calibrated int, ok bool, err error) {
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, calibrationAdvisoryLock).Scan(&ok); err != nil || !ok {
+		return 0, false, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT ts.taken_by_id, tsqa.question_id, tsqa.selected_answer_list, tsqa.order_list, tsqa.numeric_answer
+		FROM test_session_question_answers tsqa
+		JOIN test_sessions ts ON ts.id = tsqa.test_session_id
+		WHERE ts.finished AND tsqa.answered
+		ORDER BY ts.taken_by_id, tsqa.question_id, ts.started_time`)
+	if err != nil {
+		return 0, true, err
+	}
+	type storedAnswer struct {
+		learnerID, questionID int
+		answer                submittedAnswer
+		orderList             []int64
+	}
+	var answers []storedAnswer
+	questionIDSet := make(map[int]bool)
+	for rows.Next() {
+		var a storedAnswer
+		var selected, orderList pq.Int64Array
+		if err := rows.Scan(&a.learnerID, &a.questionID, &selected, &orderList, &a.answer.NumericAnswer); err != nil {
+			rows.Close()
+			return 0, true, err
+		}
+		a.answer.Selected, a.orderList = selected, orderList
+		answers = append(answers, a)
+		questionIDSet[a.questionID] = true
+	}
+	rows.Close()
+
+	questionIDs := make([]int, 0, len(questionIDSet))
+	for qid := range questionIDSet {
+		questionIDs = append(questionIDs, qid)
+	}
+	keys, err := loadAnswerKeys(questionIDs)
+	if err != nil {
+		return 0, true, err
+	}
+
+	responses := make([]calibrationResponse, 0, len(answers))
+	for _, a := range answers {
+		key, found := keys[a.questionID]
+		if !found {
+			continue
+		}
+		_, correct, err := gradeAnswer(key, a.orderList, a.answer, 1, defaultMarkingScheme)
+		if err != nil {
+			continue
+		}
+		responses = append(responses, calibrationResponse{LearnerID: a.learnerID, QuestionID: a.questionID, Correct: correct})
+	}
+	calibration := calibrateRasch(responses, minAttempts)
+
+	// Questions below the threshold lose any earlier calibration so the table always
+	// reflects this run.
+	calibratedAt := time.Now().UTC()
+	if _, err := tx.Exec(`
+		UPDATE questions
+		SET calibrated_difficulty = NULL, calibrated_logit = NULL, calibration_attempts = 0, calibrated_at = $1
+		WHERE calibrated_difficulty IS NOT NULL`, calibratedAt); err != nil {
+		return 0, true, err
+	}
+	for qid, cal := range calibration {
+		if _, err := tx.Exec(`
+			UPDATE questions
+			SET calibrated_difficulty = $1, calibrated_logit = $2, calibration_attempts = $3, calibrated_at = $4
+			WHERE id = $5`, calibratedScale(cal.Logit), cal.Logit, cal.Attempts, calibratedAt, qid); err != nil {
+			return 0, true, err
+		}
+	}
+	return len(calibration), true, tx.Commit()
+}
+
+// StartDifficultyCalibration recalibrates question difficulty every CALIBRATION_INTERVAL_HOURS.
+func StartDifficultyCalibration() {
+	interval := time.Duration(envInt("CALIBRATION_INTERVAL_HOURS", defaultCalibrationIntervalHours)) * time.Hour
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, ok, err := runDifficultyCalibration(envInt("CALIBRATION_MIN_ATTEMPTS", defaultCalibrationMinAttempts))
+			if err != nil {
+				log.Println("difficulty calibration:", err)
+			} else if ok {
+				log.Printf("difficulty calibration: calibrated %d questions", n)
+			}
+		}
+	}()
+}
+
+// CalibrateQuestionDifficulty runs the calibration on demand.
+func CalibrateQuestionDifficulty(c *fiber.Ctx) error {
+	currentUser := c.Locals("user").(models.User)
+	if currentUser.Role != "admin" && currentUser.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Only admins can access this endpoint",
+		})
+	}
+
+	minAttempts := c.QueryInt("min_attempts", envInt("CALIBRATION_MIN_ATTEMPTS", defaultCalibrationMinAttempts))
+	if minAttempts < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "min_attempts must be at least 1"})
+	}
+	n, ok, err := runDifficultyCalibration(minAttempts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Calibration failed: " + err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A calibration is already running"})
+	}
+	return c.JSON(fiber.Map{
+		"status":               "success",
+		"calibrated_questions": n,
+		"min_attempts":         minAttempts,
+	})
+}
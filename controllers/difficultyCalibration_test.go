@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"testing"
+)
+
+func TestCalibrateRaschOrdersQuestionsByDifficulty(t *testing.T) {
+	// Question 1 is answered correctly by nearly everyone, question 3 by nearly no one.
+	correctRate := map[int]int{1: 9, 2: 5, 3: 1} // out of 10 learners
+	var responses []calibrationResponse
+	for learner := 0; learner < 10; learner++ {
+		for qid, rate := range correctRate {
+			responses = append(responses, calibrationResponse{LearnerID: learner, QuestionID: qid, Correct: learner < rate})
+		}
+	}
+	// Question 4 has too few attempts to be calibrated.
+	responses = append(responses, calibrationResponse{LearnerID: 0, QuestionID: 4, Correct: true})
+
+	cal := calibrateRasch(responses, 5)
+	if _, ok := cal[4]; ok {
+		t.Fatal("question below the attempt threshold was calibrated")
+	}
+	if !(cal[1].Logit < cal[2].Logit && cal[2].Logit < cal[3].Logit) {
+		t.Fatalf("difficulties out of order: %+v", cal)
+	}
+	if cal[1].Attempts != 10 {
+		t.Fatalf("unexpected attempt count %d", cal[1].Attempts)
+	}
+	if d := calibratedScale(cal[3].Logit); d <= 5.5 || d > 10 {
+		t.Fatalf("hard question mapped to %v", d)
+	}
+
+	again := calibrateRasch(responses, 5)
+	for qid := range cal {
+		if cal[qid] != again[qid] {
+			t.Fatal("calibration is not reproducible")
+		}
+	}
+}
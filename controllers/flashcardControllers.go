@@ -0,0 +1,474 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"time"
+)
+
+type flashcardDeck struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	SourceType    string    `json:"source_type"`
+	QuestionSetID *int      `json:"question_set_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	CardCount     int       `json:"card_count"`
+	DueCount      int       `json:"due_count"`
+}
+
+// deckSourceSQL selects the question IDs a generated deck is built from; $2 is the question
+// set ID or the user ID.
+var deckSourceSQL = map[string]string{
+	"question_set":       `SELECT question_id FROM question_set_questions WHERE question_set_id = $2`,
+	"bookmarks":          `SELECT question_id FROM bookmarked_questions WHERE user_id = $2`,
+	"saved_explanations": `SELECT question_id FROM saved_explanations WHERE user_id = $2`,
+}
+
+func CreateDeck(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var input struct {
+		Name          string `json:"name"`
+		Source        string `json:"source"` // manual (default), question_set, bookmarks or saved_explanations
+		QuestionSetID *int   `json:"question_set_id"`
+		QuestionIDs   []int  `json:"question_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input " + err.Error()})
+	}
+	if input.Source == "" {
+		input.Source = "manual"
+	}
+	if !deckSources[input.Source] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "source must be one of manual, question_set, bookmarks or saved_explanations"})
+	}
+	if input.Source == "question_set" {
+		if input.QuestionSetID == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "question_set_id is required for question_set decks"})
+		}
+		var setName string
+		err := util.DB.QueryRow(`SELECT name FROM question_sets WHERE id = $1 AND deleted <> true`, *input.QuestionSetID).Scan(&setName)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question set not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set"})
+		}
+		canStart, lockedReason, err := questionSetAccess(util.DB, *input.QuestionSetID, &user)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access to the question set"})
+		}
+		if !canStart {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This question set is locked", "locked_reason": lockedReason})
+		}
+		if input.Name == "" {
+			input.Name = setName
+		}
+	} else {
+		input.QuestionSetID = nil
+	}
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var deckID int
+	err = tx.QueryRow(`
+		INSERT INTO flashcard_decks (user_id, name, source_type, question_set_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, user.ID, input.Name, input.Source, input.QuestionSetID).Scan(&deckID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create deck " + err.Error()})
+	}
+
+	var added int64
+	if input.Source == "manual" {
+		added, err = addDeckCards(tx, deckID, input.QuestionIDs)
+	} else {
+		added, err = syncDeckCards(tx, deckID, user.ID, input.Source, input.QuestionSetID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add cards " + err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":      "success",
+		"deck_id":     deckID,
+		"cards_added": added,
+	})
+}
+
+// addDeckCards adds existing, non-deleted questions to a deck; questions already in it are skipped.
+func addDeckCards(tx *sql.Tx, deckID int, questionIDs []int) (int64, error) {
+	if len(questionIDs) == 0 {
+		return 0, nil
+	}
+	res, err := tx.Exec(`
+		INSERT INTO flashcard_cards (deck_id, question_id, due_at)
+		SELECT $1, q.id, $3 FROM questions q
+		WHERE q.id = ANY($2) AND q.deleted <> true
+		ON CONFLICT (deck_id, question_id) DO NOTHING`, deckID, pq.Array(questionIDs), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// syncDeckCards adds the questions of a generated deck's source that aren't in it yet. Cards
+// are never removed by a sync, so review history survives un-bookmarking a question.
+func syncDeckCards(tx *sql.Tx, deckID, userID int, source string, questionSetID *int) (int64, error) {
+	sourceSQL, ok := deckSourceSQL[source]
+	if !ok {
+		return 0, fmt.Errorf("%s decks have no source to sync", source)
+	}
+	var sourceArg interface{} = userID
+	if source == "question_set" {
+		if questionSetID == nil {
+			return 0, fmt.Errorf("deck has no question set")
+		}
+		sourceArg = *questionSetID
+	}
+	res, err := tx.Exec(`
+		INSERT INTO flashcard_cards (deck_id, question_id, due_at)
+		SELECT $1, q.id, $3 FROM (`+sourceSQL+`) src
+		JOIN questions q ON q.id = src.question_id AND q.deleted <> true
+		ON CONFLICT (deck_id, question_id) DO NOTHING`, deckID, sourceArg, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ownedDeck loads a deck of the given user; sql.ErrNoRows covers both missing and foreign decks.
+func ownedDeck(deckID, userID int) (flashcardDeck, error) {
+	var deck flashcardDeck
+	err := util.DB.QueryRow(`
+		SELECT id, name, source_type, question_set_id, created_at,
+		       (SELECT COUNT(*) FROM flashcard_cards WHERE deck_id = d.id),
+		       (SELECT COUNT(*) FROM flashcard_cards WHERE deck_id = d.id AND due_at <= $3)
+		FROM flashcard_decks d
+		WHERE id = $1 AND user_id = $2`, deckID, userID, time.Now().UTC()).
+		Scan(&deck.ID, &deck.Name, &deck.SourceType, &deck.QuestionSetID, &deck.CreatedAt, &deck.CardCount, &deck.DueCount)
+	return deck, err
+}
+
+// deckFromParams loads the caller's deck named by the :id param. A non-zero status and message
+// describe why it couldn't.
+func deckFromParams(c *fiber.Ctx) (flashcardDeck, int, string) {
+	deckID, err := c.ParamsInt("id")
+	if err != nil {
+		return flashcardDeck{}, fiber.StatusBadRequest, "Invalid deck ID"
+	}
+	user := c.Locals("user").(models.User)
+	deck, err := ownedDeck(deckID, user.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return deck, fiber.StatusNotFound, "Deck not found"
+		}
+		return deck, fiber.StatusInternalServerError, "Failed to fetch deck"
+	}
+	return deck, 0, ""
+}
+
+// loadDeckCards returns a deck's cards, soonest due first. With dueBefore set only due cards
+// are returned.
+func loadDeckCards(deckID, userID int, dueBefore *time.Time, limit int) ([]flashcard, error) {
+	query := `
+		SELECT fc.question_id, q.question, q.question_type, q.options, q.correct_options, q.numeric_answer,
+		       q.explanation, se.explanation, fc.due_at, fc.interval_days, fc.repetitions, fc.ease_factor,
+		       fc.last_rating, fc.last_reviewed_at
+		FROM flashcard_cards fc
+		JOIN questions q ON q.id = fc.question_id AND q.deleted <> true
+		LEFT JOIN saved_explanations se ON se.question_id = fc.question_id AND se.user_id = $2
+		WHERE fc.deck_id = $1`
+	args := []interface{}{deckID, userID}
+	if dueBefore != nil {
+		args = append(args, dueBefore.UTC())
+		query += fmt.Sprintf(" AND fc.due_at < $%d", len(args))
+	}
+	query += " ORDER BY fc.due_at, fc.question_id"
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := util.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []flashcard{}
+	for rows.Next() {
+		var card flashcard
+		var key answerKey
+		var correctOptions pq.Int64Array
+		var numericJSON []byte
+		var explanation *string
+		if err := rows.Scan(&card.QuestionID, &card.Front, &key.QuestionType, pq.Array(&key.Options), &correctOptions,
+			&numericJSON, &explanation, &card.SavedExplanation, &card.DueAt, &card.IntervalDays, &card.Repetitions,
+			&card.EaseFactor, &card.LastRating, &card.LastReviewedAt); err != nil {
+			return nil, err
+		}
+		key.CorrectOptions = correctOptions
+		if key.Numeric, err = parseNumericAnswerJSON(numericJSON); err != nil {
+			return nil, err
+		}
+		if key.QuestionType != "numeric" {
+			card.Options = key.Options
+		}
+		card.Back = flashcardBack(key, card.SavedExplanation, explanation)
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+func GetDecks(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	rows, err := util.DB.Query(`
+		SELECT d.id, d.name, d.source_type, d.question_set_id, d.created_at,
+		       COUNT(fc.question_id),
+		       COUNT(fc.question_id) FILTER (WHERE fc.due_at <= $2)
+		FROM flashcard_decks d
+		LEFT JOIN flashcard_cards fc ON fc.deck_id = d.id
+		WHERE d.user_id = $1
+		GROUP BY d.id
+		ORDER BY d.created_at DESC`, user.ID, time.Now().UTC())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch decks"})
+	}
+	defer rows.Close()
+
+	decks := []flashcardDeck{}
+	for rows.Next() {
+		var d flashcardDeck
+		if err := rows.Scan(&d.ID, &d.Name, &d.SourceType, &d.QuestionSetID, &d.CreatedAt, &d.CardCount, &d.DueCount); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read deck"})
+		}
+		decks = append(decks, d)
+	}
+	return c.JSON(fiber.Map{"status": "success", "decks": decks})
+}
+
+func GetDeck(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	user := c.Locals("user").(models.User)
+	cards, err := loadDeckCards(deck.ID, user.ID, nil, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch cards: " + err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "deck": deck, "cards": cards})
+}
+
+func DeleteDeck(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if _, err := util.DB.Exec(`DELETE FROM flashcard_decks WHERE id = $1`, deck.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete deck"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Deck deleted"})
+}
+
+func AddDeckCards(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	var input struct {
+		QuestionIDs []int `json:"question_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil || len(input.QuestionIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "question_ids is required"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+	added, err := addDeckCards(tx, deck.ID, input.QuestionIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add cards " + err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "cards_added": added})
+}
+
+func RemoveDeckCard(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	questionID, err := c.ParamsInt("qid")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question ID"})
+	}
+	res, err := util.DB.Exec(`DELETE FROM flashcard_cards WHERE deck_id = $1 AND question_id = $2`, deck.ID, questionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove card"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Card not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Card removed"})
+}
+
+// SyncDeck pulls new questions from a generated deck's source.
+func SyncDeck(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if deck.SourceType == "manual" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Manual decks have no source to sync"})
+	}
+	user := c.Locals("user").(models.User)
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+	added, err := syncDeckCards(tx, deck.ID, user.ID, deck.SourceType, deck.QuestionSetID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sync deck " + err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "cards_added": added})
+}
+
+// GetDueDeckCards lists the cards due by the end of the user's day.
+func GetDueDeckCards(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	_, tzLoc, err := resolveTimezone(c.Query("tz", "UTC"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid timezone"})
+	}
+	limit := c.QueryInt("limit", defaultReviewQueueLimit)
+	if limit < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be at least 1"})
+	}
+	user := c.Locals("user").(models.User)
+
+	cutoff := endOfLocalDay(time.Now(), tzLoc)
+	cards, err := loadDeckCards(deck.ID, user.ID, &cutoff, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch cards: " + err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "due_until": cutoff, "cards": cards})
+}
+
+// ReviewDeckCard records a self-graded review (again, hard, good or easy) and reschedules the card.
+func ReviewDeckCard(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	var input struct {
+		QuestionID int    `json:"question_id"`
+		Rating     string `json:"rating"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input " + err.Error()})
+	}
+	quality, ok := flashcardRatings[input.Rating]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "rating must be one of again, hard, good or easy"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var state reviewState
+	err = tx.QueryRow(`
+		SELECT ease_factor, interval_days, repetitions, lapses
+		FROM flashcard_cards
+		WHERE deck_id = $1 AND question_id = $2
+		FOR UPDATE`, deck.ID, input.QuestionID).Scan(&state.EaseFactor, &state.IntervalDays, &state.Repetitions, &state.Lapses)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Card not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch card"})
+	}
+
+	now := time.Now().UTC()
+	next, dueAt := state.schedule(quality, now)
+	_, err = tx.Exec(`
+		UPDATE flashcard_cards
+		SET ease_factor = $1, interval_days = $2, repetitions = $3, lapses = $4,
+		    last_rating = $5, last_reviewed_at = $6, due_at = $7
+		WHERE deck_id = $8 AND question_id = $9`,
+		next.EaseFactor, next.IntervalDays, next.Repetitions, next.Lapses, input.Rating, now, dueAt, deck.ID, input.QuestionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update card"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":        "success",
+		"question_id":   input.QuestionID,
+		"due_at":        dueAt,
+		"interval_days": next.IntervalDays,
+		"ease_factor":   next.EaseFactor,
+	})
+}
+
+// ExportDeck downloads a deck as CSV (default) or JSON.
+func ExportDeck(c *fiber.Ctx) error {
+	deck, status, msg := deckFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	user := c.Locals("user").(models.User)
+	cards, err := loadDeckCards(deck.ID, user.ID, nil, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch cards: " + err.Error()})
+	}
+
+	filename := SlugifyUsername(deck.Name)
+	switch c.Query("format", "csv") {
+	case "csv":
+		var buf bytes.Buffer
+		if err := writeDeckCSV(&buf, cards); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to write CSV"})
+		}
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Attachment(filename + ".csv")
+		return c.Send(buf.Bytes())
+	case "json":
+		c.Attachment(filename + ".json")
+		return c.JSON(fiber.Map{"deck": deck, "cards": cards})
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be csv or json"})
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flashcards are self-graded; each rating maps onto an SM-2 recall quality so decks share
+// the scheduler used by the review queue.
+var flashcardRatings = map[string]int{
+	"again": 1,
+	"hard":  3,
+	"good":  4,
+	"easy":  5,
+}
+
+var deckSources = map[string]bool{
+	"manual":             true,
+	"question_set":       true,
+	"bookmarks":          true,
+	"saved_explanations": true,
+}
+
+type flashcard struct {
+	QuestionID       int        `json:"question_id"`
+	Front            string     `json:"front"`
+	Options          []string   `json:"options,omitempty"`
+	Back             string     `json:"back"`
+	SavedExplanation *string    `json:"saved_explanation"`
+	DueAt            time.Time  `json:"due_at"`
+	IntervalDays     int        `json:"interval_days"`
+	Repetitions      int        `json:"repetitions"`
+	EaseFactor       float64    `json:"ease_factor"`
+	LastRating       *string    `json:"last_rating"`
+	LastReviewedAt   *time.Time `json:"last_reviewed_at"`
+}
+
+// flashcardAnswer is the text of a question's correct answer: the keyed options, or the
+// numeric value with its unit.
+func flashcardAnswer(key answerKey) string {
+	if key.QuestionType == "numeric" && key.Numeric != nil {
+		answer := strconv.FormatFloat(key.Numeric.Value, 'g', -1, 64)
+		for _, u := range key.Numeric.Units {
+			if u.Factor == 1 {
+				answer += " " + u.Unit
+				break
+			}
+		}
+		return answer
+	}
+	var correct []string
+	for _, idx := range key.CorrectOptions {
+		if idx >= 0 && int(idx) < len(key.Options) {
+			correct = append(correct, key.Options[idx])
+		}
+	}
+	return strings.Join(correct, "; ")
+}
+
+// flashcardBack puts the learner's own explanation under the answer, falling back to the
+// question's explanation when they haven't saved one.
+func flashcardBack(key answerKey, savedExplanation, explanation *string) string {
+	back := flashcardAnswer(key)
+	note := savedExplanation
+	if note == nil || strings.TrimSpace(*note) == "" {
+		note = explanation
+	}
+	if note != nil && strings.TrimSpace(*note) != "" {
+		back += "\n\n" + strings.TrimSpace(*note)
+	}
+	return back
+}
+
+// writeDeckCSV writes a deck as front/back rows, the format flashcard apps import.
+func writeDeckCSV(w io.Writer, cards []flashcard) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"front", "back", "question_id"}); err != nil {
+		return err
+	}
+	for _, card := range cards {
+		front := card.Front
+		for i, option := range card.Options {
+			front += "\n" + string(rune('A'+i)) + ". " + option
+		}
+		if err := cw.Write([]string{front, card.Back, strconv.Itoa(card.QuestionID)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
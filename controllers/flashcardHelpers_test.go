@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"testing"
+	"time"
+)
+
+func TestFlashcardBack(t *testing.T) {
+	key := answerKey{QuestionType: "m-select", Options: []string{"H2O", "CO2", "O2"}, CorrectOptions: []int64{0, 2}}
+	explanation := "Both contain oxygen."
+	saved := "Remember: water and oxygen."
+
+	if got := flashcardBack(key, nil, &explanation); got != "H2O; O2\n\nBoth contain oxygen." {
+		t.Fatalf("unexpected back %q", got)
+	}
+	if got := flashcardBack(key, &saved, &explanation); got != "H2O; O2\n\nRemember: water and oxygen." {
+		t.Fatalf("saved explanation should win, got %q", got)
+	}
+
+	numeric := answerKey{QuestionType: "numeric", Numeric: &models.NumericAnswer{
+		Value: 9.81,
+		Units: []models.NumericUnit{{Unit: "cm/s^2", Factor: 0.01}, {Unit: "m/s^2", Factor: 1}},
+	}}
+	if got := flashcardBack(numeric, nil, nil); got != "9.81 m/s^2" {
+		t.Fatalf("unexpected numeric back %q", got)
+	}
+}
+
+func TestWriteDeckCSV(t *testing.T) {
+	cards := []flashcard{{QuestionID: 7, Front: "Capital of France?", Options: []string{"Paris", "Rome"}, Back: "Paris"}}
+	var buf bytes.Buffer
+	if err := writeDeckCSV(&buf, cards); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][0] != "Capital of France?\nA. Paris\nB. Rome" || records[1][1] != "Paris" || records[1][2] != "7" {
+		t.Fatalf("unexpected CSV %q", records)
+	}
+}
+
+func TestFlashcardRatingsOrdered(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := newReviewState()
+	state, _ = state.schedule(flashcardRatings["good"], now)
+	var prev int
+	for _, rating := range []string{"again", "hard", "good", "easy"} {
+		next, _ := state.schedule(flashcardRatings[rating], now)
+		if next.IntervalDays < prev {
+			t.Fatalf("%s scheduled sooner than a lower rating", rating)
+		}
+		prev = next.IntervalDays
+	}
+}
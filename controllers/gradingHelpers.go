@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// answerKey is the server-side view of a question that is needed to grade an answer.
+// It is always loaded from the questions table and never taken from the request body.
+type answerKey struct {
+	QuestionType   string
+	Options        []string
+	CorrectOptions []int64
+	Numeric        *models.NumericAnswer
+}
+
+// submittedAnswer is what a client is allowed to tell us about a question: what it selected,
+// or for numeric questions the value it typed.
+type submittedAnswer struct {
+	Selected      []int64
+	NumericAnswer *string
+	Answered      bool
+}
+
+// markingScheme is how a question set turns answers into marks. It is copied onto the
+// test session when the session starts so later edits to the set don't change running tests.
+// Penalties are fractions of the question's own mark.
+type markingScheme struct {
+	MSelectPolicy          string  // all-or-nothing, proportional or per-option
+	NegativeMarkRatio      float64 // deducted for a wrong answer
+	UnansweredPenaltyRatio float64 // deducted for a question left unanswered at finish
+}
+
+var defaultMarkingScheme = markingScheme{MSelectPolicy: "proportional"}
+
+var mSelectPolicies = map[string]bool{"all-or-nothing": true, "proportional": true, "per-option": true}
+
+// validateMarkingScheme checks a scheme sent by a question set author.
+func validateMarkingScheme(scheme markingScheme) error {
+	if !mSelectPolicies[scheme.MSelectPolicy] {
+		return fmt.Errorf("marking_scheme must be one of all-or-nothing, proportional or per-option")
+	}
+	if scheme.NegativeMarkRatio < 0 || scheme.NegativeMarkRatio > 1 {
+		return fmt.Errorf("negative_mark_ratio must be between 0 and 1")
+	}
+	if scheme.UnansweredPenaltyRatio < 0 || scheme.UnansweredPenaltyRatio > 1 {
+		return fmt.Errorf("unanswered_penalty_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// mergeMarkingScheme overlays the fields a request actually sent on top of base and validates the result.
+func mergeMarkingScheme(base markingScheme, policy *string, negativeRatio, unansweredRatio *float64) (markingScheme, error) {
+	if policy != nil {
+		base.MSelectPolicy = *policy
+	}
+	if negativeRatio != nil {
+		base.NegativeMarkRatio = *negativeRatio
+	}
+	if unansweredRatio != nil {
+		base.UnansweredPenaltyRatio = *unansweredRatio
+	}
+	return base, validateMarkingScheme(base)
+}
+
+var numericInputPattern = regexp.MustCompile(`^\s*([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*(.*?)\s*$`)
+
+// getRandomOrderList returns the display order of a question's options. Numeric questions
+// keep their original order since they have nothing to shuffle.
+func getRandomOrderList(nOptions int, questionType string) []int {
+	list := make([]int, nOptions)
+	for i := range list {
+		list[i] = i
+	}
+	if questionType == "numeric" {
+		return list
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(list), func(i, j int) {
+		list[i], list[j] = list[j], list[i]
+	})
+	return list
+}
+
+// parseSubmittedAnswer reads a single entry of question_answer_data. Anything other than
+// the selection and the answered flag (correct_options, questions_total_mark, ...) is ignored.
+func parseSubmittedAnswer(raw interface{}) (submittedAnswer, error) {
+	var answer submittedAnswer
+	data, ok := raw.(map[string]interface{})
+	if !ok {
+		return answer, fmt.Errorf("answer must be an object")
+	}
+	if selectedRaw, ok := data["selected_answer_list"].([]interface{}); ok {
+		answer.Selected = make([]int64, 0, len(selectedRaw))
+		for _, v := range selectedRaw {
+			f, ok := v.(float64)
+			if !ok || f != float64(int64(f)) {
+				return answer, fmt.Errorf("selected_answer_list must contain integer indices")
+			}
+			answer.Selected = append(answer.Selected, int64(f))
+		}
+	} else {
+		answer.Selected = []int64{}
+	}
+	// Numeric answers should be sent as strings so that significant figures survive.
+	switch v := data["numeric_answer"].(type) {
+	case string:
+		answer.NumericAnswer = &v
+	case float64:
+		formatted := strconv.FormatFloat(v, 'f', -1, 64)
+		answer.NumericAnswer = &formatted
+	}
+	answer.Answered, _ = data["answered"].(bool)
+	return answer, nil
+}
+
+// parseNumericAnswerJSON decodes questions.numeric_answer, which is NULL for every other question type.
+func parseNumericAnswerJSON(raw []byte) (*models.NumericAnswer, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var numeric models.NumericAnswer
+	if err := json.Unmarshal(raw, &numeric); err != nil {
+		return nil, err
+	}
+	return &numeric, nil
+}
+
+// normalizeNumericAnswer fills in defaults and validates the answer key of a numeric question.
+func normalizeNumericAnswer(numeric *models.NumericAnswer) error {
+	if numeric.ToleranceType == "" {
+		numeric.ToleranceType = "absolute"
+	}
+	if numeric.ToleranceType != "absolute" && numeric.ToleranceType != "relative" {
+		return fmt.Errorf("tolerance_type must be absolute or relative")
+	}
+	if numeric.Tolerance < 0 || math.IsNaN(numeric.Tolerance) || math.IsInf(numeric.Tolerance, 0) {
+		return fmt.Errorf("tolerance must be a non-negative number")
+	}
+	if math.IsNaN(numeric.Value) || math.IsInf(numeric.Value, 0) {
+		return fmt.Errorf("value must be a finite number")
+	}
+	if numeric.SigFigs != nil && *numeric.SigFigs < 1 {
+		return fmt.Errorf("sig_figs must be at least 1")
+	}
+	for i := range numeric.Units {
+		numeric.Units[i].Unit = strings.TrimSpace(numeric.Units[i].Unit)
+		if numeric.Units[i].Unit == "" {
+			return fmt.Errorf("units must have a name")
+		}
+		if numeric.Units[i].Factor == 0 {
+			numeric.Units[i].Factor = 1
+		}
+		if numeric.Units[i].Factor < 0 {
+			return fmt.Errorf("unit factor must be positive")
+		}
+	}
+	if numeric.UnitRequired && len(numeric.Units) == 0 {
+		return fmt.Errorf("unit_required needs at least one accepted unit")
+	}
+	return nil
+}
+
+// countSigFigs counts the significant figures of a number as the learner wrote it.
+// Trailing zeros of an integer without a decimal point are not counted.
+func countSigFigs(number string) int {
+	n := strings.TrimLeft(number, "+-")
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		n = n[:i]
+	}
+	hasPoint := strings.Contains(n, ".")
+	digits := strings.TrimLeft(strings.ReplaceAll(n, ".", ""), "0")
+	if !hasPoint {
+		digits = strings.TrimRight(digits, "0")
+	}
+	if digits == "" {
+		return 1
+	}
+	return len(digits)
+}
+
+// gradeNumeric checks a typed answer such as "9.81 m/s^2" against a numeric answer key.
+// Answers that cannot be read as a number are simply wrong.
+func gradeNumeric(numeric *models.NumericAnswer, input string) bool {
+	match := numericInputPattern.FindStringSubmatch(input)
+	if match == nil {
+		return false
+	}
+	number, unit := match[1], match[2]
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return false
+	}
+
+	if unit == "" {
+		if numeric.UnitRequired {
+			return false
+		}
+	} else {
+		found := false
+		for _, u := range numeric.Units {
+			if u.Unit == unit {
+				value *= u.Factor
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if numeric.SigFigs != nil && countSigFigs(number) != *numeric.SigFigs {
+		return false
+	}
+
+	allowed := numeric.Tolerance
+	if numeric.ToleranceType == "relative" {
+		allowed = numeric.Tolerance * math.Abs(numeric.Value)
+	}
+	// Leave room for floating point noise from unit conversion.
+	allowed += 1e-9 * math.Max(1, math.Abs(numeric.Value))
+	return math.Abs(value-numeric.Value) <= allowed
+}
+
+// toOriginalIndices maps indices of the shuffled options the learner saw back to positions
+// in questions.options, using the order_list stored for the session.
+func toOriginalIndices(orderList []int64, selected []int64) ([]int64, error) {
+	seen := make(map[int64]bool)
+	original := make([]int64, 0, len(selected))
+	for _, s := range selected {
+		if s < 0 || s >= int64(len(orderList)) {
+			return nil, fmt.Errorf("selected option %d is out of range", s)
+		}
+		if seen[s] {
+			return nil, fmt.Errorf("selected option %d is repeated", s)
+		}
+		seen[s] = true
+		original = append(original, orderList[s])
+	}
+	return original, nil
+}
+
+// gradeAnswer scores an answer against the stored answer key and reports whether the
+// answer is fully correct. Numeric questions compare the typed value with numeric_answer;
+// m-choice (and older numeric questions that keep their value as an option) need the single
+// keyed option; m-select follows the scheme's policy:
+//   - all-or-nothing: the full mark only for exactly the keyed options
+//   - proportional: the fraction of keyed options picked, nothing if any wrong option is picked
+//   - per-option: +1 share per keyed option picked and -1 share per wrong pick, never below -mark
+//
+// A wrong answer costs NegativeMarkRatio of the mark, except under per-option where wrong picks
+// are already charged. Empty answers score 0 here; the unanswered penalty is applied at finish.
+func gradeAnswer(key answerKey, orderList []int64, answer submittedAnswer, totalMark float64, scheme markingScheme) (float64, bool, error) {
+	penalty := -scheme.NegativeMarkRatio * totalMark
+
+	if key.QuestionType == "numeric" && key.Numeric != nil {
+		if answer.NumericAnswer == nil || strings.TrimSpace(*answer.NumericAnswer) == "" {
+			return 0, false, nil
+		}
+		if gradeNumeric(key.Numeric, *answer.NumericAnswer) {
+			return totalMark, true, nil
+		}
+		return penalty, false, nil
+	}
+
+	original, err := toOriginalIndices(orderList, answer.Selected)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(original) == 0 {
+		return 0, false, nil
+	}
+	correctMap := make(map[int64]bool)
+	for _, c := range key.CorrectOptions {
+		correctMap[c] = true
+	}
+
+	switch key.QuestionType {
+	case "m-choice", "numeric":
+		if len(original) == 1 && len(key.CorrectOptions) == 1 && correctMap[original[0]] {
+			return totalMark, true, nil
+		}
+	case "m-select":
+		if len(key.CorrectOptions) == 0 {
+			break
+		}
+		nRight, nWrong := 0, 0
+		for _, o := range original {
+			if correctMap[o] {
+				nRight++
+			} else {
+				nWrong++
+			}
+		}
+		allCorrect := nWrong == 0 && nRight == len(key.CorrectOptions)
+		share := totalMark / float64(len(key.CorrectOptions))
+		switch scheme.MSelectPolicy {
+		case "all-or-nothing":
+			if allCorrect {
+				return totalMark, true, nil
+			}
+		case "per-option":
+			return math.Max(share*float64(nRight-nWrong), -totalMark), allCorrect, nil
+		default:
+			if nWrong == 0 {
+				return share * float64(nRight), allCorrect, nil
+			}
+		}
+	}
+	return penalty, false, nil
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"math"
+	"testing"
+)
+
+func decodeAnswer(t *testing.T, payload string) submittedAnswer {
+	t.Helper()
+	var raw interface{}
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		t.Fatalf("bad payload: %v", err)
+	}
+	answer, err := parseSubmittedAnswer(raw)
+	if err != nil {
+		t.Fatalf("parseSubmittedAnswer: %v", err)
+	}
+	return answer
+}
+
+func TestGradeMChoiceUsesOrderList(t *testing.T) {
+	key := answerKey{QuestionType: "m-choice", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{2}}
+	orderList := []int64{3, 2, 0, 1} // option "c" is shown second
+
+	scored, correct, err := gradeAnswer(key, orderList, submittedAnswer{Selected: []int64{1}}, 4, defaultMarkingScheme)
+	if err != nil || !correct || scored != 4 {
+		t.Fatalf("expected full marks, got %v %v %v", scored, correct, err)
+	}
+	scored, correct, _ = gradeAnswer(key, orderList, submittedAnswer{Selected: []int64{2}}, 4, defaultMarkingScheme)
+	if correct || scored != 0 {
+		t.Fatalf("unshuffled index must not be graded as correct, got %v %v", scored, correct)
+	}
+}
+
+func TestTamperedPayloadCannotRaiseScore(t *testing.T) {
+	key := answerKey{QuestionType: "m-choice", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{0}}
+	orderList := []int64{0, 1, 2, 3}
+
+	// The client claims its wrong pick is the correct one and inflates the question mark.
+	answer := decodeAnswer(t, `{"selected_answer_list":[3],"correct_options":[3],"questions_total_mark":100,"answered":true}`)
+	scored, correct, err := gradeAnswer(key, orderList, answer, 1, defaultMarkingScheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correct || scored != 0 {
+		t.Fatalf("tampered payload scored %v (correct=%v)", scored, correct)
+	}
+}
+
+func TestTamperedMSelectPayloadCannotRaiseScore(t *testing.T) {
+	key := answerKey{QuestionType: "m-select", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{0, 1}}
+	orderList := []int64{0, 1, 2, 3}
+
+	answer := decodeAnswer(t, `{"selected_answer_list":[2,3],"correct_options":[2,3],"answered":true}`)
+	scored, _, _ := gradeAnswer(key, orderList, answer, 2, defaultMarkingScheme)
+	if scored != 0 {
+		t.Fatalf("tampered m-select payload scored %v", scored)
+	}
+
+	// Repeating a correct pick must not inflate the fraction.
+	if _, _, err := gradeAnswer(key, orderList, submittedAnswer{Selected: []int64{0, 0}}, 2, defaultMarkingScheme); err == nil {
+		t.Fatal("expected repeated selection to be rejected")
+	}
+}
+
+func TestGradeMSelect(t *testing.T) {
+	key := answerKey{QuestionType: "m-select", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{0, 1}}
+	orderList := []int64{1, 3, 0, 2}
+
+	tests := []struct {
+		name     string
+		selected []int64
+		scored   float64
+		correct  bool
+	}{
+		{"all correct", []int64{0, 2}, 2, true},
+		{"partial", []int64{2}, 1, false},
+		{"one wrong", []int64{0, 1}, 0, false},
+		{"nothing", []int64{}, 0, false},
+	}
+	for _, tt := range tests {
+		scored, correct, err := gradeAnswer(key, orderList, submittedAnswer{Selected: tt.selected}, 2, defaultMarkingScheme)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if scored != tt.scored || correct != tt.correct {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, scored, correct, tt.scored, tt.correct)
+		}
+	}
+}
+
+func TestGradeNumericKeyedOption(t *testing.T) {
+	key := answerKey{QuestionType: "numeric", Options: []string{"9.8"}, CorrectOptions: []int64{0}}
+	scored, correct, err := gradeAnswer(key, []int64{0}, submittedAnswer{Selected: []int64{0}}, 1, defaultMarkingScheme)
+	if err != nil || !correct || scored != 1 {
+		t.Fatalf("expected full marks, got %v %v %v", scored, correct, err)
+	}
+}
+
+func TestOutOfRangeSelectionIsRejected(t *testing.T) {
+	key := answerKey{QuestionType: "m-choice", Options: []string{"a", "b"}, CorrectOptions: []int64{1}}
+	if _, _, err := gradeAnswer(key, []int64{1, 0}, submittedAnswer{Selected: []int64{5}}, 1, defaultMarkingScheme); err == nil {
+		t.Fatal("expected out of range selection to be rejected")
+	}
+}
+
+func TestParseSubmittedAnswerRejectsNonIntegers(t *testing.T) {
+	var raw interface{}
+	_ = json.Unmarshal([]byte(`{"selected_answer_list":[1.5]}`), &raw)
+	if _, err := parseSubmittedAnswer(raw); err == nil {
+		t.Fatal("expected fractional index to be rejected")
+	}
+}
+
+func TestGradeNumeric(t *testing.T) {
+	threeSigFigs := 3
+	tests := []struct {
+		name    string
+		key     models.NumericAnswer
+		input   string
+		correct bool
+	}{
+		{"exact", models.NumericAnswer{Value: 42, ToleranceType: "absolute"}, "42", true},
+		{"within absolute tolerance", models.NumericAnswer{Value: 9.81, Tolerance: 0.05, ToleranceType: "absolute"}, "9.78", true},
+		{"outside absolute tolerance", models.NumericAnswer{Value: 9.81, Tolerance: 0.05, ToleranceType: "absolute"}, "9.7", false},
+		{"within relative tolerance", models.NumericAnswer{Value: 1000, Tolerance: 0.01, ToleranceType: "relative"}, "1009", true},
+		{"outside relative tolerance", models.NumericAnswer{Value: 1000, Tolerance: 0.01, ToleranceType: "relative"}, "1011", false},
+		{"scientific notation", models.NumericAnswer{Value: 6.02e23, Tolerance: 0.001, ToleranceType: "relative"}, "6.022e23", true},
+		{"converted unit", models.NumericAnswer{Value: 1.5, ToleranceType: "absolute", Units: []models.NumericUnit{{Unit: "m", Factor: 1}, {Unit: "cm", Factor: 0.01}}}, "150 cm", true},
+		{"unknown unit", models.NumericAnswer{Value: 1.5, ToleranceType: "absolute", Units: []models.NumericUnit{{Unit: "m", Factor: 1}}}, "1.5 kg", false},
+		{"missing required unit", models.NumericAnswer{Value: 1.5, ToleranceType: "absolute", Units: []models.NumericUnit{{Unit: "m", Factor: 1}}, UnitRequired: true}, "1.5", false},
+		{"right sig figs", models.NumericAnswer{Value: 9.8, Tolerance: 0.01, ToleranceType: "absolute", SigFigs: &threeSigFigs}, "9.80", true},
+		{"wrong sig figs", models.NumericAnswer{Value: 9.8, Tolerance: 0.01, ToleranceType: "absolute", SigFigs: &threeSigFigs}, "9.8", false},
+		{"not a number", models.NumericAnswer{Value: 1, ToleranceType: "absolute"}, "one", false},
+	}
+	for _, tt := range tests {
+		key := answerKey{QuestionType: "numeric", Options: []string{}, Numeric: &tt.key}
+		input := tt.input
+		_, correct, err := gradeAnswer(key, []int64{}, submittedAnswer{NumericAnswer: &input, Answered: true}, 1, defaultMarkingScheme)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if correct != tt.correct {
+			t.Errorf("%s: got %v, want %v", tt.name, correct, tt.correct)
+		}
+	}
+}
+
+func TestCountSigFigs(t *testing.T) {
+	for input, want := range map[string]int{"9.80": 3, "0.0045": 2, "1200": 2, "1200.": 4, "-3.0e8": 2} {
+		if got := countSigFigs(input); got != want {
+			t.Errorf("countSigFigs(%q) = %d, want %d", input, got, want)
+		}
+	}
+}
+
+func TestMarkingSchemes(t *testing.T) {
+	mSelect := answerKey{QuestionType: "m-select", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{0, 1, 2}}
+	mChoice := answerKey{QuestionType: "m-choice", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{0}}
+	orderList := []int64{0, 1, 2, 3}
+
+	tests := []struct {
+		name     string
+		key      answerKey
+		scheme   markingScheme
+		selected []int64
+		scored   float64
+	}{
+		{"all-or-nothing full", mSelect, markingScheme{MSelectPolicy: "all-or-nothing"}, []int64{0, 1, 2}, 3},
+		{"all-or-nothing partial", mSelect, markingScheme{MSelectPolicy: "all-or-nothing"}, []int64{0, 1}, 0},
+		{"all-or-nothing partial with negative", mSelect, markingScheme{MSelectPolicy: "all-or-nothing", NegativeMarkRatio: 0.5}, []int64{0, 1}, -1.5},
+		{"proportional partial", mSelect, markingScheme{MSelectPolicy: "proportional"}, []int64{0, 1}, 2},
+		{"proportional with wrong pick", mSelect, markingScheme{MSelectPolicy: "proportional", NegativeMarkRatio: 1.0 / 3}, []int64{0, 3}, -1},
+		{"per-option", mSelect, markingScheme{MSelectPolicy: "per-option"}, []int64{0, 1, 3}, 1},
+		{"per-option wrong pick", mSelect, markingScheme{MSelectPolicy: "per-option"}, []int64{3}, -1},
+		{"m-choice negative", mChoice, markingScheme{MSelectPolicy: "proportional", NegativeMarkRatio: 0.25}, []int64{2}, -1},
+		{"unanswered is not penalised while grading", mChoice, markingScheme{MSelectPolicy: "proportional", NegativeMarkRatio: 0.25}, []int64{}, 0},
+	}
+	for _, tt := range tests {
+		mark := 3.0
+		if tt.key.QuestionType == "m-choice" {
+			mark = 4
+		}
+		scored, _, err := gradeAnswer(tt.key, orderList, submittedAnswer{Selected: tt.selected}, mark, tt.scheme)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if math.Abs(scored-tt.scored) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", tt.name, scored, tt.scored)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"log"
+	"sort"
+	"time"
+)
+
+// Question sets with at least itemAnalysisLiveLimit finished sessions are analysed in the
+// background and served from question_set_item_analysis; smaller sets are analysed on request.
+const (
+	itemAnalysisLiveLimit             = 500
+	defaultItemAnalysisRefreshMinutes = 60
+	itemAnalysisAdvisoryLock          = 7001
+	restScoreSQL                      = `CASE WHEN ts.total_marks - tsqa.questions_total_mark > 0
+	    THEN (ts.scored_marks - tsqa.questions_scored_mark) / (ts.total_marks - tsqa.questions_total_mark) * 100
+	    ELSE 0 END`
+)
+
+func GetQuestionAnalytics(c *fiber.Ctx) error {
+	questionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question ID"})
+	}
+	user := c.Locals("user").(models.User)
+
+	role, err := questionCollaboration.role(util.DB, user, questionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question"})
+	}
+	if role == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the question's author, its collaborators or an admin can view its analytics"})
+	}
+
+	responses, err := loadItemResponses(`tsqa.question_id = $1`, questionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load responses: " + err.Error()})
+	}
+	keys, err := loadAnswerKeys([]int{questionID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load answer key: " + err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":   "success",
+		"analysis": analyzeItem(questionID, keys[questionID], responses[questionID]),
+	})
+}
+
+func GetQuestionSetAnalytics(c *fiber.Ctx) error {
+	questionSetID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question set ID"})
+	}
+	user := c.Locals("user").(models.User)
+
+	var createdByID, finishedSessions int
+	var sharedRole *string
+	err = util.DB.QueryRow(`
+		SELECT qs.created_by_id,
+		       (SELECT COUNT(*) FROM test_sessions ts WHERE ts.question_set_id = qs.id AND ts.finished AND ts.selection_mode = 'fixed'),
+		       (SELECT role FROM user_questionsets_editors e WHERE e.question_set_id = qs.id AND e.user_id = $2 AND e.status = 'accepted')
+		FROM question_sets qs
+		WHERE qs.id = $1 AND qs.deleted <> true`, questionSetID, user.ID).Scan(&createdByID, &finishedSessions, &sharedRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question set not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set"})
+	}
+	if collaboratorRole(createdByID, user, sharedRole) == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the set's author, its collaborators or an admin can view its analytics"})
+	}
+
+	if finishedSessions >= itemAnalysisLiveLimit {
+		var analysisJSON []byte
+		var computedAt time.Time
+		err = util.DB.QueryRow(`
+			SELECT analysis, computed_at FROM question_set_item_analysis WHERE question_set_id = $1`,
+			questionSetID).Scan(&analysisJSON, &computedAt)
+		if err == nil {
+			return c.JSON(fiber.Map{
+				"status":            "success",
+				"finished_sessions": finishedSessions,
+				"computed_at":       computedAt,
+				"questions":         json.RawMessage(analysisJSON),
+			})
+		}
+		if err != sql.ErrNoRows {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load item analysis"})
+		}
+	}
+
+	analysis, err := analyzeQuestionSet(questionSetID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to analyse question set: " + err.Error()})
+	}
+	computedAt := time.Now().UTC()
+	if finishedSessions >= itemAnalysisLiveLimit {
+		// First request for a large set: keep the result for the next readers.
+		if err := storeQuestionSetAnalysis(util.DB, questionSetID, analysis, finishedSessions, computedAt); err != nil {
+			log.Println("item analysis: failed to cache question set", questionSetID, err)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"status":            "success",
+		"finished_sessions": finishedSessions,
+		"computed_at":       computedAt,
+		"questions":         analysis,
+	})
+}
+
+// analyzeQuestionSet runs item analysis for every question currently in a set, over the
+// finished sessions of that set.
+func analyzeQuestionSet(questionSetID int) ([]itemAnalysis, error) {
+	var questionIDs []int
+	rows, err := util.DB.Query(`SELECT question_id FROM question_set_questions WHERE question_set_id = $1`, questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var qid int
+		if err := rows.Scan(&qid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		questionIDs = append(questionIDs, qid)
+	}
+	rows.Close()
+	sort.Ints(questionIDs)
+
+	responses, err := loadItemResponses(`ts.question_set_id = $1`, questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := loadAnswerKeys(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	analysis := make([]itemAnalysis, 0, len(questionIDs))
+	for _, qid := range questionIDs {
+		analysis = append(analysis, analyzeItem(qid, keys[qid], responses[qid]))
+	}
+	return analysis, nil
+}
+
+// loadItemResponses reads the answers of finished sessions matching where, grouped by question.
+// Adaptive sessions pick questions by ability, so their answers would skew the statistics.
+func loadItemResponses(where string, arg interface{}) (map[int][]itemResponse, error) {
+	rows, err := util.DB.Query(`
+		SELECT tsqa.question_id, tsqa.selected_answer_list, tsqa.order_list, tsqa.numeric_answer,
+		       tsqa.answered, `+restScoreSQL+`
+		FROM test_session_question_answers tsqa
+		JOIN test_sessions ts ON ts.id = tsqa.test_session_id
+		WHERE ts.finished AND ts.selection_mode = 'fixed' AND `+where, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	responses := make(map[int][]itemResponse)
+	for rows.Next() {
+		var qid int
+		var r itemResponse
+		var selected, orderList pq.Int64Array
+		if err := rows.Scan(&qid, &selected, &orderList, &r.NumericAnswer, &r.Answered, &r.RestScore); err != nil {
+			return nil, err
+		}
+		r.Selected, r.OrderList = selected, orderList
+		responses[qid] = append(responses[qid], r)
+	}
+	return responses, rows.Err()
+}
+
+// loadAnswerKeys reads the current answer keys of the given questions.
+func loadAnswerKeys(questionIDs []int) (map[int]answerKey, error) {
+	rows, err := util.DB.Query(`
+		SELECT id, question_type, options, correct_options, numeric_answer
+		FROM questions
+		WHERE id = ANY($1)`, pq.Array(questionIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[int]answerKey)
+	for rows.Next() {
+		var qid int
+		var key answerKey
+		var correctOptions pq.Int64Array
+		var numericJSON []byte
+		if err := rows.Scan(&qid, &key.QuestionType, pq.Array(&key.Options), &correctOptions, &numericJSON); err != nil {
+			return nil, err
+		}
+		key.CorrectOptions = correctOptions
+		if key.Numeric, err = parseNumericAnswerJSON(numericJSON); err != nil {
+			return nil, err
+		}
+		keys[qid] = key
+	}
+	return keys, rows.Err()
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func storeQuestionSetAnalysis(db sqlExecer, questionSetID int, analysis []itemAnalysis, finishedSessions int, computedAt time.Time) error {
+	analysisJSON, err := json.Marshal(analysis)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO question_set_item_analysis (question_set_id, finished_sessions, computed_at, analysis)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (question_set_id) DO UPDATE
+		SET finished_sessions = EXCLUDED.finished_sessions,
+		    computed_at = EXCLUDED.computed_at,
+		    analysis = EXCLUDED.analysis`,
+		questionSetID, finishedSessions, computedAt, string(analysisJSON))
+	return err
+}
+
+// StartItemAnalysisRefresher keeps the stored analysis of large question sets up to date.
+// A transaction-level advisory lock makes sure only one server instance refreshes at a time.
+func StartItemAnalysisRefresher() {
+	interval := time.Duration(envInt("ITEM_ANALYSIS_REFRESH_MINUTES", defaultItemAnalysisRefreshMinutes)) * time.Minute
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := refreshItemAnalysis(); err != nil {
+				log.Println("item analysis refresher:", err)
+			}
+		}
+	}()
+}
+
+func refreshItemAnalysis() error {
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, itemAnalysisAdvisoryLock).Scan(&locked); err != nil || !locked {
+		return err
+	}
+
+	// Large sets whose stored analysis is missing or older than their latest finished session
+	rows, err := tx.Query(`
+		SELECT ts.question_set_id, COUNT(*)
+		FROM test_sessions ts
+		LEFT JOIN question_set_item_analysis a ON a.question_set_id = ts.question_set_id
+		WHERE ts.finished AND ts.selection_mode = 'fixed' AND ts.question_set_id IS NOT NULL
+		GROUP BY ts.question_set_id, a.computed_at
+		HAVING COUNT(*) >= $1 AND (a.computed_at IS NULL OR MAX(ts.finished_time) > a.computed_at)`,
+		itemAnalysisLiveLimit)
+	if err != nil {
+		return err
+	}
+	stale := make(map[int]int)
+	for rows.Next() {
+		var setID, n int
+		if err := rows.Scan(&setID, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		stale[setID] = n
+	}
+	rows.Close()
+
+	for setID, n := range stale {
+		computedAt := time.Now().UTC()
+		analysis, err := analyzeQuestionSet(setID)
+		if err != nil {
+			return err
+		}
+		if err := storeQuestionSetAnalysis(tx, setID, analysis, n, computedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
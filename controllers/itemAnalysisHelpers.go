@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"math"
+)
+
+// Item analysis looks at how a question performed across finished test sessions.
+// Flags are only raised once a question has itemAnalysisMinResponses answers; below that
+// the numbers are reported but too noisy to judge by.
+const (
+	itemAnalysisMinResponses = 20
+	lowPValueThreshold       = 0.2
+)
+
+// itemResponse is one learner's answer to a question, taken from test_session_question_answers.
+// RestScore is the learner's session percentage without this question, so the item doesn't
+// correlate with itself.
+type itemResponse struct {
+	Selected      []int64 // displayed indices
+	OrderList     []int64
+	NumericAnswer *string
+	Answered      bool
+	RestScore     float64
+}
+
+// optionAnalysis is how often an original option (un-shuffled) was picked and how well the
+// learners who picked it did on the rest of the test.
+type optionAnalysis struct {
+	Index         int      `json:"index"`
+	Option        string   `json:"option"`
+	Keyed         bool     `json:"keyed"`
+	Picks         int      `json:"picks"`
+	PickRate      float64  `json:"pick_rate"`
+	MeanRestScore *float64 `json:"mean_rest_score"`
+}
+
+type itemAnalysis struct {
+	QuestionID      int              `json:"question_id"`
+	Responses       int              `json:"responses"`
+	Omitted         int              `json:"omitted"`
+	PValue          *float64         `json:"p_value"`
+	PointBiserial   *float64         `json:"point_biserial"`
+	Options         []optionAnalysis `json:"options"`
+	Flags           []string         `json:"flags"`
+	EnoughResponses bool             `json:"enough_responses"`
+}
+
+// analyzeItem computes the difficulty index (p-value), point-biserial discrimination and
+// distractor counts of one question. Correctness is re-derived from the current answer key,
+// so a fixed key is reflected immediately.
+func analyzeItem(questionID int, key answerKey, responses []itemResponse) itemAnalysis {
+	result := itemAnalysis{QuestionID: questionID, Flags: []string{}}
+
+	keyed := make(map[int64]bool)
+	for _, c := range key.CorrectOptions {
+		keyed[c] = true
+	}
+	hasOptions := !(key.QuestionType == "numeric" && key.Numeric != nil)
+	picks := make([]int, len(key.Options))
+	pickRest := make([]float64, len(key.Options))
+
+	var correctness, restScores []float64
+	for _, r := range responses {
+		if !r.Answered {
+			result.Omitted++
+			continue
+		}
+		_, correct, err := gradeAnswer(key, r.OrderList, submittedAnswer{Selected: r.Selected, NumericAnswer: r.NumericAnswer, Answered: true}, 1, defaultMarkingScheme)
+		if err != nil {
+			continue
+		}
+		result.Responses++
+		if correct {
+			correctness = append(correctness, 1)
+		} else {
+			correctness = append(correctness, 0)
+		}
+		restScores = append(restScores, r.RestScore)
+
+		if hasOptions {
+			original, _ := toOriginalIndices(r.OrderList, r.Selected)
+			for _, o := range original {
+				if o >= 0 && int(o) < len(picks) {
+					picks[o]++
+					pickRest[o] += r.RestScore
+				}
+			}
+		}
+	}
+
+	if result.Responses > 0 {
+		p := mean(correctness)
+		result.PValue = &p
+		if r, ok := pearson(correctness, restScores); ok {
+			result.PointBiserial = &r
+		}
+	}
+
+	if hasOptions {
+		for i, option := range key.Options {
+			oa := optionAnalysis{Index: i, Option: option, Keyed: keyed[int64(i)], Picks: picks[i]}
+			if result.Responses > 0 {
+				oa.PickRate = float64(picks[i]) / float64(result.Responses)
+			}
+			if picks[i] > 0 {
+				m := pickRest[i] / float64(picks[i])
+				oa.MeanRestScore = &m
+			}
+			result.Options = append(result.Options, oa)
+		}
+	}
+
+	result.EnoughResponses = result.Responses >= itemAnalysisMinResponses
+	if result.EnoughResponses {
+		result.Flags = misKeyFlags(result)
+	}
+	return result
+}
+
+// misKeyFlags lists the signs that a question's answer key may be wrong.
+func misKeyFlags(a itemAnalysis) []string {
+	flags := []string{}
+	if a.PointBiserial != nil && *a.PointBiserial < 0 {
+		flags = append(flags, "negative_discrimination")
+	}
+	if a.PValue != nil && *a.PValue < lowPValueThreshold {
+		flags = append(flags, "very_low_p_value")
+	}
+
+	// A distractor that is picked more than every keyed option, by learners who do better on
+	// the rest of the test, usually means the key points at the wrong option.
+	var bestKeyedPicks int
+	var bestKeyedRest float64
+	for _, o := range a.Options {
+		if o.Keyed && o.Picks >= bestKeyedPicks {
+			bestKeyedPicks = o.Picks
+			if o.MeanRestScore != nil {
+				bestKeyedRest = *o.MeanRestScore
+			}
+		}
+	}
+	for _, o := range a.Options {
+		if !o.Keyed && o.Picks > bestKeyedPicks && o.MeanRestScore != nil && *o.MeanRestScore > bestKeyedRest {
+			flags = append(flags, "distractor_outperforms_key")
+			break
+		}
+	}
+	return flags
+}
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// pearson returns the correlation of xs and ys; ok is false when either has no variance.
+// With a 0/1 xs this is the point-biserial correlation.
+func pearson(xs, ys []float64) (float64, bool) {
+	if len(xs) != len(ys) || len(xs) < 2 {
+		return 0, false
+	}
+	mx, my := mean(xs), mean(ys)
+	var sxy, sxx, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
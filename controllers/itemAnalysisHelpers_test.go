@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAnalyzeItemCountsOriginalOptions(t *testing.T) {
+	key := answerKey{QuestionType: "m-choice", Options: []string{"a", "b", "c"}, CorrectOptions: []int64{0}}
+	responses := []itemResponse{
+		// "a" was shown last, so displayed index 2 is the keyed option.
+		{Selected: []int64{2}, OrderList: []int64{1, 2, 0}, Answered: true, RestScore: 90},
+		{Selected: []int64{0}, OrderList: []int64{0, 1, 2}, Answered: true, RestScore: 80},
+		{Selected: []int64{0}, OrderList: []int64{1, 2, 0}, Answered: true, RestScore: 30},
+		{Answered: false, RestScore: 10},
+	}
+	a := analyzeItem(1, key, responses)
+
+	if a.Responses != 3 || a.Omitted != 1 {
+		t.Fatalf("unexpected counts %+v", a)
+	}
+	if a.PValue == nil || *a.PValue < 0.66 || *a.PValue > 0.67 {
+		t.Fatalf("unexpected p-value %v", a.PValue)
+	}
+	picks := []int{a.Options[0].Picks, a.Options[1].Picks, a.Options[2].Picks}
+	if !slices.Equal(picks, []int{2, 1, 0}) {
+		t.Fatalf("unexpected option picks %v", picks)
+	}
+	if a.PointBiserial == nil || *a.PointBiserial <= 0 {
+		t.Fatalf("expected positive discrimination, got %v", a.PointBiserial)
+	}
+	if len(a.Flags) != 0 || a.EnoughResponses {
+		t.Fatal("no flags should be raised below the minimum number of responses")
+	}
+}
+
+func TestAnalyzeItemFlagsMisKeyedQuestion(t *testing.T) {
+	// Strong learners pick "b" while the key says "a".
+	key := answerKey{QuestionType: "m-choice", Options: []string{"a", "b", "c", "d"}, CorrectOptions: []int64{0}}
+	identity := []int64{0, 1, 2, 3}
+	var responses []itemResponse
+	for i := 0; i < 20; i++ {
+		responses = append(responses, itemResponse{Selected: []int64{1}, OrderList: identity, Answered: true, RestScore: 70 + float64(i)})
+	}
+	for i := 0; i < 4; i++ {
+		responses = append(responses, itemResponse{Selected: []int64{0}, OrderList: identity, Answered: true, RestScore: 20 + float64(i)})
+	}
+	a := analyzeItem(1, key, responses)
+
+	for _, flag := range []string{"negative_discrimination", "very_low_p_value", "distractor_outperforms_key"} {
+		if !slices.Contains(a.Flags, flag) {
+			t.Errorf("expected flag %s, got %v", flag, a.Flags)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// mentorConnectionSQL matches the accepted mentor-mentee connection between mentor $1 and mentee $2.
+const mentorConnectionSQL = `
+	SELECT 1 FROM user_connections uc
+	WHERE uc.connection_type = 'mentor-mentee' AND uc.status = 'accepted' AND uc.mentor_id = $1
+	  AND ((uc.requester_id = $1 AND uc.target_id = $2) OR (uc.requester_id = $2 AND uc.target_id = $1))`
+
+// mentorVisibleSessionSQL restricts test_sessions ts to the finished sessions of mentee $2 that
+// mentor $1 may see: all of them once the mentee granted activity access on the connection,
+// otherwise only the ones shared one by one.
+const mentorVisibleSessionSQL = `
+	ts.taken_by_id = $2 AND ts.finished AND EXISTS (` + mentorConnectionSQL + `
+	  AND (COALESCE(uc.mentee_activity_access, false) OR EXISTS (
+	      SELECT 1 FROM shared_mentee_activity sma
+	      WHERE sma.mentor_id = $1 AND sma.mentee_id = $2 AND sma.test_session_id = ts.id
+	  ))
+	)`
+
+// canViewTestSession decides who may read a session: the learner who took it, and mentors the
+// learner shared it with once it is finished.
+func canViewTestSession(viewerID int, testSessionID string, takenByID int) (bool, error) {
+	if viewerID == takenByID {
+		return true, nil
+	}
+	var visible bool
+	err := util.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM test_sessions ts WHERE ts.id = $3 AND `+mentorVisibleSessionSQL+`)`,
+		viewerID, takenByID, testSessionID).Scan(&visible)
+	return visible, err
+}
+
+// ShareWithMentor lets a mentee share one finished session (test_session_id) or all their activity
+// (all: true) with a mentor. UnshareWithMentor takes the same body and undoes either.
+func ShareWithMentor(c *fiber.Ctx) error {
+	return setMentorSharing(c, true)
+}
+
+func UnshareWithMentor(c *fiber.Ctx) error {
+	return setMentorSharing(c, false)
+}
+
+func setMentorSharing(c *fiber.Ctx, share bool) error {
+	user := c.Locals("user").(models.User)
+	var input struct {
+		MentorID      int     `json:"mentor_id"`
+		TestSessionID *string `json:"test_session_id"`
+		All           bool    `json:"all"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.All == (input.TestSessionID != nil) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Send either test_session_id or all"})
+	}
+
+	var connected bool
+	if err := util.DB.QueryRow(`SELECT EXISTS (`+mentorConnectionSQL+`)`, input.MentorID, user.ID).Scan(&connected); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check connection"})
+	}
+	if !connected {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "This user is not your mentor"})
+	}
+
+	if input.All {
+		_, err := util.DB.Exec(`
+			UPDATE user_connections
+			SET mentee_activity_access = $3, updated_at = $4
+			WHERE connection_type = 'mentor-mentee' AND status = 'accepted' AND mentor_id = $1
+			  AND ((requester_id = $1 AND target_id = $2) OR (requester_id = $2 AND target_id = $1))`,
+			input.MentorID, user.ID, share, time.Now().UTC())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update access"})
+		}
+		if !share {
+			if _, err := util.DB.Exec(`DELETE FROM shared_mentee_activity WHERE mentor_id = $1 AND mentee_id = $2`,
+				input.MentorID, user.ID); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update access"})
+			}
+		}
+		return c.JSON(fiber.Map{"status": "success", "mentee_activity_access": share})
+	}
+
+	if !share {
+		if _, err := util.DB.Exec(`
+			DELETE FROM shared_mentee_activity
+			WHERE mentor_id = $1 AND mentee_id = $2 AND test_session_id = $3`,
+			input.MentorID, user.ID, *input.TestSessionID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unshare session"})
+		}
+		return c.JSON(fiber.Map{"status": "success", "message": "Session unshared"})
+	}
+
+	var takenByID int
+	var finished bool
+	err := util.DB.QueryRow(`SELECT taken_by_id, finished FROM test_sessions WHERE id = $1`, *input.TestSessionID).
+		Scan(&takenByID, &finished)
+	if err != nil || takenByID != user.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Test session not found"})
+	}
+	if !finished {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only finished sessions can be shared"})
+	}
+	if _, err := util.DB.Exec(`
+		INSERT INTO shared_mentee_activity (mentor_id, mentee_id, test_session_id, shared_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`, input.MentorID, user.ID, *input.TestSessionID, time.Now().UTC()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to share session"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Session shared"})
+}
+
+// GetMentees lists the current user's mentees with how much of their activity is shared.
+func GetMentees(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	rows, err := util.DB.Query(`
+		SELECT u.id, u.name, u.profile_pic, COALESCE(uc.mentee_activity_access, false),
+		       (SELECT COUNT(*) FROM shared_mentee_activity sma WHERE sma.mentor_id = $1 AND sma.mentee_id = u.id),
+		       (SELECT MAX(ts.finished_time) FROM test_sessions ts
+		        WHERE ts.taken_by_id = u.id AND ts.finished
+		          AND (COALESCE(uc.mentee_activity_access, false) OR EXISTS (
+		              SELECT 1 FROM shared_mentee_activity sma
+		              WHERE sma.mentor_id = $1 AND sma.mentee_id = u.id AND sma.test_session_id = ts.id
+		          )))
+		FROM user_connections uc
+		JOIN users u ON u.id = CASE WHEN uc.requester_id = $1 THEN uc.target_id ELSE uc.requester_id END
+		WHERE uc.connection_type = 'mentor-mentee' AND uc.status = 'accepted' AND uc.mentor_id = $1
+		  AND u.deleted = false
+		ORDER BY u.name`, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch mentees " + err.Error()})
+	}
+	defer rows.Close()
+
+	mentees := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, sharedSessions int
+			name               string
+			profilePic         *string
+			fullAccess         bool
+			lastActivity       *time.Time
+		)
+		if err := rows.Scan(&id, &name, &profilePic, &fullAccess, &sharedSessions, &lastActivity); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read mentee"})
+		}
+		mentees = append(mentees, map[string]interface{}{
+			"id":                     id,
+			"name":                   name,
+			"profile_pic":            profilePic,
+			"mentee_activity_access": fullAccess,
+			"shared_sessions":        sharedSessions,
+			"last_shared_activity":   lastActivity,
+		})
+	}
+	return c.JSON(fiber.Map{"status": "success", "mentees": mentees})
+}
+
+// GetMenteeActivity is the mentor's view of one mentee: the finished sessions they may see, the
+// score trend across them and the subjects the mentee does worst in. Per-question review of a
+// session goes through GetTestSession, which applies the same rules.
+func GetMenteeActivity(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	menteeID, err := c.ParamsInt("mentee_id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid mentee ID"})
+	}
+	var connected bool
+	if err := util.DB.QueryRow(`SELECT EXISTS (`+mentorConnectionSQL+`)`, user.ID, menteeID).Scan(&connected); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check connection"})
+	}
+	if !connected {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not this user's mentor"})
+	}
+
+	rows, err := util.DB.Query(`
+		SELECT ts.id, ts.name, COALESCE(ts.source_type, 'question_set'), ts.finished_time,
+		       COALESCE(ts.total_marks, 0), COALESCE(ts.scored_marks, 0), ts.rank
+		FROM test_sessions ts
+		WHERE `+mentorVisibleSessionSQL+`
+		ORDER BY ts.finished_time DESC
+		LIMIT 100`, user.ID, menteeID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions " + err.Error()})
+	}
+	sessions := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, name, sourceType    string
+			finishedTime            sql.NullTime
+			totalMarks, scoredMarks float64
+			rank                    *int
+		)
+		if err := rows.Scan(&id, &name, &sourceType, &finishedTime, &totalMarks, &scoredMarks, &rank); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read session"})
+		}
+		percentage := 0.0
+		if totalMarks > 0 {
+			percentage = scoredMarks / totalMarks * 100
+		}
+		sessions = append(sessions, map[string]interface{}{
+			"id":            id,
+			"name":          name,
+			"source_type":   sourceType,
+			"finished_time": finishedTime.Time,
+			"total_marks":   totalMarks,
+			"scored_marks":  scoredMarks,
+			"percentage":    percentage,
+			"rank":          rank,
+		})
+	}
+	rows.Close()
+	// Sessions come newest first; the trend runs oldest to newest.
+	trend := make([]map[string]interface{}, 0, len(sessions))
+	for i := len(sessions) - 1; i >= 0; i-- {
+		trend = append(trend, map[string]interface{}{
+			"finished_time": sessions[i]["finished_time"],
+			"percentage":    sessions[i]["percentage"],
+		})
+	}
+
+	rows, err = util.DB.Query(`
+		SELECT q.subject, COUNT(*),
+		       COUNT(*) FILTER (WHERE tsqa.answered AND tsqa.questions_scored_mark > 0)
+		FROM test_sessions ts
+		JOIN test_session_question_answers tsqa ON tsqa.test_session_id = ts.id
+		JOIN questions q ON q.id = tsqa.question_id
+		WHERE `+mentorVisibleSessionSQL+`
+		GROUP BY q.subject
+		HAVING COUNT(*) >= 5
+		ORDER BY COUNT(*) FILTER (WHERE tsqa.answered AND tsqa.questions_scored_mark > 0)::float / COUNT(*), q.subject
+		LIMIT 5`, user.ID, menteeID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch subjects " + err.Error()})
+	}
+	defer rows.Close()
+	weakSubjects := []map[string]interface{}{}
+	for rows.Next() {
+		var subject string
+		var attempted, correct int
+		if err := rows.Scan(&subject, &attempted, &correct); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read subject"})
+		}
+		weakSubjects = append(weakSubjects, map[string]interface{}{
+			"subject":   subject,
+			"attempted": attempted,
+			"correct":   correct,
+			"accuracy":  float64(correct) / float64(attempted) * 100,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":        "success",
+		"mentee_id":     menteeID,
+		"sessions":      sessions,
+		"score_trend":   trend,
+		"weak_subjects": weakSubjects,
+	})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"os"
+	"testing"
+)
+
+func TestCanViewOwnTestSession(t *testing.T) {
+	// The learner's own view never reaches the database.
+	visible, err := canViewTestSession(2, "any", 2)
+	if err != nil || !visible {
+		t.Fatalf("got (%v, %v), want the owner to see their session", visible, err)
+	}
+}
+
+// TestMentorVisibleSessionSQL runs the mentor checks against a Postgres database given in
+// TEST_DATABASE_URL. The tables are created as temporary ones, so nothing is left behind.
+func TestMentorVisibleSessionSQL(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Temporary tables only exist on the connection that made them.
+	db.SetMaxOpenConns(1)
+
+	setup := []string{
+		`CREATE TEMP TABLE test_sessions (id TEXT PRIMARY KEY, taken_by_id INT, finished BOOLEAN)`,
+		`CREATE TEMP TABLE user_connections (
+			requester_id INT, target_id INT, connection_type TEXT, status TEXT,
+			mentor_id INT, mentee_activity_access BOOLEAN)`,
+		`CREATE TEMP TABLE shared_mentee_activity (mentor_id INT, mentee_id INT, test_session_id TEXT)`,
+		// Mentee 2 has mentor 1, a pending request from mentor 3, and a connection with 4 where 2 is the mentor.
+		`INSERT INTO user_connections VALUES
+			(2, 1, 'mentor-mentee', 'accepted', 1, false),
+			(2, 3, 'mentor-mentee', 'pending', 3, false),
+			(4, 2, 'mentor-mentee', 'accepted', 2, false)`,
+		`INSERT INTO test_sessions VALUES ('shared', 2, true), ('unshared', 2, true), ('running', 2, false)`,
+		`INSERT INTO shared_mentee_activity VALUES
+			(1, 2, 'shared'), (1, 2, 'running'), (3, 2, 'shared'), (4, 2, 'shared')`,
+	}
+	for _, stmt := range setup {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := util.DB
+	util.DB = db
+	defer func() { util.DB = saved }()
+
+	cases := []struct {
+		name      string
+		viewerID  int
+		sessionID string
+		want      bool
+	}{
+		{"shared with the mentor", 1, "shared", true},
+		{"unfinished session", 1, "running", false},
+		{"unshared session", 1, "unshared", false},
+		{"pending connection", 3, "shared", false},
+		{"wrong mentor on the connection", 4, "shared", false},
+	}
+	for _, tc := range cases {
+		visible, err := canViewTestSession(tc.viewerID, tc.sessionID, 2)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if visible != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, visible, tc.want)
+		}
+	}
+
+	// Granting activity access opens every finished session, but still not the running one.
+	if _, err := db.Exec(`UPDATE user_connections SET mentee_activity_access = true WHERE mentor_id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	for sessionID, want := range map[string]bool{"unshared": true, "running": false} {
+		if visible, err := canViewTestSession(1, sessionID, 2); err != nil || visible != want {
+			t.Errorf("with activity access, %s: got (%v, %v), want %v", sessionID, visible, err, want)
+		}
+	}
+}
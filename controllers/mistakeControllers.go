@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+// Every question a learner gets wrong or skips in a finished session lands in their mistake
+// notebook. It graduates out after MISTAKES_GRADUATION_STREAK correct answers in a row, as
+// recorded in user_daily_questions, and comes back the next time it is missed.
+const defaultMistakeGraduationStreak = 3
+
+// collectMistakes adds the wrong and, unless skipped answers are to be ignored, unanswered
+// questions of a finished session to its learner's notebook.
+func collectMistakes(tx *sql.Tx, testSessionID string, includeSkipped bool, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_mistakes (user_id, question_id, first_session_id, last_session_id, question_set_id,
+		                           times_wrong, times_skipped, added_at, last_missed_at)
+		SELECT ts.taken_by_id, tsqa.question_id, ts.id, ts.id, ts.question_set_id,
+		       CASE WHEN tsqa.answered THEN 1 ELSE 0 END, CASE WHEN tsqa.answered THEN 0 ELSE 1 END, $2, $2
+		FROM test_session_question_answers tsqa
+		JOIN test_sessions ts ON ts.id = tsqa.test_session_id
+		WHERE tsqa.test_session_id = $1
+		  AND ((tsqa.answered AND tsqa.questions_scored_mark <= 0) OR (NOT tsqa.answered AND $3))
+		ON CONFLICT (user_id, question_id) DO UPDATE
+		SET last_session_id = EXCLUDED.last_session_id,
+		    question_set_id = EXCLUDED.question_set_id,
+		    times_wrong = user_mistakes.times_wrong + EXCLUDED.times_wrong,
+		    times_skipped = user_mistakes.times_skipped + EXCLUDED.times_skipped,
+		    last_missed_at = EXCLUDED.last_missed_at,
+		    correct_streak = 0,
+		    graduated_at = NULL`, testSessionID, now.UTC(), includeSkipped)
+	return err
+}
+
+// updateMistakeStreak recounts a notebook question's run of correct answers from
+// user_daily_questions and graduates it once the run is long enough.
+func updateMistakeStreak(tx *sql.Tx, userID, questionID int, now time.Time) error {
+	_, err := tx.Exec(`
+		UPDATE user_mistakes m
+		SET correct_streak = s.streak,
+		    graduated_at = CASE WHEN s.streak >= $3 THEN $4 ELSE NULL END
+		FROM (
+		    SELECT COUNT(*) AS streak
+		    FROM user_daily_questions udq
+		    WHERE udq.user_id = $1 AND udq.question_id = $2 AND udq.answered_correct
+		      AND udq.answered_at > COALESCE((
+		          SELECT MAX(answered_at) FROM user_daily_questions
+		          WHERE user_id = $1 AND question_id = $2 AND NOT answered_correct
+		      ), '-infinity'::timestamp)
+		) s
+		WHERE m.user_id = $1 AND m.question_id = $2 AND m.graduated_at IS NULL`,
+		userID, questionID, envInt("MISTAKES_GRADUATION_STREAK", defaultMistakeGraduationStreak), now.UTC())
+	return err
+}
+
+// mistakeFilter builds the WHERE clause shared by the notebook listing and its re-test sessions
+// from the subject, tag, question_set_id, from/to (YYYY-MM-DD, on the last miss) and
+// include_graduated query parameters.
+func mistakeFilter(c *fiber.Ctx, userID int) (string, []interface{}, error) {
+	where := "m.user_id = $1 AND q.deleted <> true"
+	args := []interface{}{userID}
+	if !c.QueryBool("include_graduated", false) {
+		where += " AND m.graduated_at IS NULL"
+	}
+	if subject := c.Query("subject"); subject != "" {
+		args = append(args, "%"+subject+"%")
+		where += fmt.Sprintf(" AND q.subject ILIKE $%d", len(args))
+	}
+	if tag := c.Query("tag"); tag != "" {
+		args = append(args, tag)
+		where += fmt.Sprintf(` AND EXISTS (
+			SELECT 1 FROM question_questiontags qqt
+			JOIN questiontags t ON t.id = qqt.questiontags_id
+			WHERE qqt.question_id = q.id AND t.name ILIKE $%d)`, len(args))
+	}
+	if setID := c.Query("question_set_id"); setID != "" {
+		id, err := strconv.Atoi(setID)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid question_set_id")
+		}
+		args = append(args, id)
+		where += fmt.Sprintf(" AND m.question_set_id = $%d", len(args))
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<="}} {
+		if v := c.Query(bound.param); v != "" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return "", nil, fmt.Errorf("%s must be a YYYY-MM-DD date", bound.param)
+			}
+			args = append(args, v)
+			where += fmt.Sprintf(" AND DATE(m.last_missed_at) %s $%d", bound.op, len(args))
+		}
+	}
+	return where, args, nil
+}
+
+func GetMistakes(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	where, args, err := mistakeFilter(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	args = append(args, limit, (page-1)*limit)
+
+	rows, err := util.DB.Query(`
+		SELECT q.id, q.question, q.question_type, q.subject, m.question_set_id, qs.name, m.last_session_id,
+		       m.times_wrong, m.times_skipped, m.correct_streak, m.added_at, m.last_missed_at, m.graduated_at
+		FROM user_mistakes m
+		JOIN questions q ON q.id = m.question_id
+		LEFT JOIN question_sets qs ON qs.id = m.question_set_id
+		WHERE `+where+fmt.Sprintf(`
+		ORDER BY m.last_missed_at DESC, q.id
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch mistakes " + err.Error()})
+	}
+	defer rows.Close()
+
+	mistakes := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, timesWrong, timesSkipped, streak int
+			question, questionType, subject      string
+			questionSetID                        *int
+			questionSetName                      *string
+			lastSessionID                        *string
+			addedAt, lastMissedAt                time.Time
+			graduatedAt                          *time.Time
+		)
+		if err := rows.Scan(&id, &question, &questionType, &subject, &questionSetID, &questionSetName, &lastSessionID,
+			&timesWrong, &timesSkipped, &streak, &addedAt, &lastMissedAt, &graduatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read mistake"})
+		}
+		mistakes = append(mistakes, map[string]interface{}{
+			"question_id":       id,
+			"question":          question,
+			"question_type":     questionType,
+			"subject":           subject,
+			"question_set_id":   questionSetID,
+			"question_set_name": questionSetName,
+			"last_session_id":   lastSessionID,
+			"times_wrong":       timesWrong,
+			"times_skipped":     timesSkipped,
+			"correct_streak":    streak,
+			"added_at":          addedAt,
+			"last_missed_at":    lastMissedAt,
+			"graduated_at":      graduatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":            "success",
+		"page":              page,
+		"limit":             limit,
+		"mistakes":          mistakes,
+		"graduation_streak": envInt("MISTAKES_GRADUATION_STREAK", defaultMistakeGraduationStreak),
+	})
+}
+
+// StartMistakeSession creates an untimed re-test from the notebook, most recent misses first,
+// honouring the same filters as GetMistakes.
+func StartMistakeSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	where, args, err := mistakeFilter(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit := c.QueryInt("limit", defaultReviewSessionLimit)
+	if limit < 1 || limit > maxReviewSessionLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+	args = append(args, limit)
+
+	rows, err := util.DB.Query(`
+		SELECT q.id, COALESCE(array_length(q.options, 1), 0), q.question_type
+		FROM user_mistakes m
+		JOIN questions q ON q.id = m.question_id
+		WHERE `+where+fmt.Sprintf(`
+		ORDER BY m.last_missed_at DESC, q.id
+		LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch mistakes " + err.Error()})
+	}
+	var questions []sessionQuestion
+	var questionIDs []int
+	for rows.Next() {
+		q := sessionQuestion{Mark: 1}
+		if err := rows.Scan(&q.ID, &q.NOptions, &q.QuestionType); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read question"})
+		}
+		questions = append(questions, q)
+		questionIDs = append(questionIDs, q.ID)
+	}
+	rows.Close()
+	if len(questions) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No mistakes match the filters"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	name := "Mistakes " + time.Now().UTC().Format("2006-01-02")
+	sessionID, err := insertTestSession(tx, newTestSession{
+		Name:       name,
+		SourceType: "mistakes",
+		UserID:     user.ID,
+		Mode:       "untimed",
+		Scheme:     defaultMarkingScheme,
+	}, questions)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create test session " + err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":       "success",
+		"test_session": sessionID,
+		"question_ids": questionIDs,
+		"question_set": name,
+	})
+}
+
+func RemoveMistake(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	questionID, err := c.ParamsInt("qid")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question ID"})
+	}
+	res, err := util.DB.Exec(`DELETE FROM user_mistakes WHERE user_id = $1 AND question_id = $2`, user.ID, questionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove mistake"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Mistake not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Mistake removed"})
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+// notifyUser queues an in-app notification. data is stored as JSON for the client to link to
+// whatever the notification is about.
+func notifyUser(tx *sql.Tx, userID int, kind, message string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, kind, message, data)
+		VALUES ($1, $2, $3, $4)`, userID, kind, message, string(payload))
+	return err
+}
+
+func GetNotifications(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	unreadOnly := c.QueryBool("unread", false)
+
+	rows, err := util.DB.Query(`
+		SELECT id, kind, message, data, created_at, read_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`, user.ID, unreadOnly, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch notifications"})
+	}
+	defer rows.Close()
+
+	notifications := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id            int
+			kind, message string
+			data          []byte
+			createdAt     time.Time
+			readAt        *time.Time
+		)
+		if err := rows.Scan(&id, &kind, &message, &data, &createdAt, &readAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read notification"})
+		}
+		notifications = append(notifications, map[string]interface{}{
+			"id":         id,
+			"kind":       kind,
+			"message":    message,
+			"data":       json.RawMessage(data),
+			"created_at": createdAt,
+			"read_at":    readAt,
+		})
+	}
+
+	var unread int
+	if err := util.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		user.ID).Scan(&unread); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count notifications"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":        "success",
+		"page":          page,
+		"limit":         limit,
+		"unread_count":  unread,
+		"notifications": notifications,
+	})
+}
+
+// MarkNotificationRead marks one notification, or all of the user's notifications when the id is "all", as read.
+func MarkNotificationRead(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if c.Params("id") == "all" {
+		if _, err := util.DB.Exec(`UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL`,
+			time.Now().UTC(), user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update notifications"})
+		}
+		return c.JSON(fiber.Map{"status": "success"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid notification ID"})
+	}
+	res, err := util.DB.Exec(`
+		UPDATE notifications SET read_at = COALESCE(read_at, $1)
+		WHERE id = $2 AND user_id = $3`, time.Now().UTC(), id, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update notification"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success"})
+}
@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/payments"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+const defaultPremiumSweepMinutes = 60
+
+// paymentProvider takes the payments; nil when PAYMENT_PROVIDER isn't set, which disables checkout.
+var paymentProvider payments.Provider
+
+// InitPayments sets up the provider named by PAYMENT_PROVIDER.
+func InitPayments() error {
+	provider, err := payments.FromEnv()
+	if err != nil {
+		return err
+	}
+	paymentProvider = provider
+	if provider == nil {
+		log.Println("payments: no provider configured, checkout is disabled")
+	}
+	return nil
+}
+
+// toMinorUnits converts a NUMERIC(10,2) price to paise/cents.
+func toMinorUnits(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
+
+// paymentTransition reports whether a webhook with status incoming may settle a payment that
+// is currently in status current. A failed attempt can still be followed by a successful one
+// on the same order, but nothing replaces a success, and replays of an outcome change nothing.
+func paymentTransition(current, incoming string) bool {
+	switch current {
+	case "pending":
+		return incoming == "success" || incoming == "failed"
+	case "failed":
+		return incoming == "success"
+	}
+	return false
+}
+
+// CreateCheckout starts buying a plan or a paid question set: it records a pending payment
+// and creates the provider order the client completes the payment against. The payment is
+// settled by PaymentWebhook.
+func CreateCheckout(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if paymentProvider == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Payments are not configured"})
+	}
+	var input struct {
+		PlanID        int `json:"plan_id"`
+		QuestionSetID int `json:"question_set_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if (input.PlanID > 0) == (input.QuestionSetID > 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Send either plan_id or question_set_id"})
+	}
+
+	var (
+		planID, questionSetID *int
+		currency, itemKey     string
+		price                 float64
+		item                  fiber.Map
+	)
+	if input.PlanID > 0 {
+		var planName string
+		var durationDays int
+		err := util.DB.QueryRow(`
+			SELECT COALESCE(name, ''), price, currency, duration_days
+			FROM subscription_plans
+			WHERE id = $1 AND active AND price > 0 AND duration_days > 0`, input.PlanID).Scan(&planName, &price, &currency, &durationDays)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch plan"})
+		}
+		planID, itemKey = &input.PlanID, "plan"
+		item = fiber.Map{"id": input.PlanID, "name": planName, "price": price, "currency": currency, "duration_days": durationDays}
+	} else {
+		var setName string
+		err := util.DB.QueryRow(`
+			SELECT name, price, currency
+			FROM question_sets
+			WHERE id = $1 AND deleted <> true AND access_level = 'paid' AND price > 0`, input.QuestionSetID).Scan(&setName, &price, &currency)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question set is not for sale"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set"})
+		}
+		canStart, _, err := questionSetAccess(util.DB, input.QuestionSetID, &user)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access to the question set"})
+		}
+		if canStart {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You already have access to this question set"})
+		}
+		questionSetID, itemKey = &input.QuestionSetID, "question_set"
+		item = fiber.Map{"id": input.QuestionSetID, "name": setName, "price": price, "currency": currency}
+	}
+
+	now := time.Now().UTC()
+	var paymentID int
+	err := util.DB.QueryRow(`
+		INSERT INTO payments (user_id, plan_id, question_set_id, amount, currency, payment_provider, payment_status, paid_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 'pending', NULL, $7, $7)
+		RETURNING id`, user.ID, planID, questionSetID, price, currency, paymentProvider.Name(), now).Scan(&paymentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record payment"})
+	}
+
+	order, err := paymentProvider.CreateOrder(toMinorUnits(price), currency, fmt.Sprintf("payment_%d", paymentID))
+	if err != nil {
+		log.Println("payments: creating order:", err)
+		util.DB.Exec(`UPDATE payments SET payment_status = 'failed', failure_reason = $1, updated_at = $2 WHERE id = $3`,
+			"order could not be created", time.Now().UTC(), paymentID)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Failed to create payment order"})
+	}
+	if _, err := util.DB.Exec(`UPDATE payments SET order_id = $1 WHERE id = $2`, order.ID, paymentID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record payment"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":     "success",
+		"payment_id": paymentID,
+		"provider":   paymentProvider.Name(),
+		"order":      order,
+		itemKey:      item,
+	})
+}
+
+// PaymentWebhook settles payments from the provider's signed notifications. Providers retry
+// until they get a 2xx, so anything already settled, or about an order we don't know, is
+// acknowledged without changes.
+func PaymentWebhook(c *fiber.Ctx) error {
+	if paymentProvider == nil || c.Params("provider") != paymentProvider.Name() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown payment provider"})
+	}
+	event, err := paymentProvider.VerifyWebhook(c.Body(), c.Get(paymentProvider.SignatureHeader()))
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid signature"})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid webhook payload"})
+	}
+	if event.Status == "" || event.OrderID == "" {
+		return c.JSON(fiber.Map{"status": "ignored"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	outcome, err := settlePayment(tx, event)
+	if err != nil {
+		log.Println("payments: settling webhook:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record payment"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.JSON(fiber.Map{"status": outcome})
+}
+
+// settlePayment applies a verified webhook event to its payment and, for a successful one,
+// activates the plan or grants the question set. It returns recorded, duplicate or unknown_order.
+func settlePayment(tx *sql.Tx, event payments.Event) (string, error) {
+	var (
+		paymentID, userID     int
+		planID, questionSetID *int
+		amount                float64
+		currency, status      string
+	)
+	err := tx.QueryRow(`
+		SELECT id, user_id, plan_id, question_set_id, amount, currency, payment_status
+		FROM payments
+		WHERE payment_provider = $1 AND order_id = $2
+		FOR UPDATE`, paymentProvider.Name(), event.OrderID).Scan(&paymentID, &userID, &planID, &questionSetID, &amount, &currency, &status)
+	if err == sql.ErrNoRows {
+		return "unknown_order", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	newStatus := event.Status
+	var failureReason *string
+	if newStatus == "success" && (event.Amount != toMinorUnits(amount) || !strings.EqualFold(event.Currency, currency)) {
+		newStatus = "failed"
+		reason := fmt.Sprintf("paid %d %s, expected %d %s", event.Amount, event.Currency, toMinorUnits(amount), currency)
+		failureReason = &reason
+	}
+	if !paymentTransition(status, newStatus) {
+		return "duplicate", nil
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+		UPDATE payments
+		SET payment_status = $1,
+		    transaction_id = $2,
+		    failure_reason = $3,
+		    paid_at = CASE WHEN $1 = 'success' THEN $4::timestamp END,
+		    updated_at = $4
+		WHERE id = $5`, newStatus, event.PaymentID, failureReason, now, paymentID)
+	if err != nil {
+		return "", err
+	}
+
+	if newStatus != "success" {
+		return "recorded", notifyUser(tx, userID, "payment_failed", "Your payment could not be completed",
+			fiber.Map{"payment_id": paymentID})
+	}
+	if questionSetID != nil {
+		return "recorded", grantQuestionSet(tx, userID, *questionSetID, paymentID, now)
+	}
+	if planID == nil {
+		return "recorded", nil
+	}
+	expiry, err := activatePremium(tx, userID, *planID, now)
+	if err != nil {
+		return "", err
+	}
+	message := "Your premium subscription is active"
+	if expiry != nil {
+		message += " until " + expiry.Format("2 Jan 2006")
+	}
+	return "recorded", notifyUser(tx, userID, "premium_activated", message,
+		fiber.Map{"payment_id": paymentID, "premium_expiry": expiry})
+}
+
+// grantQuestionSet records the purchase of a paid question set and lets the buyer know.
+func grantQuestionSet(tx *sql.Tx, userID, questionSetID, paymentID int, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO question_set_purchases (user_id, question_set_id, payment_id, purchased_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, question_set_id) DO NOTHING`, userID, questionSetID, paymentID, now)
+	if err != nil {
+		return err
+	}
+	var setName string
+	if err := tx.QueryRow(`SELECT name FROM question_sets WHERE id = $1`, questionSetID).Scan(&setName); err != nil {
+		return err
+	}
+	return notifyUser(tx, userID, "question_set_purchased", "You can now take "+setName,
+		fiber.Map{"payment_id": paymentID, "question_set_id": questionSetID})
+}
+
+// activatePremium grants a plan's days of premium. Time left on a running subscription is
+// kept, so renewing early extends it; premium without an expiry stays that way.
+func activatePremium(tx *sql.Tx, userID, planID int, now time.Time) (*time.Time, error) {
+	var expiry *time.Time
+	err := tx.QueryRow(`
+		UPDATE users
+		SET premium_since = CASE WHEN is_premium AND (premium_expiry IS NULL OR premium_expiry > $2)
+		                         THEN COALESCE(premium_since, $2) ELSE $2 END,
+		    premium_expiry = CASE WHEN is_premium AND premium_expiry IS NULL THEN NULL
+		                          ELSE GREATEST(COALESCE(premium_expiry, $2), $2)
+		                               + (SELECT duration_days FROM subscription_plans WHERE id = $3) * INTERVAL '1 day' END,
+		    is_premium = true,
+		    updated_at = $2
+		WHERE id = $1
+		RETURNING premium_expiry`, userID, now, planID).Scan(&expiry)
+	return expiry, err
+}
+
+// GetMyPayments returns the caller's subscription status and payment history.
+func GetMyPayments(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var isPremium bool
+	var premiumSince, premiumExpiry *time.Time
+	err := util.DB.QueryRow(`
+		SELECT COALESCE(is_premium, false) AND (premium_expiry IS NULL OR premium_expiry > $2), premium_since, premium_expiry
+		FROM users WHERE id = $1`, user.ID, time.Now().UTC()).Scan(&isPremium, &premiumSince, &premiumExpiry)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch subscription"})
+	}
+
+	rows, err := util.DB.Query(`
+		SELECT p.id, p.plan_id, sp.name, p.question_set_id, qs.name, p.amount, p.currency, p.payment_provider, p.payment_status,
+		       p.order_id, p.transaction_id, p.failure_reason, p.created_at, p.paid_at
+		FROM payments p
+		LEFT JOIN subscription_plans sp ON sp.id = p.plan_id
+		LEFT JOIN question_sets qs ON qs.id = p.question_set_id
+		WHERE p.user_id = $1
+		ORDER BY p.created_at DESC, p.id DESC`, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch payments"})
+	}
+	defer rows.Close()
+
+	history := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id                                    int
+			planID, questionSetID                 *int
+			planName, questionSetName             *string
+			provider, status                      *string
+			orderID, transactionID, failureReason *string
+			amount                                float64
+			currency                              string
+			createdAt, paidAt                     *time.Time
+		)
+		if err := rows.Scan(&id, &planID, &planName, &questionSetID, &questionSetName, &amount, &currency, &provider, &status,
+			&orderID, &transactionID, &failureReason, &createdAt, &paidAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read payment"})
+		}
+		history = append(history, map[string]interface{}{
+			"id":                id,
+			"plan_id":           planID,
+			"plan_name":         planName,
+			"question_set_id":   questionSetID,
+			"question_set_name": questionSetName,
+			"amount":            amount,
+			"currency":          currency,
+			"provider":          provider,
+			"status":            status,
+			"order_id":          orderID,
+			"transaction_id":    transactionID,
+			"failure_reason":    failureReason,
+			"created_at":        createdAt,
+			"paid_at":           paidAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"subscription": fiber.Map{
+			"is_premium":     isPremium,
+			"premium_since":  premiumSince,
+			"premium_expiry": premiumExpiry,
+		},
+		"payments": history,
+	})
+}
+
+// StartPremiumExpiry turns off premium once it has run out, every PREMIUM_SWEEP_MINUTES.
+// Protected() already ignores expired premium, so this only has to catch up the flag and let
+// the user know.
+func StartPremiumExpiry() {
+	interval := time.Duration(envInt("PREMIUM_SWEEP_MINUTES", defaultPremiumSweepMinutes)) * time.Minute
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := expirePremium(time.Now().UTC())
+			if err != nil {
+				log.Println("premium expiry:", err)
+			}
+			if n > 0 {
+				log.Printf("premium expiry: %d subscriptions ended", n)
+			}
+		}
+	}()
+}
+
+func expirePremium(now time.Time) (int, error) {
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE users
+		SET is_premium = false, updated_at = $1
+		WHERE is_premium AND premium_expiry IS NOT NULL AND premium_expiry <= $1
+		RETURNING id`, now)
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range userIDs {
+		if err := notifyUser(tx, id, "premium_expired", "Your premium subscription has ended", fiber.Map{}); err != nil {
+			return 0, err
+		}
+	}
+	return len(userIDs), tx.Commit()
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import "testing"
+
+func TestPaymentTransition(t *testing.T) {
+	cases := []struct {
+		current, incoming string
+		want              bool
+	}{
+		{"pending", "success", true},
+		{"pending", "failed", true},
+		{"failed", "success", true},
+		{"failed", "failed", false},
+		{"success", "success", false},
+		{"success", "failed", false},
+	}
+	for _, tc := range cases {
+		if got := paymentTransition(tc.current, tc.incoming); got != tc.want {
+			t.Errorf("paymentTransition(%q, %q) = %v, want %v", tc.current, tc.incoming, got, tc.want)
+		}
+	}
+}
+
+func TestToMinorUnits(t *testing.T) {
+	if got := toMinorUnits(499.99); got != 49999 {
+		t.Fatalf("got %d, want 49999", got)
+	}
+	if got := toMinorUnits(0.1 + 0.2); got != 30 {
+		t.Fatalf("got %d, want 30", got)
+	}
+}
+
+func TestPlanInputValidate(t *testing.T) {
+	name, price, days, currency := " Monthly ", 199.0, 30, "inr"
+	input := planInput{Name: &name, Price: &price, DurationDays: &days, Currency: &currency}
+	if err := input.validate(true); err != nil {
+		t.Fatal(err)
+	}
+	if *input.Name != "Monthly" || *input.Currency != "INR" {
+		t.Fatalf("name and currency should be normalized, got %q %q", *input.Name, *input.Currency)
+	}
+	if err := (&planInput{Name: &name}).validate(true); err == nil {
+		t.Fatal("creating a plan without price and duration should fail")
+	}
+	zero := 0
+	if err := (&planInput{DurationDays: &zero}).validate(false); err == nil {
+		t.Fatal("duration_days must be positive")
+	}
+}
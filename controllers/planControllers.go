@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// planInput is the body of plan create and update requests. Update only changes the fields sent.
+type planInput struct {
+	Name                *string  `json:"name"`
+	Description         *string  `json:"description"`
+	Price               *float64 `json:"price"`
+	Currency            *string  `json:"currency"`
+	DurationDays        *int     `json:"duration_days"`
+	QuestionLimitPerDay *int     `json:"question_limit_per_day"`
+	Active              *bool    `json:"active"`
+}
+
+// validate checks the fields that were sent; creating also requires name, price and duration_days.
+func (p *planInput) validate(creating bool) error {
+	if creating && (p.Name == nil || p.Price == nil || p.DurationDays == nil) {
+		return errors.New("name, price and duration_days are required")
+	}
+	if p.Name != nil {
+		name := strings.TrimSpace(*p.Name)
+		if name == "" || len(name) > 50 {
+			return errors.New("name must be between 1 and 50 characters")
+		}
+		p.Name = &name
+	}
+	if p.Price != nil && *p.Price <= 0 {
+		return errors.New("price must be positive")
+	}
+	if p.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*p.Currency))
+		if !currencyPattern.MatchString(currency) {
+			return errors.New("currency must be a three-letter ISO code")
+		}
+		p.Currency = &currency
+	}
+	if p.DurationDays != nil && *p.DurationDays <= 0 {
+		return errors.New("duration_days must be positive")
+	}
+	if p.QuestionLimitPerDay != nil && *p.QuestionLimitPerDay < 0 {
+		return errors.New("question_limit_per_day cannot be negative")
+	}
+	return nil
+}
+
+const planColumns = `id, COALESCE(name, ''), COALESCE(description, ''), COALESCE(price, 0), currency, COALESCE(duration_days, 0),
+	question_limit_per_day, active, created_at`
+
+func scanPlan(row interface{ Scan(...interface{}) error }) (map[string]interface{}, error) {
+	var (
+		id, durationDays    int
+		name, description   string
+		currency            string
+		price               float64
+		questionLimitPerDay *int
+		active              bool
+		createdAt           time.Time
+	)
+	if err := row.Scan(&id, &name, &description, &price, &currency, &durationDays, &questionLimitPerDay, &active, &createdAt); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"id":                     id,
+		"name":                   name,
+		"description":            description,
+		"price":                  price,
+		"currency":               currency,
+		"duration_days":          durationDays,
+		"question_limit_per_day": questionLimitPerDay,
+		"active":                 active,
+		"created_at":             createdAt,
+	}, nil
+}
+
+// GetPlans lists the plans that can be bought, cheapest first.
+func GetPlans(c *fiber.Ctx) error {
+	rows, err := util.DB.Query(`SELECT ` + planColumns + ` FROM subscription_plans WHERE active ORDER BY price, id`)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch plans"})
+	}
+	defer rows.Close()
+
+	plans := []map[string]interface{}{}
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read plan"})
+		}
+		plans = append(plans, plan)
+	}
+	return c.JSON(fiber.Map{"status": "success", "plans": plans})
+}
+
+func CreatePlan(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Only owners can manage plans"})
+	}
+	var input planInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.validate(true); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Currency == nil {
+		inr := "INR"
+		input.Currency = &inr
+	}
+	if input.Active == nil {
+		active := true
+		input.Active = &active
+	}
+
+	plan, err := scanPlan(util.DB.QueryRow(`
+		INSERT INTO subscription_plans (name, description, price, currency, duration_days, question_limit_per_day, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING `+planColumns,
+		input.Name, input.Description, input.Price, input.Currency, input.DurationDays, input.QuestionLimitPerDay,
+		input.Active, time.Now().UTC()))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create plan"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "plan": plan})
+}
+
+// UpdatePlan edits a plan. Payments already made keep the price they were charged.
+func UpdatePlan(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Only owners can manage plans"})
+	}
+	planID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid plan ID"})
+	}
+	var input planInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.validate(false); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	plan, err := scanPlan(util.DB.QueryRow(`
+		UPDATE subscription_plans
+		SET name = COALESCE($1, name),
+		    description = COALESCE($2, description),
+		    price = COALESCE($3, price),
+		    currency = COALESCE($4, currency),
+		    duration_days = COALESCE($5, duration_days),
+		    question_limit_per_day = COALESCE($6, question_limit_per_day),
+		    active = COALESCE($7, active),
+		    updated_at = $8
+		WHERE id = $9
+		RETURNING `+planColumns,
+		input.Name, input.Description, input.Price, input.Currency, input.DurationDays, input.QuestionLimitPerDay,
+		input.Active, time.Now().UTC(), planID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update plan"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "plan": plan})
+}
+
+// DeletePlan retires a plan so it can no longer be bought. It stays in place for the payments
+// that refer to it.
+func DeletePlan(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Only owners can manage plans"})
+	}
+	planID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid plan ID"})
+	}
+	res, err := util.DB.Exec(`UPDATE subscription_plans SET active = false, updated_at = $1 WHERE id = $2`, time.Now().UTC(), planID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete plan"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Plan retired"})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/lib/pq"
 	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -77,8 +78,8 @@ func CreateQuestion(c *fiber.Ctx) error {
 			Language       string   `json:"language" validate:"required"`
 			Difficulty     int      `json:"difficulty" validate:"oneof=1 2 3 4 5 6 7 8 9 10"`
 			QuestionType   string   `json:"question_type" validate:"oneof=m-choice m-select numeric"`
-			Options        []string `json:"options" validate:"required"`
-			CorrectOptions []int    `json:"correct_options" validate:"required"`
+			Options        []string `json:"options" validate:"required_unless=QuestionType numeric"`
+			CorrectOptions []int    `json:"correct_options" validate:"required_unless=QuestionType numeric"`
 			Explanation    *string  `json:"explanation"`
 		}{
 			Question:       question.Question,
@@ -99,6 +100,14 @@ func CreateQuestion(c *fiber.Ctx) error {
 				"error":   err.Error(),
 			})
 		}
+		numericJSON, err := prepareNumericQuestion(&question)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Validation failed",
+				"error":   err.Error(),
+			})
+		}
 
 		question.CreatedByID = user.ID
 		question.CreatedAt = time.Now()
@@ -108,9 +117,9 @@ func CreateQuestion(c *fiber.Ctx) error {
 		insertQuery := `INSERT INTO questions (
 			question, subject, exam, language, difficulty,
 			question_type, options, correct_options, explanation,
-			created_by_id, created_at, updated_at
+			created_by_id, created_at, updated_at, numeric_answer
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
 		RETURNING id`
 
 		var questionID string
@@ -128,6 +137,7 @@ func CreateQuestion(c *fiber.Ctx) error {
 			question.CreatedByID,
 			question.CreatedAt,
 			question.UpdatedAt,
+			numericJSON,
 		).Scan(&questionID)
 
 		if err != nil {
@@ -154,6 +164,9 @@ func CreateQuestion(c *fiber.Ctx) error {
 		}
 
 		question.ID, _ = strconv.Atoi(questionID)
+		if err := questionRevisions.recordCreate(tx, question.ID, user.ID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to record question version", "details": err.Error()})
+		}
 		createdQuestions = append(createdQuestions, question.ID)
 	}
 
@@ -185,6 +198,29 @@ func GetQuestions(c *fiber.Ctx) error {
 	createdBy := c.Query("createdBy")
 	createdBySelf := c.Query("createdBySelf")
 	qidsParam := c.Query("qids")
+	// Difficulty filters and sorting use either the authored difficulty or the one calibrated from attempts.
+	difficultySource := c.Query("difficulty_source", "authored")
+	minDifficulty := c.Query("min_difficulty")
+	maxDifficulty := c.Query("max_difficulty")
+	sortBy := c.Query("sort_by", "created_at")
+
+	difficultyColumn := "q.difficulty"
+	switch difficultySource {
+	case "authored":
+	case "calibrated":
+		difficultyColumn = "q.calibrated_difficulty"
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "difficulty_source must be authored or calibrated",
+		})
+	}
+	if sortBy != "created_at" && sortBy != "difficulty" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "sort_by must be created_at or difficulty",
+		})
+	}
 
 	// Simulated current user ID
 	currentUserID := c.Locals("user").(models.User).ID
@@ -201,7 +237,7 @@ func GetQuestions(c *fiber.Ctx) error {
 	}
 
 	// Build base query
-	selectedFields := "q.id, q.question, q.subject, q.exam, q.language, q.difficulty, q.question_type, q.options, q.correct_options, q.explanation, q.created_by_id, q.created_at, q.updated_at, u.name"
+	selectedFields := "q.id, q.question, q.subject, q.exam, q.language, q.difficulty, q.question_type, q.options, q.correct_options, q.explanation, q.created_by_id, q.created_at, q.updated_at, u.name, q.numeric_answer, q.calibrated_difficulty, q.calibration_attempts"
 	if fields != "" {
 		selectedFields = "q.id, u.name"
 		for _, field := range strings.Split(fields, ",") {
@@ -277,6 +313,24 @@ func GetQuestions(c *fiber.Ctx) error {
 		args = append(args, currentUserID)
 		argID++
 	}
+	for _, bound := range []struct {
+		value string
+		op    string
+	}{{minDifficulty, ">="}, {maxDifficulty, "<="}} {
+		if bound.value == "" {
+			continue
+		}
+		d, err := strconv.ParseFloat(bound.value, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "min_difficulty and max_difficulty must be numbers",
+			})
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", difficultyColumn, bound.op, argID))
+		args = append(args, d)
+		argID++
+	}
 	conditions = append(conditions, "q.deleted=false")
 
 	whereClause := ""
@@ -299,10 +353,14 @@ func GetQuestions(c *fiber.Ctx) error {
 
 	// Build final query
 	finalQuery := baseQuery + whereClause + " GROUP BY q.id, u.name"
+	orderColumn := "q.created_at"
+	if sortBy == "difficulty" {
+		orderColumn = difficultyColumn
+	}
 	if sort == "asc" {
-		finalQuery += " ORDER BY q.created_at ASC"
+		finalQuery += " ORDER BY " + orderColumn + " ASC NULLS LAST"
 	} else {
-		finalQuery += " ORDER BY q.created_at DESC"
+		finalQuery += " ORDER BY " + orderColumn + " DESC NULLS LAST"
 	}
 
 	// Only apply pagination if we're not fetching specific IDs
@@ -323,31 +381,37 @@ func GetQuestions(c *fiber.Ctx) error {
 
 	// Parse results
 	type QuestionResponse struct {
-		ID             int       `json:"id"`
-		Question       string    `json:"question,omitempty"`
-		Subject        string    `json:"subject,omitempty"`
-		Exam           *string   `json:"exam,omitempty"`
-		Language       string    `json:"language,omitempty"`
-		Difficulty     int       `json:"difficulty,omitempty"`
-		QuestionType   string    `json:"question_type,omitempty"`
-		Options        []string  `json:"options,omitempty"`
-		CorrectOptions []string  `json:"correct_options,omitempty"`
-		Explanation    *string   `json:"explanation,omitempty"`
-		CreatedByID    int       `json:"created_by_id,omitempty"`
-		CreatedByName  string    `json:"created_by_name,omitempty"`
-		CreatedAt      time.Time `json:"created_at,omitempty"`
-		UpdatedAt      time.Time `json:"updated_at,omitempty"`
-		Tags           []string  `json:"tags"`
+		ID             int                   `json:"id"`
+		Question       string                `json:"question,omitempty"`
+		Subject        string                `json:"subject,omitempty"`
+		Exam           *string               `json:"exam,omitempty"`
+		Language       string                `json:"language,omitempty"`
+		Difficulty     int                   `json:"difficulty,omitempty"`
+		QuestionType   string                `json:"question_type,omitempty"`
+		Options        []string              `json:"options,omitempty"`
+		CorrectOptions []string              `json:"correct_options,omitempty"`
+		Explanation    *string               `json:"explanation,omitempty"`
+		CreatedByID    int                   `json:"created_by_id,omitempty"`
+		CreatedByName  string                `json:"created_by_name,omitempty"`
+		CreatedAt      time.Time             `json:"created_at,omitempty"`
+		UpdatedAt      time.Time             `json:"updated_at,omitempty"`
+		Tags           []string              `json:"tags"`
+		NumericAnswer  *models.NumericAnswer `json:"numeric_answer,omitempty"`
+		// Difficulty estimated from attempts; null until the question has enough of them
+		CalibratedDifficulty *float64 `json:"calibrated_difficulty"`
+		CalibrationAttempts  int      `json:"calibration_attempts"`
 	}
 
 	var questions []QuestionResponse
 	var tagsJSON []byte
+	var numericJSON []byte
 	for rows.Next() {
 		var q QuestionResponse
 		err := rows.Scan(
 			&q.ID, &q.Question, &q.Subject, &q.Exam, &q.Language, &q.Difficulty,
 			&q.QuestionType, pq.Array(&q.Options), pq.Array(&q.CorrectOptions),
-			&q.Explanation, &q.CreatedByID, &q.CreatedAt, &q.UpdatedAt, &q.CreatedByName, &tagsJSON,
+			&q.Explanation, &q.CreatedByID, &q.CreatedAt, &q.UpdatedAt, &q.CreatedByName, &numericJSON,
+			&q.CalibratedDifficulty, &q.CalibrationAttempts, &tagsJSON,
 		)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -356,6 +420,13 @@ func GetQuestions(c *fiber.Ctx) error {
 				"error":   err.Error(),
 			})
 		}
+		if q.NumericAnswer, err = parseNumericAnswerJSON(numericJSON); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to parse numeric answer",
+				"error":   err.Error(),
+			})
+		}
 		if err := json.Unmarshal(tagsJSON, &q.Tags); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -420,7 +491,8 @@ func GetQuestionByID(c *fiber.Ctx) error {
 	query := `
 		SELECT 
 			q.id, q.question, q.subject, q.exam, q.language, q.difficulty, q.question_type,
-			q.options, q.correct_options, q.explanation, q.created_by_id, q.created_at, q.updated_at,
+			q.options, q.correct_options, q.explanation, q.created_by_id, q.created_at, q.updated_at, q.numeric_answer,
+			q.calibrated_difficulty, q.calibration_attempts,
 			COALESCE(json_agg(DISTINCT qt.name) FILTER (WHERE qt.name IS NOT NULL), '[]') AS tags
 		FROM questions q
 		LEFT JOIN question_questiontags qqt ON q.id = qqt.question_id
@@ -433,29 +505,34 @@ func GetQuestionByID(c *fiber.Ctx) error {
 
 	// Struct for response
 	type QuestionResponse struct {
-		ID             int       `json:"id"`
-		Question       string    `json:"question,omitempty"`
-		Subject        string    `json:"subject,omitempty"`
-		Exam           *string   `json:"exam,omitempty"`
-		Language       string    `json:"language,omitempty"`
-		Difficulty     int       `json:"difficulty,omitempty"`
-		QuestionType   string    `json:"question_type,omitempty"`
-		Options        []string  `json:"options,omitempty"`
-		CorrectOptions []string  `json:"correct_options,omitempty"`
-		Explanation    *string   `json:"explanation,omitempty"`
-		CreatedByID    int       `json:"created_by_id,omitempty"`
-		CreatedAt      time.Time `json:"created_at,omitempty"`
-		UpdatedAt      time.Time `json:"updated_at,omitempty"`
-		Tags           []string  `json:"tags"`
+		ID                   int                   `json:"id"`
+		Question             string                `json:"question,omitempty"`
+		Subject              string                `json:"subject,omitempty"`
+		Exam                 *string               `json:"exam,omitempty"`
+		Language             string                `json:"language,omitempty"`
+		Difficulty           int                   `json:"difficulty,omitempty"`
+		QuestionType         string                `json:"question_type,omitempty"`
+		Options              []string              `json:"options,omitempty"`
+		CorrectOptions       []string              `json:"correct_options,omitempty"`
+		Explanation          *string               `json:"explanation,omitempty"`
+		CreatedByID          int                   `json:"created_by_id,omitempty"`
+		CreatedAt            time.Time             `json:"created_at,omitempty"`
+		UpdatedAt            time.Time             `json:"updated_at,omitempty"`
+		Tags                 []string              `json:"tags"`
+		NumericAnswer        *models.NumericAnswer `json:"numeric_answer,omitempty"`
+		CalibratedDifficulty *float64              `json:"calibrated_difficulty"`
+		CalibrationAttempts  int                   `json:"calibration_attempts"`
 	}
 
 	var q QuestionResponse
 	var tagsJSON []byte
+	var numericJSON []byte
 
 	err := row.Scan(
 		&q.ID, &q.Question, &q.Subject, &q.Exam, &q.Language, &q.Difficulty,
 		&q.QuestionType, pq.Array(&q.Options), pq.Array(&q.CorrectOptions),
-		&q.Explanation, &q.CreatedByID, &q.CreatedAt, &q.UpdatedAt, &tagsJSON,
+		&q.Explanation, &q.CreatedByID, &q.CreatedAt, &q.UpdatedAt, &numericJSON,
+		&q.CalibratedDifficulty, &q.CalibrationAttempts, &tagsJSON,
 	)
 
 	if err != nil {
@@ -479,6 +556,13 @@ func GetQuestionByID(c *fiber.Ctx) error {
 			"error":   err.Error(),
 		})
 	}
+	if q.NumericAnswer, err = parseNumericAnswerJSON(numericJSON); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to parse numeric answer",
+			"error":   err.Error(),
+		})
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status":   "success",
@@ -526,15 +610,19 @@ func DeleteQuestions(c *fiber.Ctx) error {
 	// Check if user is admin or owner
 	isAdminOrOwner := user.Role == "admin" || user.Role == "owner" // Adjust based on your role system
 
-	// Build the WHERE condition based on user role
+	// Build the WHERE condition based on user role; others can delete their own questions and
+	// those shared with them as an editor
 	whereCondition := "deleted = false AND id = ANY($1)"
+	args := []interface{}{pq.Array(ids)}
 	if !isAdminOrOwner {
-		whereCondition += fmt.Sprintf(" AND created_by_id = %d", user.ID)
+		args = append(args, user.ID)
+		whereCondition += fmt.Sprintf(` AND (created_by_id = $%d OR id IN (
+			SELECT question_id FROM user_questions_editors WHERE user_id = $%d AND status = 'accepted' AND role = 'editor'))`, len(args), len(args))
 	}
 
 	// Get the IDs of questions that can actually be deleted
 	var deletableIDs []int
-	rows, err := db.Query(fmt.Sprintf("SELECT id FROM questions WHERE %s", whereCondition), pq.Array(ids))
+	rows, err := db.Query(fmt.Sprintf("SELECT id FROM questions WHERE %s", whereCondition), args...)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -595,19 +683,27 @@ func EditQuestion(c *fiber.Ctx) error {
 	validate := validator.New()
 
 	// Get question ID from url
-	id := c.Params("id")
-	if id == "" {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Question ID is required",
+			"message": "Invalid question ID",
 		})
 	}
 
 	user := c.Locals("user").(models.User)
 
-	// Check if question exists and get creator
+	// Check if question exists and get creator, the caller's collaborator role and current answer key
 	var createdByID int
-	err := db.QueryRow("SELECT created_by_id FROM questions WHERE id = $1", id).Scan(&createdByID)
+	var sharedRole *string
+	var oldKey answerKey
+	var oldCorrect pq.Int64Array
+	var oldNumericJSON []byte
+	err = db.QueryRow(`
+		SELECT created_by_id, question_type, correct_options, numeric_answer,
+		       (SELECT role FROM user_questions_editors e WHERE e.question_id = questions.id AND e.user_id = $2 AND e.status = 'accepted')
+		FROM questions WHERE id = $1`, id, user.ID).
+		Scan(&createdByID, &oldKey.QuestionType, &oldCorrect, &oldNumericJSON, &sharedRole)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -622,8 +718,8 @@ func EditQuestion(c *fiber.Ctx) error {
 		})
 	}
 
-	// Authorization check
-	if user.ID != createdByID && user.Role != "admin" && user.Role != "owner" {
+	// Authorization check - creator, admin, owner or an editor the question is shared with
+	if !canEditRole(collaboratorRole(createdByID, user, sharedRole)) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"status":  "error",
 			"message": "You are not authorized to edit this question",
@@ -648,8 +744,8 @@ func EditQuestion(c *fiber.Ctx) error {
 		Language       string   `json:"language" validate:"required"`
 		Difficulty     int      `json:"difficulty" validate:"oneof=1 2 3 4 5 6 7 8 9 10"`
 		QuestionType   string   `json:"question_type" validate:"oneof=m-choice m-select numeric"`
-		Options        []string `json:"options" validate:"required"`
-		CorrectOptions []int    `json:"correct_options" validate:"required"`
+		Options        []string `json:"options" validate:"required_unless=QuestionType numeric"`
+		CorrectOptions []int    `json:"correct_options" validate:"required_unless=QuestionType numeric"`
 		Explanation    *string  `json:"explanation"`
 	}{
 		Question:       updated.Question,
@@ -670,6 +766,14 @@ func EditQuestion(c *fiber.Ctx) error {
 			"error":   err.Error(),
 		})
 	}
+	numericJSON, err := prepareNumericQuestion(&updated)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
 
 	// Start transaction
 	tx, err := db.Begin()
@@ -682,33 +786,17 @@ func EditQuestion(c *fiber.Ctx) error {
 	}
 	defer tx.Rollback()
 
-	// Update question
-	_, err = tx.Exec(`
-		UPDATE questions SET
-			question = $1,
-			subject = $2,
-			exam = $3,
-			language = $4,
-			difficulty = $5,
-			question_type = $6,
-			options = $7,
-			correct_options = $8,
-			explanation = $9,
-			updated_at = $10
-		WHERE id = $11`,
-		updated.Question,
-		updated.Subject,
-		updated.Exam,
-		updated.Language,
-		updated.Difficulty,
-		updated.QuestionType,
-		pq.Array(updated.Options),
-		pq.Array(updated.CorrectOptions),
-		updated.Explanation,
-		time.Now(),
-		id,
-	)
+	// Keep the version being replaced; questions from before revisions were kept have none yet
+	_, before, err := questionRevisions.baseline(tx, id)
 	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to record the current version",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := writeQuestion(tx, id, updated, numericJSON); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update question",
@@ -716,33 +804,29 @@ func EditQuestion(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete existing tag links
-	_, err = tx.Exec("DELETE FROM question_questiontags WHERE question_id = $1", id)
+	version, err := questionRevisions.recordChange(tx, id, before, "edit", user.ID, nil)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to clear old tags",
+			"message": "Failed to record question version",
 			"error":   err.Error(),
 		})
 	}
 
-	// Insert new tags and links
-	for _, tagName := range updated.Tags {
-		var tagID string
-		err = tx.QueryRow("SELECT id FROM questiontags WHERE name = $1", tagName).Scan(&tagID)
-		if err == sql.ErrNoRows {
-			err = tx.QueryRow("INSERT INTO questiontags (name) VALUES ($1) RETURNING id", tagName).Scan(&tagID)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": "Failed to insert tag", "details": err.Error()})
-			}
-		} else if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch tag", "details": err.Error()})
-		}
-
-		_, err = tx.Exec("INSERT INTO question_questiontags (question_id, questiontags_id) VALUES ($1, $2)", id, tagID)
+	// A corrected answer key is applied to past sessions unless the request opts out with regrade=false
+	var regrade *regradeSummary
+	oldKey.CorrectOptions = oldCorrect
+	oldKey.Numeric, _ = parseNumericAnswerJSON(oldNumericJSON)
+	if answerKeyChanged(oldKey, updated) && c.QueryBool("regrade", true) {
+		summary, err := regradeQuestion(tx, id, regradeReasonKeyCorrection, user.ID)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to link tag", "details": err.Error()})
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to regrade past sessions",
+				"error":   err.Error(),
+			})
 		}
+		regrade = &summary
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -752,5 +836,96 @@ func EditQuestion(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status":  "success",
 		"message": "Question updated successfully",
+		"version": version,
+		"regrade": regrade,
 	})
 }
+
+// writeQuestion overwrites a question's content, answer key and tags.
+func writeQuestion(tx *sql.Tx, id int, q models.Question, numericJSON *string) error {
+	_, err := tx.Exec(`
+		UPDATE questions SET
+			question = $1,
+			subject = $2,
+			exam = $3,
+			language = $4,
+			difficulty = NULLIF($5, 0),
+			question_type = $6,
+			options = $7,
+			correct_options = $8,
+			explanation = $9,
+			updated_at = $10,
+			numeric_answer = $11
+		WHERE id = $12`,
+		q.Question,
+		q.Subject,
+		q.Exam,
+		q.Language,
+		q.Difficulty,
+		q.QuestionType,
+		pq.Array(q.Options),
+		pq.Array(q.CorrectOptions),
+		q.Explanation,
+		time.Now(),
+		numericJSON,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM question_questiontags WHERE question_id = $1", id); err != nil {
+		return fmt.Errorf("failed to clear old tags: %w", err)
+	}
+	for _, tagName := range q.Tags {
+		var tagID string
+		err = tx.QueryRow("SELECT id FROM questiontags WHERE name = $1", tagName).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow("INSERT INTO questiontags (name) VALUES ($1) RETURNING id", tagName).Scan(&tagID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch tag: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO question_questiontags (question_id, questiontags_id) VALUES ($1, $2)", id, tagID); err != nil {
+			return fmt.Errorf("failed to link tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// answerKeyChanged reports whether q grades answers differently from the key it replaces.
+func answerKeyChanged(old answerKey, q models.Question) bool {
+	return old.QuestionType != q.QuestionType || !sameOptions(old.CorrectOptions, q.CorrectOptions) ||
+		!reflect.DeepEqual(old.Numeric, q.NumericAnswer)
+}
+
+// prepareNumericQuestion validates the numeric answer key of a question and returns it as JSON
+// for questions.numeric_answer. Numeric questions keep empty option arrays since those columns
+// are NOT NULL; questions of other types never carry a numeric answer.
+func prepareNumericQuestion(q *models.Question) (*string, error) {
+	if q.QuestionType != "numeric" {
+		q.NumericAnswer = nil
+		return nil, nil
+	}
+	if q.Options == nil {
+		q.Options = []string{}
+	}
+	if q.CorrectOptions == nil {
+		q.CorrectOptions = []int{}
+	}
+	if q.NumericAnswer == nil {
+		if len(q.CorrectOptions) == 0 {
+			return nil, fmt.Errorf("numeric questions need a numeric_answer")
+		}
+		return nil, nil
+	}
+	if err := normalizeNumericAnswer(q.NumericAnswer); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(q.NumericAnswer)
+	if err != nil {
+		return nil, err
+	}
+	numericJSON := string(encoded)
+	return &numericJSON, nil
+}
@@ -0,0 +1,436 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxReportTextLength = 2000
+
+var reportTypes = map[string]bool{"question": true, "option": true, "explanation": true}
+
+var reportStatuses = map[string]bool{"open": true, "reviewed": true, "resolved": true, "rejected": true}
+
+// reportTransitions lists where a report may go from each status; resolved and rejected are final.
+var reportTransitions = map[string][]string{
+	"open":     {"reviewed", "resolved", "rejected"},
+	"reviewed": {"resolved", "rejected"},
+}
+
+func reportTransitionAllowed(from, to string) bool {
+	for _, next := range reportTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCorrectOptions checks a corrected answer key against the question it is for.
+func validateCorrectOptions(questionType string, nOptions int, correct []int) error {
+	if questionType == "numeric" {
+		return fmt.Errorf("the key of a numeric question is changed by editing the question")
+	}
+	if len(correct) == 0 {
+		return fmt.Errorf("correct_options cannot be empty")
+	}
+	if questionType == "m-choice" && len(correct) != 1 {
+		return fmt.Errorf("m-choice questions have exactly one correct option")
+	}
+	seen := make(map[int]bool)
+	for _, o := range correct {
+		if o < 0 || o >= nOptions {
+			return fmt.Errorf("correct option %d is out of range", o)
+		}
+		if seen[o] {
+			return fmt.Errorf("correct option %d is repeated", o)
+		}
+		seen[o] = true
+	}
+	return nil
+}
+
+func sameOptions(a []int64, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	want := make(map[int64]bool)
+	for _, o := range a {
+		want[o] = true
+	}
+	for _, o := range b {
+		if !want[int64(o)] {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateQuestionReport files a learner's report about a wrong question, option or explanation.
+// When it comes from the review of a test session, option_index is the position the learner saw
+// and is mapped back to questions.options through the session's order_list.
+func CreateQuestionReport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var input struct {
+		QuestionID    int     `json:"question_id"`
+		TestSessionID *string `json:"test_session_id"`
+		ReportType    string  `json:"report_type"`
+		OptionIndex   *int    `json:"option_index"`
+		ReportText    string  `json:"report_text"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	input.ReportText = strings.TrimSpace(input.ReportText)
+	if input.QuestionID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "question_id is required"})
+	}
+	if !reportTypes[input.ReportType] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "report_type must be question, option or explanation"})
+	}
+	if input.ReportText == "" || len(input.ReportText) > maxReportTextLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "report_text is required and must be at most 2000 characters"})
+	}
+	if input.ReportType == "option" && input.OptionIndex == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "option_index is required for option reports"})
+	}
+	if input.ReportType != "option" {
+		input.OptionIndex = nil
+	}
+
+	var nOptions int
+	err := util.DB.QueryRow(`
+		SELECT COALESCE(array_length(options, 1), 0) FROM questions WHERE id = $1 AND deleted <> true`,
+		input.QuestionID).Scan(&nOptions)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question"})
+	}
+
+	if input.TestSessionID != nil {
+		var takenByID int
+		var orderList pq.Int64Array
+		err := util.DB.QueryRow(`
+			SELECT ts.taken_by_id, tsqa.order_list
+			FROM test_session_question_answers tsqa
+			JOIN test_sessions ts ON ts.id = tsqa.test_session_id
+			WHERE tsqa.test_session_id = $1 AND tsqa.question_id = $2`,
+			*input.TestSessionID, input.QuestionID).Scan(&takenByID, &orderList)
+		if err != nil || takenByID != user.ID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The question is not part of your test session"})
+		}
+		if input.OptionIndex != nil {
+			original, err := toOriginalIndices(orderList, []int64{int64(*input.OptionIndex)})
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			index := int(original[0])
+			input.OptionIndex = &index
+		}
+	}
+	if input.OptionIndex != nil && (*input.OptionIndex < 0 || *input.OptionIndex >= nOptions) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "option_index is out of range"})
+	}
+
+	var duplicate bool
+	err = util.DB.QueryRow(`
+		SELECT EXISTS (
+		    SELECT 1 FROM question_error_reports
+		    WHERE reported_by_id = $1 AND question_id = $2 AND report_type = $3
+		      AND option_index IS NOT DISTINCT FROM $4 AND status IN ('open', 'reviewed')
+		)`, user.ID, input.QuestionID, input.ReportType, input.OptionIndex).Scan(&duplicate)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check existing reports"})
+	}
+	if duplicate {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You already have an open report for this"})
+	}
+
+	var reportID int
+	err = util.DB.QueryRow(`
+		INSERT INTO question_error_reports (question_id, reported_by_id, reported_at, report_type, option_index, report_text, test_session_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`, input.QuestionID, user.ID, time.Now().UTC(), input.ReportType, input.OptionIndex,
+		input.ReportText, input.TestSessionID).Scan(&reportID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save report " + err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":    "success",
+		"report_id": reportID,
+	})
+}
+
+const questionReportColumns = `
+	r.id, r.question_id, q.question, q.question_type, q.options, q.correct_options, r.report_type, r.option_index,
+	r.report_text, r.status, r.reported_at, r.reported_by_id, u.name, r.test_session_id, r.resolution_note,
+	r.reviewed_at, r.key_changed`
+
+func scanQuestionReports(rows *sql.Rows) ([]map[string]interface{}, error) {
+	reports := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, questionID, reporterID    int
+			question, questionType        string
+			options                       []string
+			correctOptions                pq.Int64Array
+			reportType, text, status      string
+			optionIndex                   *int
+			reportedAt                    time.Time
+			reporterName                  string
+			testSessionID, resolutionNote *string
+			reviewedAt                    *time.Time
+			keyChanged                    bool
+		)
+		if err := rows.Scan(&id, &questionID, &question, &questionType, pq.Array(&options), &correctOptions,
+			&reportType, &optionIndex, &text, &status, &reportedAt, &reporterID, &reporterName, &testSessionID,
+			&resolutionNote, &reviewedAt, &keyChanged); err != nil {
+			return nil, err
+		}
+		reports = append(reports, map[string]interface{}{
+			"id":              id,
+			"question_id":     questionID,
+			"question":        question,
+			"question_type":   questionType,
+			"options":         options,
+			"correct_options": convertToIntSlice(correctOptions),
+			"report_type":     reportType,
+			"option_index":    optionIndex,
+			"report_text":     text,
+			"status":          status,
+			"reported_at":     reportedAt,
+			"reported_by_id":  reporterID,
+			"reported_by":     reporterName,
+			"test_session_id": testSessionID,
+			"resolution_note": resolutionNote,
+			"reviewed_at":     reviewedAt,
+			"key_changed":     keyChanged,
+		})
+	}
+	return reports, rows.Err()
+}
+
+// GetMyQuestionReports lists the reports the current user has filed, newest first.
+func GetMyQuestionReports(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	rows, err := util.DB.Query(`
+		SELECT `+questionReportColumns+`
+		FROM question_error_reports r
+		JOIN questions q ON q.id = r.question_id
+		JOIN users u ON u.id = r.reported_by_id
+		WHERE r.reported_by_id = $1
+		ORDER BY r.reported_at DESC, r.id DESC`, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reports"})
+	}
+	defer rows.Close()
+	reports, err := scanQuestionReports(rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read reports"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "reports": reports})
+}
+
+// GetQuestionReports is the triage queue: admins see every report, other users the reports on
+// questions they created. status takes a comma separated list and defaults to open,reviewed.
+func GetQuestionReports(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	statuses := strings.Split(c.Query("status", "open,reviewed"), ",")
+	for i, s := range statuses {
+		statuses[i] = strings.TrimSpace(s)
+		if !reportStatuses[statuses[i]] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid status " + statuses[i]})
+		}
+	}
+	where := "r.status = ANY($1)"
+	args := []interface{}{pq.Array(statuses)}
+	if user.Role != "admin" && user.Role != "owner" {
+		args = append(args, user.ID)
+		where += fmt.Sprintf(" AND q.created_by_id = $%d", len(args))
+	}
+	if qid := c.Query("question_id"); qid != "" {
+		id, err := strconv.Atoi(qid)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question_id"})
+		}
+		args = append(args, id)
+		where += fmt.Sprintf(" AND r.question_id = $%d", len(args))
+	}
+
+	var total int
+	if err := util.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM question_error_reports r
+		JOIN questions q ON q.id = r.question_id
+		WHERE `+where, args...).Scan(&total); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count reports"})
+	}
+
+	args = append(args, limit, (page-1)*limit)
+	rows, err := util.DB.Query(`
+		SELECT `+questionReportColumns+`
+		FROM question_error_reports r
+		JOIN questions q ON q.id = r.question_id
+		JOIN users u ON u.id = r.reported_by_id
+		WHERE `+where+fmt.Sprintf(`
+		ORDER BY r.reported_at, r.id
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reports " + err.Error()})
+	}
+	defer rows.Close()
+	reports, err := scanQuestionReports(rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read reports"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"reports": reports,
+	})
+}
+
+// UpdateQuestionReport moves a report through triage. Resolving it may correct the question's
+// answer key at the same time, and with apply_to_past_sessions the corrected key is used to
+// regrade every session that answered the question. The reporter is notified once the report
+// is resolved or rejected.
+func UpdateQuestionReport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	reportID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+	var input struct {
+		Status              string  `json:"status"`
+		ResolutionNote      *string `json:"resolution_note"`
+		CorrectOptions      []int   `json:"correct_options"`
+		ApplyToPastSessions bool    `json:"apply_to_past_sessions"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.CorrectOptions != nil && input.Status != "resolved" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "correct_options can only be sent when resolving a report"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	var (
+		questionID, reporterID, ownerID int
+		status, questionType            string
+		nOptions                        int
+		correctOptions                  pq.Int64Array
+		sharedRole                      *string
+	)
+	err = tx.QueryRow(`
+		SELECT r.question_id, r.reported_by_id, r.status, q.created_by_id, q.question_type,
+		       COALESCE(array_length(q.options, 1), 0), q.correct_options,
+		       (SELECT role FROM user_questions_editors e WHERE e.question_id = q.id AND e.user_id = $2 AND e.status = 'accepted')
+		FROM question_error_reports r
+		JOIN questions q ON q.id = r.question_id
+		WHERE r.id = $1
+		FOR UPDATE OF r`, reportID, user.ID).Scan(&questionID, &reporterID, &status, &ownerID, &questionType, &nOptions, &correctOptions, &sharedRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Report not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch report"})
+	}
+	if !canEditRole(collaboratorRole(ownerID, user, sharedRole)) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the question's author, its editors or an admin can triage its reports"})
+	}
+	if !reportTransitionAllowed(status, input.Status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("A %s report cannot become %s", status, input.Status)})
+	}
+
+	keyChanged := false
+	var regrade *regradeSummary
+	if input.CorrectOptions != nil && !sameOptions(correctOptions, input.CorrectOptions) {
+		if err := validateCorrectOptions(questionType, nOptions, input.CorrectOptions); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		_, before, err := questionRevisions.baseline(tx, questionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record the current version"})
+		}
+		if _, err := tx.Exec(`UPDATE questions SET correct_options = $1, updated_at = $2 WHERE id = $3`,
+			pq.Array(input.CorrectOptions), time.Now(), questionID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update answer key"})
+		}
+		if _, err := questionRevisions.recordChange(tx, questionID, before, "edit", user.ID, nil); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record question version"})
+		}
+		keyChanged = true
+		if input.ApplyToPastSessions {
+			summary, err := regradeQuestion(tx, questionID, regradeReasonReport, user.ID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to regrade past sessions: " + err.Error()})
+			}
+			regrade = &summary
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE question_error_reports
+		SET status = $1, resolution_note = COALESCE($2, resolution_note), reviewed_by_id = $3, reviewed_at = $4,
+		    key_changed = key_changed OR $5
+		WHERE id = $6`, input.Status, input.ResolutionNote, user.ID, time.Now().UTC(), keyChanged, reportID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update report"})
+	}
+
+	if input.Status == "resolved" || input.Status == "rejected" {
+		message := "Your report on question " + strconv.Itoa(questionID) + " was " + input.Status
+		if keyChanged {
+			message += " and its answer key was corrected"
+		}
+		if input.ResolutionNote != nil && strings.TrimSpace(*input.ResolutionNote) != "" {
+			message += ": " + strings.TrimSpace(*input.ResolutionNote)
+		}
+		if err := notifyUser(tx, reporterID, "report_"+input.Status, message, fiber.Map{
+			"report_id":   reportID,
+			"question_id": questionID,
+			"key_changed": keyChanged,
+		}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to notify reporter"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":      "success",
+		"report_id":   reportID,
+		"new_status":  input.Status,
+		"key_changed": keyChanged,
+		"regrade":     regrade,
+	})
+}
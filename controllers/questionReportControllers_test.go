@@ -0,0 +1,43 @@
+package controllers
+
+import "testing"
+
+func TestReportTransitions(t *testing.T) {
+	allowed := [][2]string{{"open", "reviewed"}, {"open", "resolved"}, {"open", "rejected"}, {"reviewed", "resolved"}, {"reviewed", "rejected"}}
+	for _, tr := range allowed {
+		if !reportTransitionAllowed(tr[0], tr[1]) {
+			t.Fatalf("%s -> %s should be allowed", tr[0], tr[1])
+		}
+	}
+	denied := [][2]string{{"reviewed", "open"}, {"resolved", "open"}, {"rejected", "resolved"}, {"open", "open"}, {"open", "closed"}}
+	for _, tr := range denied {
+		if reportTransitionAllowed(tr[0], tr[1]) {
+			t.Fatalf("%s -> %s should be denied", tr[0], tr[1])
+		}
+	}
+}
+
+func TestValidateCorrectOptions(t *testing.T) {
+	cases := []struct {
+		questionType string
+		correct      []int
+		ok           bool
+	}{
+		{"m-choice", []int{2}, true},
+		{"m-choice", []int{0, 1}, false},
+		{"m-select", []int{0, 3}, true},
+		{"m-select", []int{1, 1}, false},
+		{"m-select", []int{4}, false},
+		{"m-select", nil, false},
+		{"numeric", []int{0}, false},
+	}
+	for _, tc := range cases {
+		err := validateCorrectOptions(tc.questionType, 4, tc.correct)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s %v: got error %v", tc.questionType, tc.correct, err)
+		}
+	}
+	if !sameOptions([]int64{2, 0}, []int{0, 2}) || sameOptions([]int64{1}, []int{1, 2}) {
+		t.Fatal("sameOptions should compare keys as sets")
+	}
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// A locked set can still be sampled: a preview session holds its first PREVIEW_QUESTIONS questions.
+const defaultPreviewQuestions = 5
+
+var accessLevels = map[string]bool{"free": true, "premium": true, "paid": true}
+
+// setAccess decides whether viewer may start sessions on a question set, and if not, why:
+// login_required, premium_required or purchase_required. viewer is nil for anonymous requests.
+// granted means the viewer bought the set or collaborates on it; creators and admins can
+// always start their sets.
+func setAccess(accessLevel string, createdByID int, viewer *models.User, granted bool) (bool, string) {
+	if accessLevel == "" || accessLevel == "free" {
+		return true, ""
+	}
+	if viewer == nil {
+		return false, "login_required"
+	}
+	if granted || viewer.ID == createdByID || viewer.Role == "admin" || viewer.Role == "owner" {
+		return true, ""
+	}
+	if accessLevel == "premium" {
+		if viewer.IsPremium {
+			return true, ""
+		}
+		return false, "premium_required"
+	}
+	return false, "purchase_required"
+}
+
+// viewerFrom returns the caller on routes behind OptionalAuth, or nil for anonymous requests.
+func viewerFrom(c *fiber.Ctx) *models.User {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return nil
+	}
+	return &user
+}
+
+// validateSetPricing checks the access level of a question set against its price and
+// normalizes currency. Paid sets need a positive price.
+func validateSetPricing(accessLevel string, price *float64, currency *string) error {
+	if !accessLevels[accessLevel] {
+		return errors.New("access_level must be free, premium or paid")
+	}
+	if price != nil && *price <= 0 {
+		return errors.New("price must be positive")
+	}
+	if accessLevel == "paid" && price == nil {
+		return errors.New("price is required for paid question sets")
+	}
+	if currency != nil {
+		*currency = strings.ToUpper(strings.TrimSpace(*currency))
+		if !currencyPattern.MatchString(*currency) {
+			return errors.New("currency must be a three-letter ISO code")
+		}
+	}
+	return nil
+}
+
+// grantedSets returns which of setIDs userID has bought or collaborates on.
+func grantedSets(db *sql.DB, userID int, setIDs []int) (map[int]bool, error) {
+	rows, err := db.Query(`
+		SELECT question_set_id FROM question_set_purchases
+		WHERE user_id = $1 AND question_set_id = ANY($2)
+		UNION
+		SELECT question_set_id FROM user_questionsets_editors
+		WHERE user_id = $1 AND question_set_id = ANY($2) AND status = 'accepted'`, userID, pq.Array(setIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	granted := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		granted[id] = true
+	}
+	return granted, rows.Err()
+}
+
+// questionSetAccess loads a set and checks it for viewer. It returns sql.ErrNoRows for sets
+// that don't exist or were deleted.
+func questionSetAccess(db *sql.DB, setID int, viewer *models.User) (bool, string, error) {
+	viewerID := 0
+	if viewer != nil {
+		viewerID = viewer.ID
+	}
+	var accessLevel string
+	var createdByID int
+	var granted bool
+	err := db.QueryRow(`
+		SELECT COALESCE(access_level, 'free'), created_by_id,
+		       EXISTS (SELECT 1 FROM question_set_purchases WHERE question_set_id = qs.id AND user_id = $2) OR
+		       EXISTS (SELECT 1 FROM user_questionsets_editors WHERE question_set_id = qs.id AND user_id = $2 AND status = 'accepted')
+		FROM question_sets qs
+		WHERE id = $1 AND deleted <> true`, setID, viewerID).Scan(&accessLevel, &createdByID, &granted)
+	if err != nil {
+		return false, "", err
+	}
+	canStart, reason := setAccess(accessLevel, createdByID, viewer, granted)
+	return canStart, reason, nil
+}
+
+// pricedSet is a premium or paid question set as far as access checks go.
+type pricedSet struct {
+	ID          int
+	AccessLevel string
+	CreatedByID int
+}
+
+// lockedSets returns the IDs of the sets viewer can't start.
+func lockedSets(sets []pricedSet, viewer *models.User, granted map[int]bool) []int {
+	var locked []int
+	for _, s := range sets {
+		if canStart, _ := setAccess(s.AccessLevel, s.CreatedByID, viewer, granted[s.ID]); !canStart {
+			locked = append(locked, s.ID)
+		}
+	}
+	return locked
+}
+
+// lockedSetIDs returns the live premium and paid sets viewer can't start. Sessions drawn from
+// a question pool leave out questions that only appear in these sets.
+func lockedSetIDs(db *sql.DB, viewer *models.User) ([]int, error) {
+	rows, err := db.Query(`
+		SELECT id, access_level, created_by_id FROM question_sets
+		WHERE deleted <> true AND COALESCE(access_level, 'free') <> 'free'`)
+	if err != nil {
+		return nil, err
+	}
+	var sets []pricedSet
+	var ids []int
+	for rows.Next() {
+		var s pricedSet
+		if err := rows.Scan(&s.ID, &s.AccessLevel, &s.CreatedByID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sets = append(sets, s)
+		ids = append(ids, s.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(sets) == 0 {
+		return nil, err
+	}
+
+	granted := map[int]bool{}
+	if viewer != nil {
+		if granted, err = grantedSets(db, viewer.ID, ids); err != nil {
+			return nil, err
+		}
+	}
+	return lockedSets(sets, viewer, granted), nil
+}
+
+// onlyInLockedSetsSQL matches questions q whose every live set is locked. It's a format string
+// taking the placeholder number of the locked set IDs; questions in no set are never locked.
+const onlyInLockedSetsSQL = `EXISTS (
+	SELECT 1 FROM question_set_questions qsq
+	WHERE qsq.question_id = q.id AND qsq.question_set_id = ANY($%[1]d))
+	AND NOT EXISTS (
+	SELECT 1 FROM question_set_questions qsq
+	JOIN question_sets qs ON qs.id = qsq.question_set_id
+	WHERE qsq.question_id = q.id AND qs.deleted <> true AND qsq.question_set_id <> ALL($%[1]d))`
+
+// previewQuestionCount is how many questions a preview session of a locked set holds.
+func previewQuestionCount() int {
+	return envInt("PREVIEW_QUESTIONS", defaultPreviewQuestions)
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"reflect"
+	"testing"
+)
+
+func TestSetAccess(t *testing.T) {
+	member := &models.User{ID: 2, Role: "user"}
+	premium := &models.User{ID: 3, Role: "user", IsPremium: true}
+	admin := &models.User{ID: 4, Role: "admin"}
+	creator := &models.User{ID: 1, Role: "user"}
+
+	cases := []struct {
+		name        string
+		accessLevel string
+		viewer      *models.User
+		granted     bool
+		want        bool
+		reason      string
+	}{
+		{"free for anonymous", "free", nil, false, true, ""},
+		{"premium for anonymous", "premium", nil, false, false, "login_required"},
+		{"premium without subscription", "premium", member, false, false, "premium_required"},
+		{"premium with subscription", "premium", premium, false, true, ""},
+		{"paid without purchase", "paid", premium, false, false, "purchase_required"},
+		{"paid after purchase", "paid", member, true, true, ""},
+		{"premium for a collaborator", "premium", member, true, true, ""},
+		{"paid for its creator", "paid", creator, false, true, ""},
+		{"paid for an admin", "paid", admin, false, true, ""},
+	}
+	for _, tc := range cases {
+		got, reason := setAccess(tc.accessLevel, 1, tc.viewer, tc.granted)
+		if got != tc.want || reason != tc.reason {
+			t.Errorf("%s: got (%v, %q), want (%v, %q)", tc.name, got, reason, tc.want, tc.reason)
+		}
+	}
+}
+
+func TestValidateSetPricing(t *testing.T) {
+	price := 199.0
+	zero := 0.0
+	currency := " usd "
+	if err := validateSetPricing("paid", &price, &currency); err != nil || currency != "USD" {
+		t.Fatalf("a priced paid set should be valid, got %v with currency %q", err, currency)
+	}
+	if err := validateSetPricing("paid", nil, nil); err == nil {
+		t.Fatal("a paid set needs a price")
+	}
+	if err := validateSetPricing("premium", &zero, nil); err == nil {
+		t.Fatal("a price must be positive")
+	}
+	if err := validateSetPricing("gold", nil, nil); err == nil {
+		t.Fatal("unknown access levels should be rejected")
+	}
+}
+
+func TestLockedSets(t *testing.T) {
+	sets := []pricedSet{
+		{ID: 1, AccessLevel: "premium", CreatedByID: 10},
+		{ID: 2, AccessLevel: "paid", CreatedByID: 10},
+		{ID: 3, AccessLevel: "paid", CreatedByID: 2},
+		{ID: 4, AccessLevel: "paid", CreatedByID: 10},
+	}
+	member := &models.User{ID: 2, Role: "user"}
+	premium := &models.User{ID: 3, Role: "user", IsPremium: true}
+
+	if got := lockedSets(sets, nil, nil); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Errorf("anonymous: got %v", got)
+	}
+	if got := lockedSets(sets, member, map[int]bool{4: true}); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("member with a purchase: got %v", got)
+	}
+	if got := lockedSets(sets, premium, nil); !reflect.DeepEqual(got, []int{2, 3, 4}) {
+		t.Errorf("premium: got %v", got)
+	}
+	if got := lockedSets(sets, &models.User{ID: 5, Role: "admin"}, nil); len(got) != 0 {
+		t.Errorf("admin: got %v", got)
+	}
+}
@@ -30,6 +30,12 @@ type CreateQuestionSetInput struct {
 	AccessLevel        *string    `json:"access_level"`
 	CreatorType        *string    `json:"creator_type"`
 	Verified           bool       `json:"verified"`
+	Price              *float64   `json:"price"`
+	Currency           *string    `json:"currency"`
+	// Marking scheme; fields left out keep their default (create) or current value (update).
+	MarkingScheme          *string  `json:"marking_scheme"`
+	NegativeMarkRatio      *float64 `json:"negative_mark_ratio"`
+	UnansweredPenaltyRatio *float64 `json:"unanswered_penalty_ratio"`
 }
 
 func CreateQuestionSet(c *fiber.Ctx) error {
@@ -43,6 +49,13 @@ func CreateQuestionSet(c *fiber.Ctx) error {
 
 	user := c.Locals("user").(models.User)
 
+	scheme, err := mergeMarkingScheme(defaultMarkingScheme, input.MarkingScheme, input.NegativeMarkRatio, input.UnansweredPenaltyRatio)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	tx, err := util.DB.Begin()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -55,6 +68,15 @@ func CreateQuestionSet(c *fiber.Ctx) error {
 		defaultLevel := "free" // Make sure this matches your DB expectations
 		input.AccessLevel = &defaultLevel
 	}
+	if err := validateSetPricing(*input.AccessLevel, input.Price, input.Currency); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if input.Currency == nil {
+		defaultCurrency := "INR"
+		input.Currency = &defaultCurrency
+	}
 	if input.CoverImage == nil {
 		defaultImage := "https://storage.googleapis.com/synapticz-storage/profile_pics/Shiju-P-John-818a221f-d51a-4793-8576-5567da6ff04b.jpg"
 		input.CoverImage = &defaultImage
@@ -64,9 +86,10 @@ func CreateQuestionSet(c *fiber.Ctx) error {
 	insertQS := `
     INSERT INTO question_sets (
         name, mode, subject, exam, language,
-        time_duration, description, associated_resource, created_by_id, cover_image, slug, access_level, creator_type, verified
+        time_duration, description, associated_resource, created_by_id, cover_image, slug, access_level, creator_type, verified,
+        marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, price, currency
     )
-    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10, $11, $12, $13, $14)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
     RETURNING id
 `
 	err = tx.QueryRow(
@@ -85,6 +108,11 @@ func CreateQuestionSet(c *fiber.Ctx) error {
 		input.AccessLevel,
 		input.CreatorType,
 		input.Verified,
+		scheme.MSelectPolicy,
+		scheme.NegativeMarkRatio,
+		scheme.UnansweredPenaltyRatio,
+		input.Price,
+		input.Currency,
 	).Scan(&questionSetID)
 
 	if err != nil {
@@ -169,6 +197,12 @@ func CreateQuestionSet(c *fiber.Ctx) error {
 		}
 	}
 
+	if err := questionSetRevisions.recordCreate(tx, questionSetID, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record question set version: " + err.Error(),
+		})
+	}
+
 	if err := tx.Commit(); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Transaction commit failed: " + err.Error(),
@@ -197,6 +231,9 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 	uid := c.Query("uid")
 	search := c.Query("search")
 	resource := c.Query("resource")
+	minRating := c.Query("min_rating")
+	sortBy := c.Query("sort_by", "created_at")
+	sortOrder := c.Query("sort", "desc")
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "10"))
 
@@ -204,6 +241,11 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 		page = 1
 	}
 	offset := (page - 1) * limit
+	if sortBy != "created_at" && sortBy != "rating" && sortBy != "rating_count" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort_by must be created_at, rating or rating_count",
+		})
+	}
 
 	// Base query for fetching question sets
 	baseQuery := `
@@ -215,9 +257,11 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 				SELECT COUNT(*) 
 				FROM question_set_questions qq 
 				WHERE qq.question_set_id = qs.id
-			) AS total_questions
+			) AS total_questions,
+			rs.average_rating, COALESCE(rs.rating_count, 0), qs.price, qs.currency
 		FROM question_sets qs
 		JOIN users u ON qs.created_by_id = u.id
+		LEFT JOIN (` + questionSetRatingsSQL + `) rs ON rs.question_set_id = qs.id
 		WHERE qs.deleted <> true
 	`
 
@@ -226,6 +270,7 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 		SELECT COUNT(DISTINCT qs.id)
 		FROM question_sets qs
 		JOIN users u ON qs.created_by_id = u.id
+		LEFT JOIN (` + questionSetRatingsSQL + `) rs ON rs.question_set_id = qs.id
 		WHERE qs.deleted <> true
 	`
 
@@ -275,6 +320,18 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 		args = append(args, resource)
 		argID++
 	}
+	if minRating != "" {
+		rating, err := strconv.ParseFloat(minRating, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "min_rating must be a number",
+			})
+		}
+		baseQuery += fmt.Sprintf(" AND rs.average_rating >= $%d", argID)
+		countQuery += fmt.Sprintf(" AND rs.average_rating >= $%d", argID)
+		args = append(args, rating)
+		argID++
+	}
 	if isVerificationPresent {
 		if ver {
 			baseQuery += " AND qs.verified = true"
@@ -336,7 +393,18 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 	}
 
 	// Add sorting and pagination to the base query
-	baseQuery += " ORDER BY qs.created_at DESC"
+	direction := "DESC"
+	if sortOrder == "asc" {
+		direction = "ASC"
+	}
+	switch sortBy {
+	case "rating":
+		baseQuery += " ORDER BY rs.average_rating " + direction + " NULLS LAST, COALESCE(rs.rating_count, 0) DESC, qs.created_at DESC"
+	case "rating_count":
+		baseQuery += " ORDER BY COALESCE(rs.rating_count, 0) " + direction + ", qs.created_at DESC"
+	default:
+		baseQuery += " ORDER BY qs.created_at " + direction
+	}
 	baseQuery += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argID, argID+1)
 	args = append(args, limit, offset)
 
@@ -368,6 +436,12 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 		AccessLevel        *string   `json:"access_level"`
 		CreatorType        *string   `json:"creator_type"`
 		Verified           bool      `json:"verified"`
+		AverageRating      *float64  `json:"average_rating"`
+		RatingCount        int       `json:"rating_count"`
+		Price              *float64  `json:"price"`
+		Currency           string    `json:"currency"`
+		CanStartTest       bool      `json:"can_start_test"`
+		LockedReason       string    `json:"locked_reason,omitempty"`
 	}
 
 	var results []QuestionSetResponse
@@ -397,6 +471,10 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 			&qs.CreatorType,
 			&qs.Verified,
 			&qs.TotalQuestions,
+			&qs.AverageRating,
+			&qs.RatingCount,
+			&qs.Price,
+			&qs.Currency,
 		)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -451,6 +529,25 @@ func GetQuestionSetsHelper(c *fiber.Ctx, isVerificationPresent bool, ver bool) e
 		for i := range results {
 			results[i].QuestionIDs = questionMap[results[i].ID]
 		}
+
+		// Work out which sets the caller can start
+		viewer := viewerFrom(c)
+		granted := map[int]bool{}
+		if viewer != nil {
+			granted, err = grantedSets(util.DB, viewer.ID, setIDs)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to fetch purchases: " + err.Error(),
+				})
+			}
+		}
+		for i := range results {
+			accessLevel := ""
+			if results[i].AccessLevel != nil {
+				accessLevel = *results[i].AccessLevel
+			}
+			results[i].CanStartTest, results[i].LockedReason = setAccess(accessLevel, results[i].CreatedByID, viewer, granted[results[i].ID])
+		}
 	}
 
 	// Calculate pagination info
@@ -497,6 +594,14 @@ func GetQuestionSetByID(c *fiber.Ctx) error {
 		AccessLevel          *string   `json:"access_level"`
 		CreatorType          *string   `json:"creator_type"`
 		Verified             bool      `json:"verified"`
+		MarkingScheme        string    `json:"marking_scheme"`
+		NegativeMarkRatio    float64   `json:"negative_mark_ratio"`
+		UnansweredPenalty    float64   `json:"unanswered_penalty_ratio"`
+		AverageRating        *float64  `json:"average_rating"`
+		RatingCount          int       `json:"rating_count"`
+		CreatedByID          int       `json:"created_by_id"`
+		Price                *float64  `json:"price"`
+		Currency             string    `json:"currency"`
 	}
 
 	query := `
@@ -504,16 +609,21 @@ func GetQuestionSetByID(c *fiber.Ctx) error {
 			qs.id, qs.name, qs.mode, qs.subject, qs.exam, qs.language,
 			qs.time_duration, qs.description, qs.associated_resource,
 			qs.cover_image, qs.created_at, u.name AS created_by_name, qs.access_level,qs.creator_type, qs.verified,
-			(SELECT COUNT(*) FROM test_sessions ts WHERE ts.question_set_id = qs.id) AS test_sessions_taken_count
+			qs.marking_scheme, qs.negative_mark_ratio, qs.unanswered_penalty_ratio,
+			(SELECT COUNT(*) FROM test_sessions ts WHERE ts.question_set_id = qs.id) AS test_sessions_taken_count,
+			rs.average_rating, COALESCE(rs.rating_count, 0), qs.created_by_id, qs.price, qs.currency
 		FROM question_sets qs
 		JOIN users u ON qs.created_by_id = u.id
+		LEFT JOIN (` + questionSetRatingsSQL + `) rs ON rs.question_set_id = qs.id
 		WHERE qs.id = $1
 	`
 
 	err := util.DB.QueryRow(query, id).Scan(
 		&qs.ID, &qs.Name, &qs.Mode, &qs.Subject, &qs.Exam, &qs.Language,
 		&qs.TimeDuration, &qs.Description, &qs.AssociatedResource,
-		&qs.CoverImage, &qs.CreatedAt, &qs.CreatedByName, &qs.AccessLevel, &qs.CreatorType, &qs.Verified, &qs.TestSessionsTakenCnt,
+		&qs.CoverImage, &qs.CreatedAt, &qs.CreatedByName, &qs.AccessLevel, &qs.CreatorType, &qs.Verified,
+		&qs.MarkingScheme, &qs.NegativeMarkRatio, &qs.UnansweredPenalty, &qs.TestSessionsTakenCnt,
+		&qs.AverageRating, &qs.RatingCount, &qs.CreatedByID, &qs.Price, &qs.Currency,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -569,26 +679,56 @@ func GetQuestionSetByID(c *fiber.Ctx) error {
 		}
 	}
 
+	viewer := viewerFrom(c)
+	granted := false
+	if viewer != nil {
+		sets, err := grantedSets(util.DB, viewer.ID, []int{qs.ID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch purchases: " + err.Error(),
+			})
+		}
+		granted = sets[qs.ID]
+	}
+	accessLevel := ""
+	if qs.AccessLevel != nil {
+		accessLevel = *qs.AccessLevel
+	}
+	canStart, lockedReason := setAccess(accessLevel, qs.CreatedByID, viewer, granted)
+	previewQuestions := 0
+	if !canStart {
+		previewQuestions = min(previewQuestionCount(), len(questionIDs))
+	}
+
 	return c.JSON(fiber.Map{
-		"id":                  qs.ID,
-		"name":                qs.Name,
-		"mode":                qs.Mode,
-		"subject":             qs.Subject,
-		"exam":                qs.Exam,
-		"language":            qs.Language,
-		"time_duration":       qs.TimeDuration,
-		"description":         qs.Description,
-		"associated_resource": qs.AssociatedResource,
-		"cover_image":         qs.CoverImage,
-		"created_at":          qs.CreatedAt,
-		"created_by_name":     qs.CreatedByName,
-		"tags":                tags,
-		"test_sessions_taken": qs.TestSessionsTakenCnt,
-		"question_ids":        questionIDs,
-		"access_level":        qs.AccessLevel,
-		"creator_type":        qs.CreatorType,
-		"verified":            qs.Verified,
-		"can_start_test":      true,
+		"id":                       qs.ID,
+		"name":                     qs.Name,
+		"mode":                     qs.Mode,
+		"subject":                  qs.Subject,
+		"exam":                     qs.Exam,
+		"language":                 qs.Language,
+		"time_duration":            qs.TimeDuration,
+		"description":              qs.Description,
+		"associated_resource":      qs.AssociatedResource,
+		"cover_image":              qs.CoverImage,
+		"created_at":               qs.CreatedAt,
+		"created_by_name":          qs.CreatedByName,
+		"tags":                     tags,
+		"test_sessions_taken":      qs.TestSessionsTakenCnt,
+		"question_ids":             questionIDs,
+		"access_level":             qs.AccessLevel,
+		"creator_type":             qs.CreatorType,
+		"verified":                 qs.Verified,
+		"marking_scheme":           qs.MarkingScheme,
+		"negative_mark_ratio":      qs.NegativeMarkRatio,
+		"unanswered_penalty_ratio": qs.UnansweredPenalty,
+		"average_rating":           qs.AverageRating,
+		"rating_count":             qs.RatingCount,
+		"price":                    qs.Price,
+		"currency":                 qs.Currency,
+		"can_start_test":           canStart,
+		"locked_reason":            lockedReason,
+		"preview_questions":        previewQuestions,
 	})
 }
 
@@ -614,7 +754,7 @@ func SoftDeleteQuestionSet(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "Question set not found")
 	}
 
-	// Authorization check
+	// Authorization check - collaborators can edit a set but not delete it
 	if user.Role != "admin" && user.Role != "owner" && qSetOwnerID != user.ID {
 		return fiber.NewError(fiber.StatusForbidden, "You are not allowed to delete this question set")
 	}
@@ -647,11 +787,22 @@ type UpdateQuestionSetInput struct {
 	AccessLevel        *string    `json:"access_level"`
 	CreatorType        *string    `json:"creator_type"`
 	Verified           bool       `json:"verified"`
+	Price              *float64   `json:"price"`
+	Currency           *string    `json:"currency"`
+	// Marking scheme; fields left out keep their default (create) or current value (update).
+	MarkingScheme          *string  `json:"marking_scheme"`
+	NegativeMarkRatio      *float64 `json:"negative_mark_ratio"`
+	UnansweredPenaltyRatio *float64 `json:"unanswered_penalty_ratio"`
 }
 
 func UpdateQuestionSet(c *fiber.Ctx) error {
 	// Get question set ID from path params
-	qSetID := c.Params("id")
+	qSetID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid question set ID",
+		})
+	}
 
 	// Get user from JWT context
 	user := c.Locals("user").(models.User)
@@ -675,10 +826,16 @@ func UpdateQuestionSet(c *fiber.Ctx) error {
 
 	// Check if question set exists and verify ownership
 	var createdByID int
-	err = tx.QueryRow(
-		"SELECT created_by_id FROM question_sets WHERE id = $1 AND deleted <> true",
-		qSetID,
-	).Scan(&createdByID)
+	var scheme markingScheme
+	var accessLevel, currency string
+	var price *float64
+	var sharedRole *string
+	err = tx.QueryRow(`
+		SELECT created_by_id, marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, COALESCE(access_level, 'free'), price, currency,
+		       (SELECT role FROM user_questionsets_editors e WHERE e.question_set_id = question_sets.id AND e.user_id = $2 AND e.status = 'accepted')
+		FROM question_sets WHERE id = $1 AND deleted <> true`,
+		qSetID, user.ID,
+	).Scan(&createdByID, &scheme.MSelectPolicy, &scheme.NegativeMarkRatio, &scheme.UnansweredPenaltyRatio, &accessLevel, &price, &currency, &sharedRole)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -691,12 +848,48 @@ func UpdateQuestionSet(c *fiber.Ctx) error {
 		})
 	}
 
-	// Authorization check - only admin, owner or creator can update
-	if user.Role != "admin" && user.Role != "owner" && createdByID != user.ID {
+	// Authorization check - admin, owner, creator or an editor the set is shared with
+	role := collaboratorRole(createdByID, user, sharedRole)
+	if !canEditRole(role) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "You are not authorized to update this question set",
 		})
 	}
+	// Pricing stays with the set's creator
+	if role != "owner" && ((input.AccessLevel != nil && *input.AccessLevel != accessLevel) ||
+		(input.Price != nil && (price == nil || *input.Price != *price)) ||
+		(input.Currency != nil && !strings.EqualFold(strings.TrimSpace(*input.Currency), currency))) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the set's creator can change its access level or price",
+		})
+	}
+
+	scheme, err = mergeMarkingScheme(scheme, input.MarkingScheme, input.NegativeMarkRatio, input.UnansweredPenaltyRatio)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	// Access level and price left out keep their current values
+	if input.AccessLevel != nil {
+		accessLevel = *input.AccessLevel
+	}
+	if input.Price != nil {
+		price = input.Price
+	}
+	if err := validateSetPricing(accessLevel, price, input.Currency); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Keep the version being replaced; sets from before revisions were kept have none yet
+	_, before, err := questionSetRevisions.baseline(tx, qSetID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record the current version: " + err.Error(),
+		})
+	}
 
 	// Update question set details
 	updateQuery := `
@@ -714,9 +907,13 @@ func UpdateQuestionSet(c *fiber.Ctx) error {
 			access_level = $10,
 			slug = $11,
 			creator_type=$12,
-			verified=$13
-		
-		WHERE id = $14
+			verified=$13,
+			marking_scheme = $14,
+			negative_mark_ratio = $15,
+			unanswered_penalty_ratio = $16,
+			price = $17,
+			currency = COALESCE($18, currency)
+		WHERE id = $19
 	`
 
 	_, err = tx.Exec(
@@ -730,10 +927,15 @@ func UpdateQuestionSet(c *fiber.Ctx) error {
 		input.Description,
 		input.AssociatedResource,
 		input.CoverImage,
-		input.AccessLevel,
+		accessLevel,
 		input.Slug,
 		input.CreatorType,
 		input.Verified,
+		scheme.MSelectPolicy,
+		scheme.NegativeMarkRatio,
+		scheme.UnansweredPenaltyRatio,
+		price,
+		input.Currency,
 		qSetID,
 	)
 	if err != nil {
@@ -742,98 +944,25 @@ func UpdateQuestionSet(c *fiber.Ctx) error {
 		})
 	}
 
-	// Handle questions update
-	// First, delete existing questions
-	_, err = tx.Exec("DELETE FROM question_set_questions WHERE question_set_id = $1", qSetID)
-	if err != nil {
+	// Replace questions and tags
+	if err := replaceSetQuestions(tx, qSetID, input.QuestionIDs, input.Marks); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to remove existing questions: " + err.Error(),
+			"error": "Failed to update questions: " + err.Error(),
 		})
 	}
-
-	// Then add new questions
-	if len(input.QuestionIDs) > 0 {
-		markSlice := []float64{}
-		if input.Marks != nil && len(*input.Marks) == len(input.QuestionIDs) {
-			markSlice = *input.Marks
-			insertQ := `
-				INSERT INTO question_set_questions (question_set_id, question_id, mark)
-				VALUES ($1, $2, $3)
-			`
-			for i, qid := range input.QuestionIDs {
-				_, err := tx.Exec(insertQ, qSetID, qid, markSlice[i])
-				if err != nil {
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-						"error": "Failed to associate question: " + err.Error(),
-					})
-				}
-			}
-		} else {
-			insertQ := `
-				INSERT INTO question_set_questions (question_set_id, question_id)
-				VALUES ($1, $2)
-			`
-			for _, qid := range input.QuestionIDs {
-				_, err := tx.Exec(insertQ, qSetID, qid)
-				if err != nil {
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-						"error": "Failed to associate question: " + err.Error(),
-					})
-				}
-			}
-		}
+	if err := replaceSetTags(tx, qSetID, input.Tags); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update tags: " + err.Error(),
+		})
 	}
 
-	// Handle tags update
-	// First, delete existing tags
-	_, err = tx.Exec("DELETE FROM questionsets_questionsettags WHERE questionset_id = $1", qSetID)
+	version, err := questionSetRevisions.recordChange(tx, qSetID, before, "edit", user.ID, nil)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to remove existing tags: " + err.Error(),
+			"error": "Failed to record question set version: " + err.Error(),
 		})
 	}
 
-	// Then add new tags
-	if len(input.Tags) > 0 {
-		getOrInsertTag := `
-			INSERT INTO questionsettags (name)
-			VALUES ($1)
-			ON CONFLICT (name) DO NOTHING
-			RETURNING id
-		`
-		getTagID := `
-			SELECT id FROM questionsettags WHERE name = $1
-		`
-		insertTagRelation := `
-			INSERT INTO questionsets_questionsettags (questionset_id, questionsettags_id)
-			VALUES ($1, $2)
-			ON CONFLICT DO NOTHING
-		`
-
-		for _, tag := range input.Tags {
-			var tagID int
-			// First try to insert tag and get ID
-			err = tx.QueryRow(getOrInsertTag, tag).Scan(&tagID)
-
-			if err == sql.ErrNoRows {
-				// Tag existed, so get ID
-				err = tx.QueryRow(getTagID, tag).Scan(&tagID)
-			}
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to insert/retrieve tag: " + err.Error(),
-				})
-			}
-
-			_, err = tx.Exec(insertTagRelation, qSetID, tagID)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to link tag to question set: " + err.Error(),
-				})
-			}
-		}
-	}
-
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -843,5 +972,61 @@ func UpdateQuestionSet(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Question set updated successfully",
+		"version": version,
 	})
 }
+
+// replaceSetQuestions makes questionIDs the questions of a set. Marks apply when there is one
+// per question; otherwise every question gets the default mark.
+func replaceSetQuestions(tx *sql.Tx, setID int, questionIDs []int, marks *[]float64) error {
+	if _, err := tx.Exec("DELETE FROM question_set_questions WHERE question_set_id = $1", setID); err != nil {
+		return fmt.Errorf("failed to remove existing questions: %w", err)
+	}
+	for i, qid := range questionIDs {
+		var err error
+		if marks != nil && len(*marks) == len(questionIDs) {
+			_, err = tx.Exec(`
+				INSERT INTO question_set_questions (question_set_id, question_id, mark)
+				VALUES ($1, $2, $3)`, setID, qid, (*marks)[i])
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO question_set_questions (question_set_id, question_id)
+				VALUES ($1, $2)`, setID, qid)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to associate question: %w", err)
+		}
+	}
+	return nil
+}
+
+// replaceSetTags makes tags the tags of a set, creating any that don't exist yet.
+func replaceSetTags(tx *sql.Tx, setID int, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM questionsets_questionsettags WHERE questionset_id = $1", setID); err != nil {
+		return fmt.Errorf("failed to remove existing tags: %w", err)
+	}
+	for _, tag := range tags {
+		var tagID int
+		// First try to insert tag and get ID
+		err := tx.QueryRow(`
+			INSERT INTO questionsettags (name)
+			VALUES ($1)
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id`, tag).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			// Tag existed, so get ID
+			err = tx.QueryRow(`SELECT id FROM questionsettags WHERE name = $1`, tag).Scan(&tagID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to insert/retrieve tag: %w", err)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO questionsets_questionsettags (questionset_id, questionsettags_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, setID, tagID)
+		if err != nil {
+			return fmt.Errorf("failed to link tag to question set: %w", err)
+		}
+	}
+	return nil
+}
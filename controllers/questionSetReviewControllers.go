@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxReviewTextLength = 2000
+
+// questionSetRatingsSQL aggregates the visible reviews of every question set; hidden reviews
+// don't count towards a set's rating.
+const questionSetRatingsSQL = `
+	SELECT question_set_id, AVG(rating)::float AS average_rating, COUNT(*) AS rating_count
+	FROM question_set_reviews
+	WHERE NOT hidden
+	GROUP BY question_set_id`
+
+type questionSetReviewInput struct {
+	Rating int     `json:"rating"`
+	Review *string `json:"review"`
+}
+
+func (in *questionSetReviewInput) validate() error {
+	if in.Rating < 1 || in.Rating > 5 {
+		return fmt.Errorf("rating must be between 1 and 5")
+	}
+	if in.Review != nil {
+		text := strings.TrimSpace(*in.Review)
+		if len(text) > maxReviewTextLength {
+			return fmt.Errorf("review must be at most %d characters", maxReviewTextLength)
+		}
+		if text == "" {
+			in.Review = nil
+		} else {
+			in.Review = &text
+		}
+	}
+	return nil
+}
+
+// reviewSortOrders maps the sort query parameter of the review listing to its ORDER BY.
+var reviewSortOrders = map[string]string{
+	"newest":  "r.created_at DESC, r.id DESC",
+	"highest": "r.rating DESC, r.created_at DESC, r.id DESC",
+	"lowest":  "r.rating ASC, r.created_at DESC, r.id DESC",
+}
+
+// CreateQuestionSetReview posts the current user's review of a set. Only learners who have
+// finished a session on the set may review it, once; later changes go through UpdateQuestionSetReview.
+func CreateQuestionSetReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	setID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question set ID"})
+	}
+	var input questionSetReviewInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var exists, finishedOne bool
+	err = util.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM question_sets WHERE id = $1 AND deleted <> true),
+		       EXISTS (SELECT 1 FROM test_sessions WHERE question_set_id = $1 AND taken_by_id = $2 AND finished)`,
+		setID, user.ID).Scan(&exists, &finishedOne)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check question set"})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question set not found"})
+	}
+	if !finishedOne {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Finish a test on this question set before reviewing it"})
+	}
+
+	var reviewID int
+	now := time.Now().UTC()
+	err = util.DB.QueryRow(`
+		INSERT INTO question_set_reviews (question_set_id, user_id, rating, review, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (question_set_id, user_id) DO NOTHING
+		RETURNING id`, setID, user.ID, input.Rating, input.Review, now).Scan(&reviewID)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You have already reviewed this question set"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review " + err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":    "success",
+		"review_id": reviewID,
+	})
+}
+
+func UpdateQuestionSetReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	setID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question set ID"})
+	}
+	var input questionSetReviewInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	res, err := util.DB.Exec(`
+		UPDATE question_set_reviews
+		SET rating = $1, review = $2, updated_at = $3
+		WHERE question_set_id = $4 AND user_id = $5`, input.Rating, input.Review, time.Now().UTC(), setID, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update review"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Review not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Review updated"})
+}
+
+func DeleteQuestionSetReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	setID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question set ID"})
+	}
+	res, err := util.DB.Exec(`DELETE FROM question_set_reviews WHERE question_set_id = $1 AND user_id = $2`, setID, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete review"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Review not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Review deleted"})
+}
+
+// GetQuestionSetReviews lists the visible reviews of a set with its rating summary.
+// sort is newest (default), highest or lowest.
+func GetQuestionSetReviews(c *fiber.Ctx) error {
+	setID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid question set ID"})
+	}
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	orderBy, ok := reviewSortOrders[c.Query("sort", "newest")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort must be newest, highest or lowest"})
+	}
+
+	var average *float64
+	var count int
+	distribution := map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}
+	rows, err := util.DB.Query(`
+		SELECT rating, COUNT(*)
+		FROM question_set_reviews
+		WHERE question_set_id = $1 AND NOT hidden
+		GROUP BY rating`, setID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch ratings"})
+	}
+	sum := 0
+	for rows.Next() {
+		var rating, n int
+		if err := rows.Scan(&rating, &n); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read ratings"})
+		}
+		distribution[rating] = n
+		count += n
+		sum += rating * n
+	}
+	rows.Close()
+	if count > 0 {
+		avg := float64(sum) / float64(count)
+		average = &avg
+	}
+
+	rows, err = util.DB.Query(`
+		SELECT r.id, r.user_id, u.name, u.profile_pic, r.rating, r.review, r.created_at, r.updated_at
+		FROM question_set_reviews r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.question_set_id = $1 AND NOT r.hidden
+		ORDER BY `+orderBy+`
+		LIMIT $2 OFFSET $3`, setID, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+	defer rows.Close()
+
+	reviews := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, userID, rating   int
+			userName             string
+			profilePic, review   *string
+			createdAt, updatedAt time.Time
+		)
+		if err := rows.Scan(&id, &userID, &userName, &profilePic, &rating, &review, &createdAt, &updatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read review"})
+		}
+		reviews = append(reviews, map[string]interface{}{
+			"id":          id,
+			"user_id":     userID,
+			"user_name":   userName,
+			"profile_pic": profilePic,
+			"rating":      rating,
+			"review":      review,
+			"created_at":  createdAt,
+			"updated_at":  updatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":              "success",
+		"page":                page,
+		"limit":               limit,
+		"average_rating":      average,
+		"rating_count":        count,
+		"rating_distribution": distribution,
+		"reviews":             reviews,
+	})
+}
+
+// ModerateQuestionSetReview lets an admin hide or restore a review, or delete it outright.
+func ModerateQuestionSetReview(c *fiber.Ctx) error {
+	currentUser := c.Locals("user").(models.User)
+	if currentUser.Role != "admin" && currentUser.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Only admins can access this endpoint",
+		})
+	}
+	reviewID, err := c.ParamsInt("review_id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid review ID"})
+	}
+
+	var res sql.Result
+	if c.Method() == fiber.MethodDelete {
+		res, err = util.DB.Exec(`DELETE FROM question_set_reviews WHERE id = $1`, reviewID)
+	} else {
+		var input struct {
+			Hidden bool    `json:"hidden"`
+			Reason *string `json:"reason"`
+		}
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		res, err = util.DB.Exec(`
+			UPDATE question_set_reviews
+			SET hidden = $1, moderation_reason = $2, moderated_by_id = $3, moderated_at = $4
+			WHERE id = $5`, input.Hidden, input.Reason, currentUser.ID, time.Now().UTC(), reviewID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to moderate review"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Review not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Review moderated"})
+}
+
+// GetReviewsForModeration lists reviews across all sets for admins, hidden ones included.
+// hidden=true or hidden=false narrows the list.
+func GetReviewsForModeration(c *fiber.Ctx) error {
+	currentUser := c.Locals("user").(models.User)
+	if currentUser.Role != "admin" && currentUser.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Only admins can access this endpoint",
+		})
+	}
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	where := "TRUE"
+	args := []interface{}{}
+	if hidden := c.Query("hidden"); hidden != "" {
+		args = append(args, hidden == "true")
+		where = "r.hidden = $1"
+	}
+	args = append(args, limit, (page-1)*limit)
+
+	rows, err := util.DB.Query(`
+		SELECT r.id, r.question_set_id, qs.name, r.user_id, u.name, r.rating, r.review, r.created_at,
+		       r.hidden, r.moderation_reason
+		FROM question_set_reviews r
+		JOIN question_sets qs ON qs.id = r.question_set_id
+		JOIN users u ON u.id = r.user_id
+		WHERE `+where+fmt.Sprintf(`
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+	defer rows.Close()
+
+	reviews := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id, setID, userID, rating int
+			setName, userName         string
+			review, reason            *string
+			createdAt                 time.Time
+			hidden                    bool
+		)
+		if err := rows.Scan(&id, &setID, &setName, &userID, &userName, &rating, &review, &createdAt, &hidden, &reason); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read review"})
+		}
+		reviews = append(reviews, map[string]interface{}{
+			"id":                id,
+			"question_set_id":   setID,
+			"question_set_name": setName,
+			"user_id":           userID,
+			"user_name":         userName,
+			"rating":            rating,
+			"review":            review,
+			"created_at":        createdAt,
+			"hidden":            hidden,
+			"moderation_reason": reason,
+		})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "page": page, "limit": limit, "reviews": reviews})
+}
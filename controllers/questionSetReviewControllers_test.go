@@ -0,0 +1,22 @@
+package controllers
+
+import "testing"
+
+func TestQuestionSetReviewInputValidate(t *testing.T) {
+	blank := "   "
+	in := questionSetReviewInput{Rating: 4, Review: &blank}
+	if err := in.validate(); err != nil || in.Review != nil {
+		t.Fatalf("a blank review should be dropped, got %v %v", err, in.Review)
+	}
+	text := "  Clear questions  "
+	in = questionSetReviewInput{Rating: 5, Review: &text}
+	if err := in.validate(); err != nil || *in.Review != "Clear questions" {
+		t.Fatalf("review should be trimmed, got %v %q", err, *in.Review)
+	}
+	for _, rating := range []int{0, 6} {
+		in := questionSetReviewInput{Rating: rating}
+		if err := in.validate(); err == nil {
+			t.Fatalf("rating %d should be rejected", rating)
+		}
+	}
+}
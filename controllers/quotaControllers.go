@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultFreeDailyQuestions = 20
+	maxQuotaGrantDays         = 365
+)
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// dailyQuota is how many questions a user may answer on their current local day.
+type dailyQuota struct {
+	Limit     *int      `json:"limit"` // nil when unlimited
+	Used      int       `json:"used"`
+	Remaining *int      `json:"remaining"`
+	Source    string    `json:"source"` // grant, plan, premium or free
+	PlanID    *int      `json:"plan_id,omitempty"`
+	PlanName  *string   `json:"plan_name,omitempty"`
+	Date      string    `json:"date"`
+	Timezone  string    `json:"timezone"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// allows reports whether n more answers fit in the quota.
+func (q dailyQuota) allows(n int) bool {
+	return q.Limit == nil || q.Used+n <= *q.Limit
+}
+
+// resolveDailyLimit picks the most specific limit: an admin grant for the day, then the
+// active plan (a plan without a limit is unlimited), then the free default. Premium
+// granted without a plan is unlimited.
+func resolveDailyLimit(grant *int, isPremium bool, hasPlan bool, planLimit *int) (*int, string) {
+	if grant != nil {
+		return grant, "grant"
+	}
+	if isPremium {
+		if hasPlan {
+			return planLimit, "plan"
+		}
+		return nil, "premium"
+	}
+	free := envInt("FREE_DAILY_QUESTIONS", defaultFreeDailyQuestions)
+	return &free, "free"
+}
+
+// localDay returns the calendar date of now in the user's timezone and the UTC instants
+// the day starts and ends at. Unknown timezones count as UTC.
+func localDay(now time.Time, timezone string) (string, time.Time, time.Time, string) {
+	name, loc, err := resolveTimezone(timezone)
+	if err != nil {
+		name, loc = "UTC", time.UTC
+	}
+	end := endOfLocalDay(now, loc)
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return local.Format("2006-01-02"), start.UTC(), end.UTC(), name
+}
+
+// loadDailyQuota works out a user's quota and usage for their current day.
+func loadDailyQuota(db queryRower, user models.User, now time.Time) (dailyQuota, error) {
+	var quota dailyQuota
+	var start time.Time
+	quota.Date, start, quota.ResetsAt, quota.Timezone = localDay(now, user.Timezone)
+
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM user_daily_questions
+		WHERE user_id = $1 AND answered_at >= $2 AND answered_at < $3`, user.ID, start, quota.ResetsAt).Scan(&quota.Used)
+	if err != nil {
+		return quota, err
+	}
+
+	var grant *int
+	err = db.QueryRow(`
+		SELECT questions_limit FROM user_daily_activity
+		WHERE user_id = $1 AND activity_date = $2`, user.ID, quota.Date).Scan(&grant)
+	if err != nil && err != sql.ErrNoRows {
+		return quota, err
+	}
+
+	var planLimit *int
+	hasPlan := false
+	if user.IsPremium && grant == nil {
+		var planID int
+		var planName string
+		err = db.QueryRow(`
+			SELECT sp.id, COALESCE(sp.name, ''), sp.question_limit_per_day
+			FROM payments p
+			JOIN subscription_plans sp ON sp.id = p.plan_id
+			WHERE p.user_id = $1 AND p.payment_status = 'success'
+			ORDER BY p.paid_at DESC, p.id DESC
+			LIMIT 1`, user.ID).Scan(&planID, &planName, &planLimit)
+		if err != nil && err != sql.ErrNoRows {
+			return quota, err
+		}
+		if err == nil {
+			hasPlan = true
+			quota.PlanID, quota.PlanName = &planID, &planName
+		}
+	}
+
+	quota.Limit, quota.Source = resolveDailyLimit(grant, user.IsPremium, hasPlan, planLimit)
+	if quota.Limit != nil {
+		remaining := max(*quota.Limit-quota.Used, 0)
+		quota.Remaining = &remaining
+	}
+	return quota, nil
+}
+
+// lockDailyQuota loads the user's quota inside tx after locking their row, so answers sent in
+// parallel (from one session or several) are counted one request at a time.
+func lockDailyQuota(tx *sql.Tx, user models.User, now time.Time) (dailyQuota, error) {
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, user.ID); err != nil {
+		return dailyQuota{}, err
+	}
+	return loadDailyQuota(tx, user, now)
+}
+
+// quotaExceeded is the error sent when answers don't fit in the day's quota. It carries the
+// quota and the plans that would lift it, so the client can offer an upgrade.
+func quotaExceeded(c *fiber.Ctx, quota dailyQuota) error {
+	limit := 0
+	if quota.Limit != nil {
+		limit = *quota.Limit
+	}
+	upgrades := []map[string]interface{}{}
+	rows, err := util.DB.Query(`
+		SELECT `+planColumns+` FROM subscription_plans
+		WHERE active AND (question_limit_per_day IS NULL OR question_limit_per_day > $1)
+		ORDER BY price, id`, limit)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			plan, err := scanPlan(rows)
+			if err != nil {
+				break
+			}
+			upgrades = append(upgrades, plan)
+		}
+	}
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":         fmt.Sprintf("Daily question limit reached (%d/%d)", quota.Used, limit),
+		"code":          "daily_quota_exceeded",
+		"quota":         quota,
+		"upgrade_plans": upgrades,
+	})
+}
+
+// GetDailyQuota reports the caller's question quota and usage for today.
+func GetDailyQuota(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	quota, err := loadDailyQuota(util.DB, user, time.Now().UTC())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load quota"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "quota": quota})
+}
+
+// GrantDailyQuota sets a user's question limit for a run of days, starting today in their
+// timezone unless a date is given. A grant replaces the plan or free limit on those days.
+func GrantDailyQuota(c *fiber.Ctx) error {
+	admin := c.Locals("user").(models.User)
+	if admin.Role != "admin" && admin.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Only admins can grant quotas"})
+	}
+	userID, err := strconv.Atoi(c.Params("uid"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	var input struct {
+		QuestionsLimit *int   `json:"questions_limit"`
+		Date           string `json:"date"` // YYYY-MM-DD
+		Days           int    `json:"days"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.QuestionsLimit == nil || *input.QuestionsLimit < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "questions_limit must be zero or more"})
+	}
+	if input.Days == 0 {
+		input.Days = 1
+	}
+	if input.Days < 0 || input.Days > maxQuotaGrantDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("days must be between 1 and %d", maxQuotaGrantDays)})
+	}
+
+	var timezone string
+	err = util.DB.QueryRow(`SELECT timezone FROM users WHERE id = $1 AND deleted = false`, userID).Scan(&timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	if input.Date == "" {
+		input.Date, _, _, _ = localDay(time.Now().UTC(), timezone)
+	} else if _, err := time.Parse("2006-01-02", input.Date); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+
+	_, err = util.DB.Exec(`
+		INSERT INTO user_daily_activity (user_id, activity_date, questions_limit, limit_granted_at)
+		SELECT $1, d::date, $2, now()
+		FROM generate_series($3::date, $3::date + ($4::int - 1), INTERVAL '1 day') d
+		ON CONFLICT (user_id, activity_date) DO UPDATE
+		SET questions_limit = EXCLUDED.questions_limit, limit_granted_at = EXCLUDED.limit_granted_at`,
+		userID, *input.QuestionsLimit, input.Date, input.Days)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to grant quota"})
+	}
+	return c.JSON(fiber.Map{
+		"status":          "success",
+		"user_id":         userID,
+		"questions_limit": *input.QuestionsLimit,
+		"from":            input.Date,
+		"days":            input.Days,
+	})
+}
+
+// RevokeDailyQuota drops a user's grants from today on, so their plan or the free limit
+// applies again.
+func RevokeDailyQuota(c *fiber.Ctx) error {
+	admin := c.Locals("user").(models.User)
+	if admin.Role != "admin" && admin.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Only admins can revoke quotas"})
+	}
+	userID, err := strconv.Atoi(c.Params("uid"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	var timezone string
+	err = util.DB.QueryRow(`SELECT timezone FROM users WHERE id = $1`, userID).Scan(&timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	today, _, _, _ := localDay(time.Now().UTC(), timezone)
+	res, err := util.DB.Exec(`
+		UPDATE user_daily_activity SET questions_limit = NULL, limit_granted_at = NULL
+		WHERE user_id = $1 AND activity_date >= $2 AND questions_limit IS NOT NULL`, userID, today)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke quota"})
+	}
+	n, _ := res.RowsAffected()
+	return c.JSON(fiber.Map{"status": "success", "revoked_days": n})
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveDailyLimit(t *testing.T) {
+	grant, planLimit := 50, 200
+
+	if limit, source := resolveDailyLimit(&grant, true, true, &planLimit); source != "grant" || *limit != 50 {
+		t.Errorf("a grant should win, got %v %s", limit, source)
+	}
+	if limit, source := resolveDailyLimit(nil, true, true, &planLimit); source != "plan" || *limit != 200 {
+		t.Errorf("the plan limit should apply, got %v %s", limit, source)
+	}
+	if limit, source := resolveDailyLimit(nil, true, true, nil); source != "plan" || limit != nil {
+		t.Errorf("a plan without a limit is unlimited, got %v %s", limit, source)
+	}
+	if limit, source := resolveDailyLimit(nil, true, false, nil); source != "premium" || limit != nil {
+		t.Errorf("premium without a plan is unlimited, got %v %s", limit, source)
+	}
+	if limit, source := resolveDailyLimit(nil, false, true, &planLimit); source != "free" || *limit != defaultFreeDailyQuestions {
+		t.Errorf("without premium the free limit applies, got %v %s", limit, source)
+	}
+}
+
+func TestLocalDay(t *testing.T) {
+	// 20:00 UTC is already the next day in Kolkata (UTC+5:30).
+	now := time.Date(2025, 3, 9, 20, 0, 0, 0, time.UTC)
+	date, start, end, tz := localDay(now, "Asia/Calcutta")
+	if date != "2025-03-10" || tz != "Asia/Kolkata" {
+		t.Fatalf("got %s in %s", date, tz)
+	}
+	if want := time.Date(2025, 3, 9, 18, 30, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start, want)
+	}
+	if want := time.Date(2025, 3, 10, 18, 30, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end, want)
+	}
+
+	if date, _, _, tz := localDay(now, "Nowhere/Invalid"); date != "2025-03-09" || tz != "UTC" {
+		t.Errorf("unknown timezones should fall back to UTC, got %s in %s", date, tz)
+	}
+}
+
+func TestDailyQuotaAllows(t *testing.T) {
+	limit := 20
+	quota := dailyQuota{Limit: &limit, Used: 18}
+	if !quota.allows(2) || quota.allows(3) {
+		t.Error("18 of 20 used should leave room for exactly two more")
+	}
+	if !(dailyQuota{Used: 1000}).allows(50) {
+		t.Error("an unlimited quota allows anything")
+	}
+}
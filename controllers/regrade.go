@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Why a regrade ran; stored on regrade_runs so learners can see what changed their score.
+const (
+	regradeReasonAdmin         = "admin"
+	regradeReasonKeyCorrection = "key_correction"
+	regradeReasonReport        = "report"
+)
+
+// regradeSummary reports how far a corrected answer key reached into past sessions.
+type regradeSummary struct {
+	RegradeID       int `json:"regrade_id"`
+	QuestionID      int `json:"question_id"`
+	AnswersRegraded int `json:"answers_regraded"`
+	SessionsChanged int `json:"sessions_changed"`
+	RanksChanged    int `json:"ranks_changed"`
+}
+
+// sessionRegrade is the audit record of one session touched by a regrade. Sessions that were
+// only re-ranked have no question marks.
+type sessionRegrade struct {
+	OldQuestionMark *float64
+	NewQuestionMark *float64
+	OldScoredMarks  float64
+	NewScoredMarks  float64
+	OldRank         *int
+	NewRank         *int
+	userID          int
+	sessionName     string
+}
+
+// regradeQuestion grades every stored answer to a question again against its current answer key,
+// using each session's own marking scheme, selections and order_list. Unanswered questions of
+// finished sessions keep the unanswered penalty they got at finish. Session totals are summed
+// again, finished sessions are re-ranked within their question sets, and every session whose
+// score or rank moved gets an audit row and its learner a notification.
+func regradeQuestion(tx *sql.Tx, questionID int, reason string, triggeredByID int) (regradeSummary, error) {
+	summary := regradeSummary{QuestionID: questionID}
+
+	var key answerKey
+	var correctOptions pq.Int64Array
+	var numericJSON []byte
+	var version int
+	err := tx.QueryRow(`
+		SELECT question_type, options, correct_options, numeric_answer, version
+		FROM questions
+		WHERE id = $1
+		FOR UPDATE`, questionID).Scan(&key.QuestionType, pq.Array(&key.Options), &correctOptions, &numericJSON, &version)
+	if err != nil {
+		return summary, err
+	}
+	key.CorrectOptions = correctOptions
+	if key.Numeric, err = parseNumericAnswerJSON(numericJSON); err != nil {
+		return summary, fmt.Errorf("failed to read numeric answer key: %w", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO regrade_runs (question_id, reason, triggered_by_id, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, questionID, reason, triggeredByID, time.Now().UTC()).Scan(&summary.RegradeID)
+	if err != nil {
+		return summary, fmt.Errorf("failed to record regrade: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT tsqa.test_session_id, tsqa.order_list, tsqa.selected_answer_list, tsqa.numeric_answer, tsqa.answered,
+		       COALESCE(tsqa.questions_total_mark, 0), COALESCE(tsqa.questions_scored_mark, 0), tsqa.answered_correct,
+		       ts.marking_scheme, ts.negative_mark_ratio, ts.unanswered_penalty_ratio
+		FROM test_session_question_answers tsqa
+		JOIN test_sessions ts ON ts.id = tsqa.test_session_id
+		WHERE tsqa.question_id = $1 AND (tsqa.answered OR NOT ts.finished)
+		FOR UPDATE OF tsqa, ts`, questionID)
+	if err != nil {
+		return summary, err
+	}
+	audit := make(map[string]*sessionRegrade)
+	verdicts := make(map[string]bool)
+	for rows.Next() {
+		var (
+			sessionID      string
+			orderList      pq.Int64Array
+			selected       pq.Int64Array
+			answer         submittedAnswer
+			totalMark, old float64
+			scheme         markingScheme
+			oldCorrect     sql.NullBool
+		)
+		if err := rows.Scan(&sessionID, &orderList, &selected, &answer.NumericAnswer, &answer.Answered, &totalMark, &old, &oldCorrect,
+			&scheme.MSelectPolicy, &scheme.NegativeMarkRatio, &scheme.UnansweredPenaltyRatio); err != nil {
+			rows.Close()
+			return summary, err
+		}
+		answer.Selected = selected
+		summary.AnswersRegraded++
+
+		scored, correct, err := gradeAnswer(key, orderList, answer, totalMark, scheme)
+		if err != nil {
+			// A selection that no longer fits the options (e.g. an option was removed) earns nothing.
+			scored = 0
+		}
+		if !answer.Answered && scored < 0 {
+			scored = 0
+		}
+		if !oldCorrect.Valid || oldCorrect.Bool != correct {
+			verdicts[sessionID] = correct
+		}
+		if scored != old {
+			oldMark, newMark := old, scored
+			audit[sessionID] = &sessionRegrade{OldQuestionMark: &oldMark, NewQuestionMark: &newMark}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	// Every answer looked at is now graded against the current version, whether or not its mark moved.
+	_, err = tx.Exec(`
+		UPDATE test_session_question_answers tsqa
+		SET question_version = $2
+		FROM test_sessions ts
+		WHERE ts.id = tsqa.test_session_id AND tsqa.question_id = $1 AND (tsqa.answered OR NOT ts.finished)`,
+		questionID, version)
+	if err != nil {
+		return summary, err
+	}
+	for sessionID, correct := range verdicts {
+		if _, err := tx.Exec(`
+			UPDATE test_session_question_answers
+			SET answered_correct = $1
+			WHERE test_session_id = $2 AND question_id = $3`, correct, sessionID, questionID); err != nil {
+			return summary, err
+		}
+	}
+	if len(audit) == 0 {
+		return summary, nil
+	}
+
+	sessionIDs := make([]string, 0, len(audit))
+	for sessionID, a := range audit {
+		sessionIDs = append(sessionIDs, sessionID)
+		if _, err := tx.Exec(`
+			UPDATE test_session_question_answers
+			SET questions_scored_mark = $1
+			WHERE test_session_id = $2 AND question_id = $3`, *a.NewQuestionMark, sessionID, questionID); err != nil {
+			return summary, err
+		}
+	}
+	summary.SessionsChanged = len(audit)
+
+	// The FROM subqueries see the rows as they were before each UPDATE, which gives the old values.
+	scoreRows, err := tx.Query(`
+		UPDATE test_sessions ts
+		SET scored_marks = s.scored
+		FROM (
+		    SELECT t.id, t.scored_marks AS old_scored, t.rank AS old_rank, COALESCE(SUM(a.questions_scored_mark), 0) AS scored
+		    FROM test_sessions t
+		    JOIN test_session_question_answers a ON a.test_session_id = t.id
+		    WHERE t.id = ANY($1::uuid[])
+		    GROUP BY t.id
+		) s
+		WHERE ts.id = s.id
+		RETURNING ts.id, COALESCE(s.old_scored, 0), ts.scored_marks, s.old_rank, ts.taken_by_id, ts.name`, pq.Array(sessionIDs))
+	if err != nil {
+		return summary, fmt.Errorf("failed to update session scores: %w", err)
+	}
+	for scoreRows.Next() {
+		var sessionID string
+		var oldScored, newScored float64
+		var oldRank *int
+		var userID int
+		var sessionName string
+		if err := scoreRows.Scan(&sessionID, &oldScored, &newScored, &oldRank, &userID, &sessionName); err != nil {
+			scoreRows.Close()
+			return summary, err
+		}
+		a := audit[sessionID]
+		a.userID, a.sessionName = userID, sessionName
+		a.OldScoredMarks, a.NewScoredMarks = oldScored, newScored
+		a.OldRank, a.NewRank = oldRank, oldRank
+	}
+	scoreRows.Close()
+
+	rankRows, err := tx.Query(`
+		UPDATE test_sessions ts
+		SET rank = r.rank
+		FROM (
+		    SELECT id, rank AS old_rank, COALESCE(scored_marks, 0) AS scored,
+		           RANK() OVER (PARTITION BY question_set_id ORDER BY scored_marks DESC) AS rank
+		    FROM test_sessions
+		    WHERE finished AND selection_mode = 'fixed' AND question_set_id IN (
+		        SELECT question_set_id FROM test_sessions
+		        WHERE id = ANY($1::uuid[]) AND finished AND selection_mode = 'fixed'
+		    )
+		) r
+		WHERE ts.id = r.id AND ts.rank IS DISTINCT FROM r.rank
+		RETURNING ts.id, r.old_rank, ts.rank, r.scored`, pq.Array(sessionIDs))
+	if err != nil {
+		return summary, fmt.Errorf("failed to re-rank sessions: %w", err)
+	}
+	for rankRows.Next() {
+		var sessionID string
+		var oldRank, newRank *int
+		var scored float64
+		if err := rankRows.Scan(&sessionID, &oldRank, &newRank, &scored); err != nil {
+			rankRows.Close()
+			return summary, err
+		}
+		summary.RanksChanged++
+		a, ok := audit[sessionID]
+		if !ok {
+			a = &sessionRegrade{OldScoredMarks: scored, NewScoredMarks: scored}
+			audit[sessionID] = a
+		}
+		a.OldRank, a.NewRank = oldRank, newRank
+	}
+	rankRows.Close()
+
+	for sessionID, a := range audit {
+		_, err := tx.Exec(`
+			INSERT INTO test_session_regrades (regrade_id, test_session_id, question_id, old_question_mark, new_question_mark,
+			                                   old_scored_marks, new_scored_marks, old_rank, new_rank)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			summary.RegradeID, sessionID, questionID, a.OldQuestionMark, a.NewQuestionMark,
+			a.OldScoredMarks, a.NewScoredMarks, a.OldRank, a.NewRank)
+		if err != nil {
+			return summary, fmt.Errorf("failed to record session regrade: %w", err)
+		}
+		if a.NewQuestionMark == nil {
+			continue
+		}
+		message := fmt.Sprintf("Your score in %s changed from %g to %g after the answer key of question %d was corrected",
+			a.sessionName, a.OldScoredMarks, a.NewScoredMarks, questionID)
+		if err := notifyUser(tx, a.userID, "session_regraded", message, fiber.Map{
+			"test_session_id": sessionID,
+			"question_id":     questionID,
+			"regrade_id":      summary.RegradeID,
+		}); err != nil {
+			return summary, fmt.Errorf("failed to notify learner: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE regrade_runs SET answers_regraded = $1, sessions_changed = $2, ranks_changed = $3
+		WHERE id = $4`, summary.AnswersRegraded, summary.SessionsChanged, summary.RanksChanged, summary.RegradeID); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// RegradeQuestions lets an admin regrade past sessions for the given questions against their
+// current answer keys, e.g. after fixing keys directly in the database.
+func RegradeQuestions(c *fiber.Ctx) error {
+	currentUser := c.Locals("user").(models.User)
+	if currentUser.Role != "admin" && currentUser.Role != "owner" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Only admins can access this endpoint",
+		})
+	}
+	var input struct {
+		QuestionIDs []int `json:"question_ids"`
+	}
+	if err := c.BodyParser(&input); err != nil || len(input.QuestionIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "question_ids is required"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	summaries := make([]regradeSummary, 0, len(input.QuestionIDs))
+	for _, qid := range input.QuestionIDs {
+		summary, err := regradeQuestion(tx, qid, regradeReasonAdmin, currentUser.ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("Question %d not found", qid)})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("Failed to regrade question %d: %v", qid, err)})
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "regrades": summaries})
+}
+
+// GetTestSessionRegrades lists the regrades that changed a session's score or rank, newest first.
+func GetTestSessionRegrades(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	testSessionID := c.Params("test_session_id")
+
+	var takenByID int
+	if err := util.DB.QueryRow(`SELECT taken_by_id FROM test_sessions WHERE id = $1`, testSessionID).Scan(&takenByID); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Test session not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch test session"})
+	}
+	if allowed, err := canViewTestSession(user.ID, testSessionID, takenByID); err != nil || !allowed {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	rows, err := util.DB.Query(`
+		SELECT r.id, r.reason, r.created_at, tsr.question_id, tsr.old_question_mark, tsr.new_question_mark,
+		       tsr.old_scored_marks, tsr.new_scored_marks, tsr.old_rank, tsr.new_rank
+		FROM test_session_regrades tsr
+		JOIN regrade_runs r ON r.id = tsr.regrade_id
+		WHERE tsr.test_session_id = $1
+		ORDER BY r.created_at DESC, r.id DESC`, testSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch regrades"})
+	}
+	defer rows.Close()
+
+	regrades := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			regradeID, questionID int
+			reason                string
+			regradedAt            time.Time
+			a                     sessionRegrade
+		)
+		if err := rows.Scan(&regradeID, &reason, &regradedAt, &questionID, &a.OldQuestionMark, &a.NewQuestionMark,
+			&a.OldScoredMarks, &a.NewScoredMarks, &a.OldRank, &a.NewRank); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read regrade"})
+		}
+		regrades = append(regrades, map[string]interface{}{
+			"regrade_id":        regradeID,
+			"reason":            reason,
+			"regraded_at":       regradedAt,
+			"question_id":       questionID,
+			"old_question_mark": a.OldQuestionMark,
+			"new_question_mark": a.NewQuestionMark,
+			"old_scored_marks":  a.OldScoredMarks,
+			"new_scored_marks":  a.NewScoredMarks,
+			"old_rank":          a.OldRank,
+			"new_rank":          a.NewRank,
+		})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "regrades": regrades})
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	defaultReviewQueueLimit   = 50
+	defaultReviewSessionLimit = 20
+	maxReviewSessionLimit     = 100
+)
+
+type reviewQueueItem struct {
+	QuestionID   int       `json:"question_id"`
+	Question     string    `json:"question"`
+	Subject      string    `json:"subject"`
+	QuestionType string    `json:"question_type"`
+	Source       string    `json:"source"` // scheduled, bookmark or missed
+	DueAt        time.Time `json:"due_at"`
+	Repetitions  int       `json:"repetitions"`
+	IntervalDays int       `json:"interval_days"`
+	EaseFactor   float64   `json:"ease_factor"`
+}
+
+// loadReviewQueue lists the questions due before cutoff, most overdue first. Questions without a
+// review state yet are seeded from the user's bookmarks and from questions whose latest answer
+// was wrong.
+func loadReviewQueue(userID int, cutoff time.Time, limit int) ([]reviewQueueItem, int, error) {
+	rows, err := util.DB.Query(`
+		WITH scheduled AS (
+		    SELECT question_id, due_at, 'scheduled' AS source, repetitions, interval_days, ease_factor
+		    FROM review_states
+		    WHERE user_id = $1 AND due_at < $2
+		), bookmarked AS (
+		    SELECT b.question_id, b.bookmarked_at AS due_at, 'bookmark' AS source, 0 AS repetitions, 0 AS interval_days, $4::float AS ease_factor
+		    FROM bookmarked_questions b
+		    WHERE b.user_id = $1
+		      AND NOT EXISTS (SELECT 1 FROM review_states rs WHERE rs.user_id = $1 AND rs.question_id = b.question_id)
+		), missed AS (
+		    SELECT question_id, answered_at AS due_at, 'missed' AS source, 0 AS repetitions, 0 AS interval_days, $4::float AS ease_factor
+		    FROM (
+		        SELECT DISTINCT ON (question_id) question_id, answered_at, answered_correct
+		        FROM user_daily_questions
+		        WHERE user_id = $1
+		        ORDER BY question_id, answered_at DESC
+		    ) latest
+		    WHERE NOT answered_correct
+		      AND NOT EXISTS (SELECT 1 FROM review_states rs WHERE rs.user_id = $1 AND rs.question_id = latest.question_id)
+		      AND NOT EXISTS (SELECT 1 FROM bookmarked_questions b WHERE b.user_id = $1 AND b.question_id = latest.question_id)
+		), queue AS (
+		    SELECT * FROM scheduled
+		    UNION ALL SELECT * FROM bookmarked
+		    UNION ALL SELECT * FROM missed
+		)
+		SELECT queue.question_id, q.question, q.subject, q.question_type, queue.source, queue.due_at,
+		       queue.repetitions, queue.interval_days, queue.ease_factor, COUNT(*) OVER ()
+		FROM queue
+		JOIN questions q ON q.id = queue.question_id AND q.deleted <> true
+		ORDER BY queue.due_at, queue.question_id
+		LIMIT $3`, userID, cutoff.UTC(), limit, defaultEaseFactor)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []reviewQueueItem{}
+	total := 0
+	for rows.Next() {
+		var item reviewQueueItem
+		if err := rows.Scan(&item.QuestionID, &item.Question, &item.Subject, &item.QuestionType, &item.Source,
+			&item.DueAt, &item.Repetitions, &item.IntervalDays, &item.EaseFactor, &total); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+// endOfLocalDay returns the start of tomorrow in loc, i.e. the cutoff for "due today".
+func endOfLocalDay(now time.Time, loc *time.Location) time.Time {
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+}
+
+func GetDueReviews(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	_, tzLoc, err := resolveTimezone(c.Query("tz", user.Timezone))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid timezone"})
+	}
+	limit := c.QueryInt("limit", defaultReviewQueueLimit)
+	if limit < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be at least 1"})
+	}
+
+	cutoff := endOfLocalDay(time.Now(), tzLoc)
+	items, total, err := loadReviewQueue(user.ID, cutoff, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review queue: " + err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"status":    "success",
+		"due_count": total,
+		"due_until": cutoff,
+		"questions": items,
+	})
+}
+
+// StartReviewSession creates an untimed test session from the front of the user's due queue.
+func StartReviewSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	_, tzLoc, err := resolveTimezone(c.Query("tz", user.Timezone))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid timezone"})
+	}
+	limit := c.QueryInt("limit", defaultReviewSessionLimit)
+	if limit < 1 || limit > maxReviewSessionLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+
+	now := time.Now()
+	items, _, err := loadReviewQueue(user.ID, endOfLocalDay(now, tzLoc), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review queue: " + err.Error()})
+	}
+	if len(items) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nothing is due for review"})
+	}
+	questionIDs := make([]int, len(items))
+	for i, item := range items {
+		questionIDs[i] = item.QuestionID
+	}
+
+	rows, err := util.DB.Query(`
+		SELECT id, COALESCE(array_length(options, 1), 0), question_type
+		FROM questions
+		WHERE id = ANY($1)`, pq.Array(questionIDs))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch questions"})
+	}
+	byID := make(map[int]sessionQuestion)
+	for rows.Next() {
+		q := sessionQuestion{Mark: 1}
+		if err := rows.Scan(&q.ID, &q.NOptions, &q.QuestionType); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read question"})
+		}
+		byID[q.ID] = q
+	}
+	rows.Close()
+	questions := make([]sessionQuestion, 0, len(questionIDs))
+	for _, id := range questionIDs {
+		questions = append(questions, byID[id])
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to begin transaction"})
+	}
+	defer tx.Rollback()
+
+	name := "Review " + now.In(tzLoc).Format("2006-01-02")
+	sessionID, err := insertTestSession(tx, newTestSession{
+		Name:       name,
+		SourceType: "review",
+		UserID:     user.ID,
+		Mode:       "untimed",
+		Scheme:     defaultMarkingScheme,
+	}, questions)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create test session " + err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":       "success",
+		"test_session": sessionID,
+		"question_ids": questionIDs,
+		"question_set": name,
+	})
+}
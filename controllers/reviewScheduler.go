@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// Review scheduling follows SM-2: every graded answer is turned into a recall quality from
+// 0 to 5, which moves the question's interval and ease factor. A quality below 3 is a lapse
+// and starts the question over at a one-day interval.
+const (
+	defaultEaseFactor = 2.5
+	minEaseFactor     = 1.3
+)
+
+// answerOutcome is how a newly answered question was graded.
+type answerOutcome struct {
+	Correct        bool
+	ScoredFraction float64
+}
+
+type reviewState struct {
+	EaseFactor   float64
+	IntervalDays int
+	Repetitions  int
+	Lapses       int
+}
+
+func newReviewState() reviewState {
+	return reviewState{EaseFactor: defaultEaseFactor}
+}
+
+// reviewQuality grades an answer for scheduling: fully correct answers are a confident recall,
+// partially correct ones a failed but familiar one.
+func reviewQuality(correct bool, scoredFraction float64) int {
+	switch {
+	case correct:
+		return 4
+	case scoredFraction > 0:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// schedule applies one review of the given quality and returns the new state and due time.
+func (s reviewState) schedule(quality int, now time.Time) (reviewState, time.Time) {
+	if quality >= 3 {
+		switch s.Repetitions {
+		case 0:
+			s.IntervalDays = 1
+		case 1:
+			s.IntervalDays = 6
+		default:
+			s.IntervalDays = int(math.Round(float64(s.IntervalDays) * s.EaseFactor))
+		}
+		s.Repetitions++
+	} else {
+		s.Repetitions = 0
+		s.IntervalDays = 1
+		s.Lapses++
+	}
+	miss := float64(5 - quality)
+	s.EaseFactor = math.Max(minEaseFactor, s.EaseFactor+0.1-miss*(0.08+miss*0.02))
+	return s, now.AddDate(0, 0, s.IntervalDays)
+}
+
+// recordReview updates a user's review state for a question after a graded answer.
+func recordReview(tx *sql.Tx, userID, questionID, quality int, now time.Time) error {
+	state := newReviewState()
+	err := tx.QueryRow(`
+		SELECT ease_factor, interval_days, repetitions, lapses
+		FROM review_states
+		WHERE user_id = $1 AND question_id = $2
+		FOR UPDATE`, userID, questionID).Scan(&state.EaseFactor, &state.IntervalDays, &state.Repetitions, &state.Lapses)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	now = now.UTC()
+	next, dueAt := state.schedule(quality, now)
+	_, err = tx.Exec(`
+		INSERT INTO review_states (user_id, question_id, ease_factor, interval_days, repetitions, lapses,
+		                           last_quality, last_reviewed_at, due_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, question_id) DO UPDATE
+		SET ease_factor = EXCLUDED.ease_factor,
+		    interval_days = EXCLUDED.interval_days,
+		    repetitions = EXCLUDED.repetitions,
+		    lapses = EXCLUDED.lapses,
+		    last_quality = EXCLUDED.last_quality,
+		    last_reviewed_at = EXCLUDED.last_reviewed_at,
+		    due_at = EXCLUDED.due_at`,
+		userID, questionID, next.EaseFactor, next.IntervalDays, next.Repetitions, next.Lapses,
+		quality, now, dueAt)
+	return err
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReviewScheduleSM2(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := newReviewState()
+
+	var due time.Time
+	wantIntervals := []int{1, 6, 15}
+	for i, want := range wantIntervals {
+		s, due = s.schedule(4, now)
+		if s.IntervalDays != want || s.Repetitions != i+1 {
+			t.Fatalf("review %d: got interval %d, repetitions %d", i+1, s.IntervalDays, s.Repetitions)
+		}
+	}
+	if !due.Equal(now.AddDate(0, 0, 15)) {
+		t.Fatalf("unexpected due date %v", due)
+	}
+	if s.EaseFactor != defaultEaseFactor {
+		t.Fatalf("quality 4 should keep the ease factor, got %v", s.EaseFactor)
+	}
+
+	s, due = s.schedule(reviewQuality(false, 0), now)
+	if s.IntervalDays != 1 || s.Repetitions != 0 || s.Lapses != 1 {
+		t.Fatalf("a lapse should restart the schedule, got %+v", s)
+	}
+	if s.EaseFactor >= defaultEaseFactor || !due.Equal(now.AddDate(0, 0, 1)) {
+		t.Fatalf("unexpected state after lapse %+v due %v", s, due)
+	}
+
+	for i := 0; i < 10; i++ {
+		s, _ = s.schedule(0, now)
+	}
+	if s.EaseFactor != minEaseFactor {
+		t.Fatalf("ease factor should bottom out at %v, got %v", minEaseFactor, s.EaseFactor)
+	}
+}
+
+func TestEndOfLocalDay(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	// 20:00 UTC is already 01:30 the next day in Kolkata.
+	now := time.Date(2025, 3, 1, 20, 0, 0, 0, time.UTC)
+	want := time.Date(2025, 3, 2, 18, 30, 0, 0, time.UTC)
+	if got := endOfLocalDay(now, kolkata); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got.UTC(), want)
+	}
+}
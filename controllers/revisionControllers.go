@@ -0,0 +1,630 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Every create, edit and restore of a question or question set stores a snapshot of it under
+// a new version number, with who made the change. Items that existed before revisions were
+// kept get their state stored as a baseline on their first edit.
+
+// revisionScope is one kind of versioned item and the table its revisions live in. Access
+// decides who may read and restore the history: the item's creator and collaborators.
+type revisionScope struct {
+	Kind      string
+	Label     string
+	ItemTable string
+	Table     string
+	Column    string
+	Snapshot  func(db queryRower, id int) (interface{}, int, error) // the item as it is now and its version
+	Access    collaborationScope
+}
+
+var (
+	questionSetRevisions = revisionScope{
+		Kind:      "question_set",
+		Label:     "question set",
+		ItemTable: "question_sets",
+		Table:     "question_set_revisions",
+		Column:    "question_set_id",
+		Snapshot:  loadQuestionSetSnapshot,
+		Access:    questionSetCollaboration,
+	}
+	questionRevisions = revisionScope{
+		Kind:      "question",
+		Label:     "question",
+		ItemTable: "questions",
+		Table:     "question_revisions",
+		Column:    "question_id",
+		Snapshot:  loadQuestionSnapshot,
+		Access:    questionCollaboration,
+	}
+)
+
+// questionSnapshot is a question as it stood at one version.
+type questionSnapshot struct {
+	Question       string                `json:"question"`
+	Subject        string                `json:"subject"`
+	Exam           *string               `json:"exam"`
+	Language       string                `json:"language"`
+	Difficulty     *int                  `json:"difficulty"`
+	QuestionType   string                `json:"question_type"`
+	Options        []string              `json:"options"`
+	CorrectOptions []int64               `json:"correct_options"`
+	NumericAnswer  *models.NumericAnswer `json:"numeric_answer"`
+	Explanation    *string               `json:"explanation"`
+	Tags           []string              `json:"tags"`
+}
+
+// setMember is a question in a question set and the marks it carries there.
+type setMember struct {
+	QuestionID int     `json:"question_id"`
+	Mark       float64 `json:"mark"`
+}
+
+// questionSetSnapshot is a question set's content, pricing and membership at one version.
+// Verification and creator type are moderation state and are not versioned.
+type questionSetSnapshot struct {
+	Name                   string      `json:"name"`
+	Mode                   string      `json:"mode"`
+	Subject                string      `json:"subject"`
+	Exam                   *string     `json:"exam"`
+	Language               string      `json:"language"`
+	TimeDuration           *string     `json:"time_duration"`
+	Description            *string     `json:"description"`
+	AssociatedResource     *string     `json:"associated_resource"`
+	CoverImage             *string     `json:"cover_image"`
+	Slug                   *string     `json:"slug"`
+	AccessLevel            string      `json:"access_level"`
+	MarkingScheme          string      `json:"marking_scheme"`
+	NegativeMarkRatio      float64     `json:"negative_mark_ratio"`
+	UnansweredPenaltyRatio float64     `json:"unanswered_penalty_ratio"`
+	Price                  *float64    `json:"price"`
+	Currency               string      `json:"currency"`
+	Tags                   []string    `json:"tags"`
+	Questions              []setMember `json:"questions"`
+}
+
+func loadQuestionSnapshot(db queryRower, id int) (interface{}, int, error) {
+	var snap questionSnapshot
+	var version int
+	var numericJSON []byte
+	err := db.QueryRow(`
+		SELECT q.question, q.subject, q.exam, q.language, q.difficulty, q.question_type, q.options,
+		       q.correct_options, q.numeric_answer, q.explanation,
+		       ARRAY(SELECT t.name FROM question_questiontags qt
+		             JOIN questiontags t ON t.id = qt.questiontags_id
+		             WHERE qt.question_id = q.id ORDER BY t.name),
+		       q.version
+		FROM questions q
+		WHERE q.id = $1`, id).Scan(&snap.Question, &snap.Subject, &snap.Exam, &snap.Language, &snap.Difficulty,
+		&snap.QuestionType, pq.Array(&snap.Options), pq.Array(&snap.CorrectOptions), &numericJSON, &snap.Explanation,
+		pq.Array(&snap.Tags), &version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if snap.NumericAnswer, err = parseNumericAnswerJSON(numericJSON); err != nil {
+		return nil, 0, err
+	}
+	return snap, version, nil
+}
+
+func loadQuestionSetSnapshot(db queryRower, id int) (interface{}, int, error) {
+	var snap questionSetSnapshot
+	var version int
+	var members []byte
+	err := db.QueryRow(`
+		SELECT t.name, t.mode, t.subject, t.exam, t.language, t.time_duration, t.description,
+		       t.associated_resource, t.cover_image, t.slug, COALESCE(t.access_level, 'free'),
+		       t.marking_scheme, t.negative_mark_ratio, t.unanswered_penalty_ratio, t.price, t.currency,
+		       ARRAY(SELECT g.name FROM questionsets_questionsettags l
+		             JOIN questionsettags g ON g.id = l.questionsettags_id
+		             WHERE l.questionset_id = t.id ORDER BY g.name),
+		       (SELECT COALESCE(json_agg(json_build_object('question_id', m.question_id, 'mark', COALESCE(m.mark, 1))
+		                                 ORDER BY m.question_id), '[]')
+		        FROM question_set_questions m WHERE m.question_set_id = t.id),
+		       t.version
+		FROM question_sets t
+		WHERE t.id = $1`, id).Scan(&snap.Name, &snap.Mode, &snap.Subject, &snap.Exam, &snap.Language,
+		&snap.TimeDuration, &snap.Description, &snap.AssociatedResource, &snap.CoverImage, &snap.Slug,
+		&snap.AccessLevel, &snap.MarkingScheme, &snap.NegativeMarkRatio, &snap.UnansweredPenaltyRatio,
+		&snap.Price, &snap.Currency, pq.Array(&snap.Tags), &members, &version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := json.Unmarshal(members, &snap.Questions); err != nil {
+		return nil, 0, err
+	}
+	return snap, version, nil
+}
+
+// snapshot returns the item's current version and its state as JSON.
+func (s revisionScope) snapshot(db queryRower, id int) (int, []byte, error) {
+	snap, version, err := s.Snapshot(db, id)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := json.Marshal(snap)
+	return version, data, err
+}
+
+func (s revisionScope) insertRevision(tx *sql.Tx, id, version int, data []byte, action string, editorID, restoredFrom *int) error {
+	_, err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (%s, version, snapshot, action, restored_from, edited_by_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (%s, version) DO NOTHING`, s.Table, s.Column, s.Column),
+		id, version, string(data), action, restoredFrom, editorID, time.Now().UTC())
+	return err
+}
+
+// recordCreate stores a new item as its first version.
+func (s revisionScope) recordCreate(tx *sql.Tx, id, editorID int) error {
+	version, data, err := s.snapshot(tx, id)
+	if err != nil {
+		return err
+	}
+	return s.insertRevision(tx, id, version, data, "create", &editorID, nil)
+}
+
+// baseline locks an item for an edit and returns its version and state beforehand. The state
+// is stored as a baseline revision when that version has none yet.
+func (s revisionScope) baseline(tx *sql.Tx, id int) (int, []byte, error) {
+	var version int
+	err := tx.QueryRow(fmt.Sprintf(`SELECT version FROM %s WHERE id = $1 FOR UPDATE`, s.ItemTable), id).Scan(&version)
+	if err != nil {
+		return 0, nil, err
+	}
+	version, data, err := s.snapshot(tx, id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, data, s.insertRevision(tx, id, version, data, "baseline", nil, nil)
+}
+
+// recordChange stores the item under a new version if it no longer matches before, and
+// returns the version it is at afterwards.
+func (s revisionScope) recordChange(tx *sql.Tx, id int, before []byte, action string, editorID int, restoredFrom *int) (int, error) {
+	version, data, err := s.snapshot(tx, id)
+	if err != nil || bytes.Equal(data, before) {
+		return version, err
+	}
+	err = tx.QueryRow(fmt.Sprintf(`UPDATE %s SET version = version + 1 WHERE id = $1 RETURNING version`, s.ItemTable), id).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, s.insertRevision(tx, id, version, data, action, &editorID, restoredFrom)
+}
+
+// revisionSnapshot returns the stored state of one version, or sql.ErrNoRows.
+func (s revisionScope) revisionSnapshot(db queryRower, id, version int) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow(fmt.Sprintf(`SELECT snapshot FROM %s WHERE %s = $1 AND version = $2`, s.Table, s.Column),
+		id, version).Scan(&data)
+	return data, err
+}
+
+// viewableItem parses the :id of an item and checks that the caller may see its history. On
+// failure it sends the response and returns an empty role.
+func (s revisionScope) viewableItem(c *fiber.Ctx) (int, string, error) {
+	user := c.Locals("user").(models.User)
+	id, role, status, msg := s.Access.itemFromParams(c, user)
+	if status != 0 {
+		return 0, "", c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if role == "" {
+		return 0, "", c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the " + s.Label + "'s creator and collaborators can see its history"})
+	}
+	return id, role, nil
+}
+
+func (s revisionScope) listRevisions(c *fiber.Ctx) error {
+	id, role, err := s.viewableItem(c)
+	if role == "" {
+		return err
+	}
+	var current int
+	if err := util.DB.QueryRow(fmt.Sprintf(`SELECT version FROM %s WHERE id = $1`, s.ItemTable), id).Scan(&current); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch " + s.Label})
+	}
+
+	rows, err := util.DB.Query(fmt.Sprintf(`
+		SELECT r.version, r.action, r.restored_from, r.edited_by_id, u.name, r.created_at
+		FROM %s r
+		LEFT JOIN users u ON u.id = r.edited_by_id
+		WHERE r.%s = $1
+		ORDER BY r.version DESC`, s.Table, s.Column), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revisions"})
+	}
+	defer rows.Close()
+
+	revisions := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			version      int
+			action       string
+			restoredFrom *int
+			editedByID   *int
+			editedByName *string
+			createdAt    time.Time
+		)
+		if err := rows.Scan(&version, &action, &restoredFrom, &editedByID, &editedByName, &createdAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read revision"})
+		}
+		revisions = append(revisions, map[string]interface{}{
+			"version":        version,
+			"action":         action,
+			"restored_from":  restoredFrom,
+			"edited_by_id":   editedByID,
+			"edited_by_name": editedByName,
+			"created_at":     createdAt,
+		})
+	}
+	return c.JSON(fiber.Map{"status": "success", "current_version": current, "revisions": revisions})
+}
+
+func (s revisionScope) getRevision(c *fiber.Ctx) error {
+	id, role, err := s.viewableItem(c)
+	if role == "" {
+		return err
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid version"})
+	}
+	data, err := s.revisionSnapshot(util.DB, id, version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Revision not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revision"})
+	}
+	return c.JSON(fiber.Map{"status": "success", s.Column: id, "version": version, "snapshot": json.RawMessage(data)})
+}
+
+// fieldChange is one field that differs between two versions.
+type fieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// diffSnapshots lists the fields that differ between two snapshots, by name, leaving out
+// the fields in skip.
+func diffSnapshots(from, to []byte, skip ...string) ([]fieldChange, error) {
+	var a, b map[string]interface{}
+	if err := json.Unmarshal(from, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, err
+	}
+	for _, field := range skip {
+		delete(a, field)
+		delete(b, field)
+	}
+	fields := make([]string, 0, len(a)+len(b))
+	for field := range a {
+		fields = append(fields, field)
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []fieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(a[field], b[field]) {
+			changes = append(changes, fieldChange{Field: field, From: a[field], To: b[field]})
+		}
+	}
+	return changes, nil
+}
+
+// markChange is a question whose marks in a set changed between two versions.
+type markChange struct {
+	QuestionID int     `json:"question_id"`
+	From       float64 `json:"from"`
+	To         float64 `json:"to"`
+}
+
+// membershipDiff compares the questions of two versions of a set.
+func membershipDiff(from, to []setMember) (added, removed []int, marks []markChange) {
+	added, removed, marks = []int{}, []int{}, []markChange{}
+	old := make(map[int]float64, len(from))
+	for _, m := range from {
+		old[m.QuestionID] = m.Mark
+	}
+	for _, m := range to {
+		mark, ok := old[m.QuestionID]
+		switch {
+		case !ok:
+			added = append(added, m.QuestionID)
+		case mark != m.Mark:
+			marks = append(marks, markChange{QuestionID: m.QuestionID, From: mark, To: m.Mark})
+		}
+		delete(old, m.QuestionID)
+	}
+	for questionID := range old {
+		removed = append(removed, questionID)
+	}
+	sort.Ints(added)
+	sort.Ints(removed)
+	sort.Slice(marks, func(i, j int) bool { return marks[i].QuestionID < marks[j].QuestionID })
+	return added, removed, marks
+}
+
+// diffRevisions compares two versions, ?from (default: the one before ?to) and ?to
+// (default: the current one).
+func (s revisionScope) diffRevisions(c *fiber.Ctx) error {
+	id, role, err := s.viewableItem(c)
+	if role == "" {
+		return err
+	}
+	to := c.QueryInt("to", 0)
+	if to == 0 {
+		if err := util.DB.QueryRow(fmt.Sprintf(`SELECT version FROM %s WHERE id = $1`, s.ItemTable), id).Scan(&to); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch " + s.Label})
+		}
+	}
+	from := c.QueryInt("from", to-1)
+
+	snapshots := make([][]byte, 2)
+	for i, version := range []int{from, to} {
+		snapshots[i], err = s.revisionSnapshot(util.DB, id, version)
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("Version %d not found", version)})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revision"})
+		}
+	}
+
+	response := fiber.Map{"status": "success", s.Column: id, "from": from, "to": to}
+	if s.Kind == "question_set" {
+		var a, b questionSetSnapshot
+		if json.Unmarshal(snapshots[0], &a) != nil || json.Unmarshal(snapshots[1], &b) != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read revision"})
+		}
+		added, removed, marks := membershipDiff(a.Questions, b.Questions)
+		response["questions"] = fiber.Map{"added": added, "removed": removed, "marks_changed": marks}
+		response["changes"], err = diffSnapshots(snapshots[0], snapshots[1], "questions")
+	} else {
+		response["changes"], err = diffSnapshots(snapshots[0], snapshots[1])
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compare revisions"})
+	}
+	return c.JSON(response)
+}
+
+// pendingRestore is a restore under way: the version being restored, the caller's role on the
+// item, and the item's state before the restore.
+type pendingRestore struct {
+	ID       int
+	Version  int
+	Role     string
+	Tx       *sql.Tx
+	Revision []byte
+	Before   []byte
+}
+
+// startRestore checks that the caller may edit the item and begins the transaction that
+// restores it. On failure it sends the response and returns nil.
+func (s revisionScope) startRestore(c *fiber.Ctx) (*pendingRestore, error) {
+	user := c.Locals("user").(models.User)
+	id, role, status, msg := s.Access.itemFromParams(c, user)
+	if status != 0 {
+		return nil, c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if !canEditRole(role) {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the " + s.Label + "'s creator, its editors or an admin can restore it"})
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid version"})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	r := &pendingRestore{ID: id, Version: version, Role: role, Tx: tx}
+	if _, r.Before, err = s.baseline(tx, id); err != nil {
+		tx.Rollback()
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record the current version"})
+	}
+	if r.Revision, err = s.revisionSnapshot(tx, id, version); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Revision not found"})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revision"})
+	}
+	return r, nil
+}
+
+// RestoreQuestionRevision puts a question back to an earlier version, as a new version. Past
+// sessions are regraded when that changes the answer key, unless ?regrade=false.
+func RestoreQuestionRevision(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	r, err := questionRevisions.startRestore(c)
+	if r == nil {
+		return err
+	}
+	defer r.Tx.Rollback()
+	tx, id, version := r.Tx, r.ID, r.Version
+
+	var snap, current questionSnapshot
+	if json.Unmarshal(r.Revision, &snap) != nil || json.Unmarshal(r.Before, &current) != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read revision"})
+	}
+	question := snap.question()
+	numericJSON, err := prepareNumericQuestion(&question)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := writeQuestion(tx, id, question, numericJSON); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore question"})
+	}
+	newVersion, err := questionRevisions.recordChange(tx, id, r.Before, "restore", user.ID, &version)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record revision"})
+	}
+
+	var regrade *regradeSummary
+	if answerKeyChanged(current.answerKey(), question) && c.QueryBool("regrade", true) {
+		summary, err := regradeQuestion(tx, id, regradeReasonKeyCorrection, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to regrade past sessions"})
+		}
+		regrade = &summary
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.JSON(fiber.Map{
+		"status":        "success",
+		"version":       newVersion,
+		"restored_from": version,
+		"regrade":       regrade,
+	})
+}
+
+// RestoreQuestionSetRevision puts a question set's content, marks and questions back to an
+// earlier version, as a new version. Questions that no longer exist are left out. Pricing is
+// only restored for the set's creator and admins; editors keep the current one.
+func RestoreQuestionSetRevision(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	r, err := questionSetRevisions.startRestore(c)
+	if r == nil {
+		return err
+	}
+	defer r.Tx.Rollback()
+	tx, id, version := r.Tx, r.ID, r.Version
+
+	var snap, current questionSetSnapshot
+	if json.Unmarshal(r.Revision, &snap) != nil || json.Unmarshal(r.Before, &current) != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read revision"})
+	}
+	if r.Role != "owner" {
+		snap.AccessLevel, snap.Price, snap.Currency = current.AccessLevel, current.Price, current.Currency
+	}
+
+	_, err = tx.Exec(`
+		UPDATE question_sets
+		SET name = $1, mode = $2, subject = $3, exam = $4, language = $5, time_duration = $6,
+		    description = $7, associated_resource = $8, cover_image = $9, slug = $10, access_level = $11,
+		    marking_scheme = $12, negative_mark_ratio = $13, unanswered_penalty_ratio = $14,
+		    price = $15, currency = $16
+		WHERE id = $17`,
+		snap.Name, snap.Mode, snap.Subject, snap.Exam, snap.Language, snap.TimeDuration,
+		snap.Description, snap.AssociatedResource, snap.CoverImage, snap.Slug, snap.AccessLevel,
+		snap.MarkingScheme, snap.NegativeMarkRatio, snap.UnansweredPenaltyRatio,
+		snap.Price, snap.Currency, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore question set"})
+	}
+
+	wanted := make([]int, len(snap.Questions))
+	for i, m := range snap.Questions {
+		wanted[i] = m.QuestionID
+	}
+	var existing pq.Int64Array
+	if err := tx.QueryRow(`SELECT ARRAY(SELECT id FROM questions WHERE id = ANY($1))`, pq.Array(wanted)).Scan(&existing); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch questions"})
+	}
+	exists := make(map[int]bool, len(existing))
+	for _, qid := range existing {
+		exists[int(qid)] = true
+	}
+	questionIDs, marks, skipped := []int{}, []float64{}, []int{}
+	for _, m := range snap.Questions {
+		if !exists[m.QuestionID] {
+			skipped = append(skipped, m.QuestionID)
+			continue
+		}
+		questionIDs = append(questionIDs, m.QuestionID)
+		marks = append(marks, m.Mark)
+	}
+	if err := replaceSetQuestions(tx, id, questionIDs, &marks); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore questions: " + err.Error()})
+	}
+	if err := replaceSetTags(tx, id, snap.Tags); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore tags: " + err.Error()})
+	}
+
+	newVersion, err := questionSetRevisions.recordChange(tx, id, r.Before, "restore", user.ID, &version)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record revision"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.JSON(fiber.Map{
+		"status":            "success",
+		"version":           newVersion,
+		"restored_from":     version,
+		"skipped_questions": skipped,
+	})
+}
+
+// question turns a snapshot back into the question it was.
+func (q questionSnapshot) question() models.Question {
+	question := models.Question{
+		Question:       q.Question,
+		Subject:        q.Subject,
+		Exam:           q.Exam,
+		Language:       q.Language,
+		QuestionType:   q.QuestionType,
+		Options:        q.Options,
+		CorrectOptions: make([]int, len(q.CorrectOptions)),
+		NumericAnswer:  q.NumericAnswer,
+		Explanation:    q.Explanation,
+		Tags:           q.Tags,
+	}
+	if q.Difficulty != nil {
+		question.Difficulty = *q.Difficulty
+	}
+	for i, option := range q.CorrectOptions {
+		question.CorrectOptions[i] = int(option)
+	}
+	return question
+}
+
+func (q questionSnapshot) answerKey() answerKey {
+	return answerKey{QuestionType: q.QuestionType, Options: q.Options, CorrectOptions: q.CorrectOptions, Numeric: q.NumericAnswer}
+}
+
+func GetQuestionRevisions(c *fiber.Ctx) error {
+	return questionRevisions.listRevisions(c)
+}
+func GetQuestionRevision(c *fiber.Ctx) error {
+	return questionRevisions.getRevision(c)
+}
+func DiffQuestionRevisions(c *fiber.Ctx) error {
+	return questionRevisions.diffRevisions(c)
+}
+
+func GetQuestionSetRevisions(c *fiber.Ctx) error {
+	return questionSetRevisions.listRevisions(c)
+}
+func GetQuestionSetRevision(c *fiber.Ctx) error {
+	return questionSetRevisions.getRevision(c)
+}
+func DiffQuestionSetRevisions(c *fiber.Ctx) error {
+	return questionSetRevisions.diffRevisions(c)
+}
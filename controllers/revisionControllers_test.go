@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	from := []byte(`{"question":"2+2?","options":["3","4"],"correct_options":[0],"tags":["math"]}`)
+	to := []byte(`{"question":"2+2?","options":["3","4"],"correct_options":[1],"tags":["math"],"explanation":"basic"}`)
+
+	changes, err := diffSnapshots(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Field != "correct_options" || changes[1].Field != "explanation" {
+		t.Fatalf("got %+v", changes)
+	}
+	if changes[1].From != nil || changes[1].To != "basic" {
+		t.Errorf("an added field should diff from null, got %+v", changes[1])
+	}
+
+	if changes, _ := diffSnapshots(from, to, "correct_options", "explanation"); len(changes) != 0 {
+		t.Errorf("skipped fields should not be compared, got %+v", changes)
+	}
+}
+
+func TestMembershipDiff(t *testing.T) {
+	from := []setMember{{1, 1}, {2, 1}, {3, 2}}
+	to := []setMember{{4, 1}, {3, 4}, {1, 1}}
+
+	added, removed, marks := membershipDiff(from, to)
+	if !reflect.DeepEqual(added, []int{4}) || !reflect.DeepEqual(removed, []int{2}) {
+		t.Errorf("added %v removed %v", added, removed)
+	}
+	if !reflect.DeepEqual(marks, []markChange{{QuestionID: 3, From: 2, To: 4}}) {
+		t.Errorf("marks %+v", marks)
+	}
+}
+
+func TestQuestionSnapshotRoundTrip(t *testing.T) {
+	difficulty := 4
+	snap := questionSnapshot{
+		Question:       "Pick the primes",
+		QuestionType:   "m-select",
+		Difficulty:     &difficulty,
+		Options:        []string{"2", "4", "5"},
+		CorrectOptions: []int64{0, 2},
+		Tags:           []string{"primes"},
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored questionSnapshot
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	q := restored.question()
+	if q.Difficulty != 4 || !reflect.DeepEqual(q.CorrectOptions, []int{0, 2}) {
+		t.Errorf("got %+v", q)
+	}
+	if answerKeyChanged(snap.answerKey(), q) {
+		t.Error("a restored snapshot should keep its answer key")
+	}
+	q.CorrectOptions = []int{0}
+	if !answerKeyChanged(snap.answerKey(), q) {
+		t.Error("dropping a correct option changes the key")
+	}
+}
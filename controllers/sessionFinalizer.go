@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"database/sql"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Sessions nobody finishes are finalized in the background so they still get a rank and show
+// up in the stats. Timed sessions end at their deadline; untimed ones once they've been idle
+// for SESSION_IDLE_MINUTES. Every instance of the server runs the sweep; FOR UPDATE SKIP LOCKED
+// keeps two instances from finalizing the same session.
+const (
+	defaultSessionIdleMinutes  = 24 * 60
+	defaultSessionSweepSeconds = 60
+	sessionSweepBatchSize      = 100
+)
+
+// overdueSessionQuery picks one unfinished session that is past its deadline or idle window.
+// The deadlines mirror sessionTimer.
+const overdueSessionQuery = `
+	SELECT id, mode
+	FROM test_sessions
+	WHERE NOT finished AND (
+	    (mode = 't_timed'
+	        AND started_time + (COALESCE(time_cap_seconds, 0) + $1) * INTERVAL '1 second' < LOCALTIMESTAMP)
+	    OR (mode = 'q_timed'
+	        AND COALESCE(current_question_started_at, started_time)
+	            + ((n_total_questions - current_question_num) * COALESCE(seconds_per_question, 0) + $1) * INTERVAL '1 second' < LOCALTIMESTAMP)
+	    OR (mode = 'untimed'
+	        AND updated_time < LOCALTIMESTAMP - $2 * INTERVAL '1 minute')
+	)
+	ORDER BY updated_time
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED`
+
+// StartSessionFinalizer starts the background sweep. It returns immediately.
+func StartSessionFinalizer() {
+	idleMinutes := envInt("SESSION_IDLE_MINUTES", defaultSessionIdleMinutes)
+	interval := time.Duration(envInt("SESSION_SWEEP_SECONDS", defaultSessionSweepSeconds)) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := finalizeOverdueSessions(idleMinutes)
+			if err != nil {
+				log.Println("session finalizer:", err)
+			}
+			if n > 0 {
+				log.Printf("session finalizer: finished %d test sessions", n)
+			}
+		}
+	}()
+}
+
+// finalizeOverdueSessions finishes up to one batch of overdue sessions, each in its own transaction.
+func finalizeOverdueSessions(idleMinutes int) (int, error) {
+	finalized := 0
+	for finalized < sessionSweepBatchSize {
+		done, err := finalizeNextOverdueSession(idleMinutes)
+		if err != nil || !done {
+			return finalized, err
+		}
+		finalized++
+	}
+	return finalized, nil
+}
+
+func finalizeNextOverdueSession(idleMinutes int) (bool, error) {
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var sessionID, mode string
+	err = tx.QueryRow(overdueSessionQuery, timerGraceSeconds, idleMinutes).Scan(&sessionID, &mode)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	reason := "time_up"
+	if mode == "untimed" {
+		reason = "abandoned"
+	}
+	if _, err := finalizeTestSession(tx, sessionID, reason); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
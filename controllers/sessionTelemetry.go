@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/lib/pq"
+	"slices"
+	"time"
+)
+
+// maxEventsPerUpdate caps how many telemetry events one UpdateTestSession call may carry.
+const maxEventsPerUpdate = 500
+
+// sessionEvent is one thing the learner did during a test session, as reported by the client:
+//   - visit: the learner looked at a question for duration_seconds
+//   - answer: the learner picked (or typed) an answer; every pick is kept, not just the last one
+type sessionEvent struct {
+	QuestionID         int        `json:"question_id"`
+	Type               string     `json:"type"`
+	DurationSeconds    *int       `json:"duration_seconds"`
+	SelectedAnswerList []int64    `json:"selected_answer_list"`
+	NumericAnswer      *string    `json:"numeric_answer"`
+	At                 *time.Time `json:"at"`
+}
+
+// questionTelemetry summarises the events of one question for the review screen.
+type questionTelemetry struct {
+	TimeSpentSeconds   int     `json:"time_spent_seconds"`
+	Visits             int     `json:"visits"`
+	AnswerChanges      int     `json:"answer_changes"`
+	FirstAnswer        []int64 `json:"first_answer"`
+	FirstNumericAnswer *string `json:"first_numeric_answer,omitempty"`
+}
+
+// validateSessionEvents checks events against the session's questions (question ID -> number of
+// displayed options). The visits, added to the recordedSeconds already stored, may not last
+// longer than the session has been running.
+func validateSessionEvents(events []sessionEvent, optionCounts map[int]int, maxDurationSeconds, recordedSeconds int) error {
+	if len(events) > maxEventsPerUpdate {
+		return fmt.Errorf("at most %d events can be sent at once", maxEventsPerUpdate)
+	}
+	total := recordedSeconds
+	for i, e := range events {
+		nOptions, ok := optionCounts[e.QuestionID]
+		if !ok {
+			return fmt.Errorf("event %d: question %d is not part of this test session", i, e.QuestionID)
+		}
+		switch e.Type {
+		case "visit":
+			if e.DurationSeconds == nil || *e.DurationSeconds < 0 || *e.DurationSeconds > maxDurationSeconds {
+				return fmt.Errorf("event %d: duration_seconds must be between 0 and %d", i, maxDurationSeconds)
+			}
+			total += *e.DurationSeconds
+			if total > maxDurationSeconds {
+				return fmt.Errorf("event %d: visits add up to %d seconds, longer than the session's %d", i, total, maxDurationSeconds)
+			}
+		case "answer":
+			if e.DurationSeconds != nil {
+				return fmt.Errorf("event %d: answer events have no duration", i)
+			}
+			orderList := make([]int64, nOptions)
+			if _, err := toOriginalIndices(orderList, e.SelectedAnswerList); err != nil {
+				return fmt.Errorf("event %d: %v", i, err)
+			}
+		default:
+			return fmt.Errorf("event %d: type must be visit or answer", i)
+		}
+	}
+	return nil
+}
+
+// invalidEventsError is a batch of events that doesn't fit the session.
+type invalidEventsError struct{ err error }
+
+func (e invalidEventsError) Error() string { return e.err.Error() }
+
+// recordSessionEvents checks events against the session's questions and the elapsedSeconds it
+// has been running, then stores them. Events that don't fit come back as an invalidEventsError.
+func recordSessionEvents(tx *sql.Tx, testSessionID string, events []sessionEvent, elapsedSeconds int) error {
+	if len(events) == 0 {
+		return nil
+	}
+	optionCounts := make(map[int]int)
+	rows, err := tx.Query(`
+		SELECT question_id, COALESCE(array_length(order_list, 1), 0)
+		FROM test_session_question_answers
+		WHERE test_session_id = $1`, testSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to load session questions: %w", err)
+	}
+	for rows.Next() {
+		var qid, nOptions int
+		if err := rows.Scan(&qid, &nOptions); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to load session questions: %w", err)
+		}
+		optionCounts[qid] = nOptions
+	}
+	rows.Close()
+
+	recorded, err := recordedVisitSeconds(tx, testSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to load session events: %w", err)
+	}
+	if err := validateSessionEvents(events, optionCounts, elapsedSeconds, recorded); err != nil {
+		return invalidEventsError{err}
+	}
+	return saveSessionEvents(tx, testSessionID, events)
+}
+
+// recordedVisitSeconds sums the visit time already stored for a session.
+func recordedVisitSeconds(tx *sql.Tx, testSessionID string) (int, error) {
+	var seconds int
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(duration_seconds), 0) FROM test_session_events
+		WHERE test_session_id = $1 AND event_type = 'visit'`, testSessionID).Scan(&seconds)
+	return seconds, err
+}
+
+// saveSessionEvents appends events to test_session_events in the order they were sent.
+func saveSessionEvents(tx *sql.Tx, testSessionID string, events []sessionEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO test_session_events (
+			test_session_id, question_id, event_type, duration_seconds,
+			selected_answer_list, numeric_answer, client_time
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range events {
+		var selected interface{}
+		if e.Type == "answer" {
+			selected = pq.Array(e.SelectedAnswerList)
+		}
+		if _, err := stmt.Exec(testSessionID, e.QuestionID, e.Type, e.DurationSeconds, selected, e.NumericAnswer, e.At); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarizeSessionEvents turns a session's events, oldest first, into per-question telemetry
+// and the order in which questions were first visited.
+func summarizeSessionEvents(events []sessionEvent) (map[int]*questionTelemetry, []int) {
+	summary := make(map[int]*questionTelemetry)
+	visitOrder := []int{}
+	answered := make(map[int]bool)
+	last := make(map[int]sessionEvent)
+
+	for _, e := range events {
+		t, ok := summary[e.QuestionID]
+		if !ok {
+			t = &questionTelemetry{}
+			summary[e.QuestionID] = t
+		}
+		switch e.Type {
+		case "visit":
+			if t.Visits == 0 {
+				visitOrder = append(visitOrder, e.QuestionID)
+			}
+			t.Visits++
+			if e.DurationSeconds != nil {
+				t.TimeSpentSeconds += *e.DurationSeconds
+			}
+		case "answer":
+			if !answered[e.QuestionID] {
+				answered[e.QuestionID] = true
+				t.FirstAnswer = e.SelectedAnswerList
+				t.FirstNumericAnswer = e.NumericAnswer
+			} else if prev := last[e.QuestionID]; !sameAnswer(prev, e) {
+				t.AnswerChanges++
+			}
+			last[e.QuestionID] = e
+		}
+	}
+	return summary, visitOrder
+}
+
+func sameAnswer(a, b sessionEvent) bool {
+	if (a.NumericAnswer == nil) != (b.NumericAnswer == nil) {
+		return false
+	}
+	if a.NumericAnswer != nil && *a.NumericAnswer != *b.NumericAnswer {
+		return false
+	}
+	return slices.Equal(a.SelectedAnswerList, b.SelectedAnswerList)
+}
+
+// loadSessionTelemetry reads and summarises the stored events of a test session.
+func loadSessionTelemetry(testSessionID string) (map[int]*questionTelemetry, []int, error) {
+	rows, err := util.DB.Query(`
+		SELECT question_id, event_type, duration_seconds, selected_answer_list, numeric_answer, client_time
+		FROM test_session_events
+		WHERE test_session_id = $1
+		ORDER BY id`, testSessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var events []sessionEvent
+	for rows.Next() {
+		var e sessionEvent
+		var selected pq.Int64Array
+		if err := rows.Scan(&e.QuestionID, &e.Type, &e.DurationSeconds, &selected, &e.NumericAnswer, &e.At); err != nil {
+			return nil, nil, err
+		}
+		e.SelectedAnswerList = selected
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	summary, visitOrder := summarizeSessionEvents(events)
+	return summary, visitOrder, nil
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSummarizeSessionEvents(t *testing.T) {
+	secs := func(n int) *int { return &n }
+	events := []sessionEvent{
+		{QuestionID: 7, Type: "visit", DurationSeconds: secs(20)},
+		{QuestionID: 7, Type: "answer", SelectedAnswerList: []int64{1}},
+		{QuestionID: 3, Type: "visit", DurationSeconds: secs(5)},
+		{QuestionID: 7, Type: "visit", DurationSeconds: secs(10)},
+		{QuestionID: 7, Type: "answer", SelectedAnswerList: []int64{1}},
+		{QuestionID: 7, Type: "answer", SelectedAnswerList: []int64{2}},
+	}
+	summary, visitOrder := summarizeSessionEvents(events)
+
+	if !slices.Equal(visitOrder, []int{7, 3}) {
+		t.Fatalf("unexpected visit order %v", visitOrder)
+	}
+	q := summary[7]
+	if q.TimeSpentSeconds != 30 || q.Visits != 2 {
+		t.Fatalf("unexpected time on question %+v", q)
+	}
+	if q.AnswerChanges != 1 || !slices.Equal(q.FirstAnswer, []int64{1}) {
+		t.Fatalf("unexpected answer history %+v", q)
+	}
+	if summary[3].FirstAnswer != nil {
+		t.Fatal("question without answers should have no first answer")
+	}
+}
+
+func TestValidateSessionEvents(t *testing.T) {
+	secs := func(n int) *int { return &n }
+	optionCounts := map[int]int{7: 4}
+
+	valid := []sessionEvent{
+		{QuestionID: 7, Type: "visit", DurationSeconds: secs(30)},
+		{QuestionID: 7, Type: "answer", SelectedAnswerList: []int64{0, 3}},
+	}
+	if err := validateSessionEvents(valid, optionCounts, 60, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]sessionEvent{
+		"unknown question":     {QuestionID: 8, Type: "visit", DurationSeconds: secs(1)},
+		"unknown type":         {QuestionID: 7, Type: "hover"},
+		"visit too long":       {QuestionID: 7, Type: "visit", DurationSeconds: secs(61)},
+		"negative duration":    {QuestionID: 7, Type: "visit", DurationSeconds: secs(-1)},
+		"option out of range":  {QuestionID: 7, Type: "answer", SelectedAnswerList: []int64{4}},
+		"duration on answer":   {QuestionID: 7, Type: "answer", DurationSeconds: secs(3)},
+		"visit missing length": {QuestionID: 7, Type: "visit"},
+	}
+	for name, e := range invalid {
+		if err := validateSessionEvents([]sessionEvent{e}, optionCounts, 60, 0); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := validateSessionEvents(valid, optionCounts, 60, 31); err == nil {
+		t.Error("visits adding up past the session's running time should be refused")
+	}
+	if err := validateSessionEvents(valid, optionCounts, 60, 30); err != nil {
+		t.Errorf("visits within the running time: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"time"
+)
+
+// timerGraceSeconds absorbs network latency for answers sent right at the deadline.
+const timerGraceSeconds = 5
+
+// pauseAllowed says which session modes may be paused. Timed modes run on the server's
+// clock, so pausing them would hand out extra time.
+var pauseAllowed = map[string]bool{
+	"untimed": true,
+	"q_timed": false,
+	"t_timed": false,
+}
+
+// activeSeconds is how long a session ran from started to end, leaving out the time it was
+// paused.
+func activeSeconds(started, end time.Time, pausedSeconds int) int {
+	return max(int(end.Sub(started).Seconds())-pausedSeconds, 0)
+}
+
+// sessionTimer is the server's view of a test session's clock.
+//   - t_timed: the whole session must end within TimeCapSeconds of StartedTime.
+//   - q_timed: each question gets SecondsPerQuestion from QuestionStartedAt. Questions are
+//     answered in order; once a question's time is up the session moves on by itself and
+//     earlier questions are locked.
+//   - untimed: no deadlines.
+//
+// Times are read from the database clock so they compare with started_time consistently.
+type sessionTimer struct {
+	Mode               string
+	StartedTime        time.Time
+	SecondsPerQuestion int
+	TimeCapSeconds     int
+	NTotalQuestions    int
+	CurrentQuestionNum int
+	QuestionStartedAt  time.Time
+}
+
+func (t *sessionTimer) timed() bool {
+	return t.Mode == "q_timed" || t.Mode == "t_timed"
+}
+
+// deadline is when the whole session runs out of time. ok is false for untimed sessions.
+func (t *sessionTimer) deadline() (deadline time.Time, ok bool) {
+	switch t.Mode {
+	case "t_timed":
+		return t.StartedTime.Add(time.Duration(t.TimeCapSeconds) * time.Second), true
+	case "q_timed":
+		left := t.NTotalQuestions - t.CurrentQuestionNum
+		return t.QuestionStartedAt.Add(time.Duration(left*t.SecondsPerQuestion) * time.Second), true
+	}
+	return time.Time{}, false
+}
+
+// advance moves a q_timed session past every question whose time has run out by now.
+func (t *sessionTimer) advance(now time.Time) {
+	if t.Mode != "q_timed" || t.SecondsPerQuestion <= 0 {
+		return
+	}
+	per := time.Duration(t.SecondsPerQuestion) * time.Second
+	for t.CurrentQuestionNum < t.NTotalQuestions && now.Sub(t.QuestionStartedAt) > per {
+		t.CurrentQuestionNum++
+		t.QuestionStartedAt = t.QuestionStartedAt.Add(per)
+	}
+}
+
+// expired reports whether the session is out of time, grace included.
+func (t *sessionTimer) expired(now time.Time) bool {
+	deadline, ok := t.deadline()
+	return ok && now.After(deadline.Add(timerGraceSeconds*time.Second))
+}
+
+// acceptsAnswer reports whether an answer to the question shown at indexNum still counts.
+func (t *sessionTimer) acceptsAnswer(indexNum int, now time.Time) bool {
+	switch t.Mode {
+	case "t_timed":
+		return !t.expired(now)
+	case "q_timed":
+		if indexNum != t.CurrentQuestionNum {
+			return false
+		}
+		questionDeadline := t.QuestionStartedAt.Add(time.Duration(t.SecondsPerQuestion+timerGraceSeconds) * time.Second)
+		return !now.After(questionDeadline)
+	}
+	return true
+}
+
+// moveTo records the question the learner is on. q_timed sessions only move forward and the
+// next question's time starts when the learner reaches it.
+func (t *sessionTimer) moveTo(index int, now time.Time) {
+	if index < 0 || index >= t.NTotalQuestions {
+		return
+	}
+	if t.Mode == "q_timed" {
+		if index > t.CurrentQuestionNum {
+			t.CurrentQuestionNum = index
+			t.QuestionStartedAt = now
+		}
+		return
+	}
+	t.CurrentQuestionNum = index
+}
+
+// remainingSeconds is the time left for the session (t_timed) or the current question (q_timed).
+func (t *sessionTimer) remainingSeconds(now time.Time) *int {
+	var end time.Time
+	switch t.Mode {
+	case "t_timed":
+		end, _ = t.deadline()
+	case "q_timed":
+		end = t.QuestionStartedAt.Add(time.Duration(t.SecondsPerQuestion) * time.Second)
+	default:
+		return nil
+	}
+	remaining := int(end.Sub(now).Seconds())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// sessionTimerColumns selects a test_sessions row's clock; scan it with scanTargets.
+const sessionTimerColumns = `mode, started_time, COALESCE(seconds_per_question, 0), COALESCE(time_cap_seconds, 0),
+	n_total_questions, current_question_num, COALESCE(current_question_started_at, started_time), LOCALTIMESTAMP`
+
+func (t *sessionTimer) scanTargets(now *time.Time) []interface{} {
+	return []interface{}{&t.Mode, &t.StartedTime, &t.SecondsPerQuestion, &t.TimeCapSeconds,
+		&t.NTotalQuestions, &t.CurrentQuestionNum, &t.QuestionStartedAt, now}
+}
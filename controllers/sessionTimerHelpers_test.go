@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTimedSessionExpires(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	timer := sessionTimer{Mode: "t_timed", StartedTime: start, TimeCapSeconds: 600, NTotalQuestions: 10}
+
+	if !timer.acceptsAnswer(3, start.Add(9*time.Minute)) {
+		t.Fatal("answer within the time cap was refused")
+	}
+	if timer.expired(start.Add(600*time.Second + timerGraceSeconds*time.Second)) {
+		t.Fatal("session expired inside the grace period")
+	}
+	late := start.Add(11 * time.Minute)
+	if !timer.expired(late) || timer.acceptsAnswer(3, late) {
+		t.Fatal("late answer was accepted")
+	}
+	if remaining := timer.remainingSeconds(start.Add(4 * time.Minute)); remaining == nil || *remaining != 360 {
+		t.Fatalf("unexpected remaining time %v", remaining)
+	}
+}
+
+func TestQTimedSessionMovesOnByItself(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	timer := sessionTimer{Mode: "q_timed", StartedTime: start, SecondsPerQuestion: 30, NTotalQuestions: 3, QuestionStartedAt: start}
+
+	now := start.Add(70 * time.Second)
+	timer.advance(now)
+	if timer.CurrentQuestionNum != 2 {
+		t.Fatalf("expected to be on question 2, got %d", timer.CurrentQuestionNum)
+	}
+	if timer.acceptsAnswer(0, now) || timer.acceptsAnswer(1, now) {
+		t.Fatal("answers to questions whose time ran out were accepted")
+	}
+	if !timer.acceptsAnswer(2, now) {
+		t.Fatal("answer to the current question was refused")
+	}
+	if timer.expired(now) {
+		t.Fatal("session expired before the last question's time ran out")
+	}
+	if !timer.expired(start.Add(100 * time.Second)) {
+		t.Fatal("session did not expire after the last question")
+	}
+}
+
+func TestQTimedSessionOnlyMovesForward(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	timer := sessionTimer{Mode: "q_timed", StartedTime: start, SecondsPerQuestion: 30, NTotalQuestions: 5, QuestionStartedAt: start}
+
+	next := start.Add(10 * time.Second)
+	timer.moveTo(1, next)
+	if timer.CurrentQuestionNum != 1 || !timer.QuestionStartedAt.Equal(next) {
+		t.Fatal("moving to the next question should restart the question clock")
+	}
+	timer.moveTo(0, next.Add(time.Second))
+	if timer.CurrentQuestionNum != 1 {
+		t.Fatal("q_timed session moved back to an earlier question")
+	}
+}
+
+func TestUntimedSessionNeverExpires(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	timer := sessionTimer{Mode: "untimed", StartedTime: start, NTotalQuestions: 5}
+	later := start.Add(72 * time.Hour)
+	if timer.expired(later) || !timer.acceptsAnswer(4, later) || timer.remainingSeconds(later) != nil {
+		t.Fatal("untimed session should have no deadline")
+	}
+}
+
+func TestActiveSecondsLeavesOutPauses(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	if got := activeSeconds(start, start.Add(20*time.Minute), 300); got != 900 {
+		t.Fatalf("got %d, want 900", got)
+	}
+	if got := activeSeconds(start, start.Add(time.Minute), 120); got != 0 {
+		t.Fatalf("pauses longer than the session should not go negative, got %d", got)
+	}
+}
@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxShoutoutLength = 1000
+
+var shoutoutVisibilities = map[string]bool{
+	"all-connections": true,
+	"friends-only":    true,
+	"mentors-only":    true,
+	"mentees-only":    true,
+}
+
+// streakMilestones are the day counts that earn an automatic shoutout.
+var streakMilestones = map[int]bool{3: true, 7: true, 14: true, 30: true, 50: true, 100: true, 200: true, 365: true}
+
+// shoutoutVisibleSQL is true when viewer $1 may see shoutout s. Authors always see their own
+// posts; everyone else needs an accepted connection that the post's visibility allows.
+// Followers only see the posts of the people they follow, not the other way round.
+const shoutoutVisibleSQL = `(
+	s.user_id = $1 OR EXISTS (
+	    SELECT 1 FROM user_connections uc
+	    WHERE uc.status = 'accepted'
+	      AND (
+	          (uc.connection_type IN ('friend', 'mentor-mentee')
+	              AND ((uc.requester_id = $1 AND uc.target_id = s.user_id) OR (uc.requester_id = s.user_id AND uc.target_id = $1)))
+	          OR (uc.connection_type = 'follower' AND uc.requester_id = $1 AND uc.target_id = s.user_id)
+	      )
+	      AND CASE s.visibility
+	          WHEN 'all-connections' THEN true
+	          WHEN 'friends-only' THEN uc.connection_type = 'friend'
+	          WHEN 'mentors-only' THEN uc.connection_type = 'mentor-mentee' AND uc.mentor_id = $1
+	          WHEN 'mentees-only' THEN uc.connection_type = 'mentor-mentee' AND uc.mentor_id = s.user_id
+	          ELSE false
+	      END
+	)
+)`
+
+// encodeFeedCursor makes the opaque cursor for the page after the shoutout (createdAt, id).
+func encodeFeedCursor(createdAt time.Time, id int) string {
+	raw := fmt.Sprintf("%d:%d", createdAt.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFeedCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, errors.New("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, 0, errors.New("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil || id < 1 {
+		return time.Time{}, 0, errors.New("invalid cursor")
+	}
+	return time.Unix(0, nanos).UTC(), id, nil
+}
+
+// currentStreak counts the consecutive days ending today on which the user finished a test.
+// days holds distinct dates, newest first.
+func currentStreak(days []time.Time, today time.Time) int {
+	streak := 0
+	expected := today
+	for _, day := range days {
+		if !sameDate(day, expected) {
+			break
+		}
+		streak++
+		expected = expected.AddDate(0, 0, -1)
+	}
+	return streak
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func insertShoutout(tx *sql.Tx, userID int, content, visibility, kind string, testSessionID *string) error {
+	_, err := tx.Exec(`
+		INSERT INTO shoutouts (user_id, content, visibility, kind, test_session_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		userID, content, visibility, kind, testSessionID, time.Now().UTC())
+	return err
+}
+
+// postAutoShoutouts announces a finished test, and a streak milestone when this is the first
+// test of the day to complete one, for users who turned auto_shoutouts on.
+func postAutoShoutouts(tx *sql.Tx, testSessionID string, result sessionResult) error {
+	var userID int
+	var name string
+	var enabled bool
+	err := tx.QueryRow(`
+		SELECT ts.taken_by_id, ts.name, COALESCE(u.auto_shoutouts, false)
+		FROM test_sessions ts
+		JOIN users u ON u.id = ts.taken_by_id
+		WHERE ts.id = $1`, testSessionID).Scan(&userID, &name, &enabled)
+	if err != nil || !enabled {
+		return err
+	}
+
+	content := fmt.Sprintf("Finished %s with %s/%s", name,
+		strconv.FormatFloat(result.ScoredMarks, 'f', -1, 64), strconv.FormatFloat(result.TotalMarks, 'f', -1, 64))
+	if err := insertShoutout(tx, userID, content, "all-connections", "test_finished", &testSessionID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT DISTINCT finished_time::date AS day
+		FROM test_sessions
+		WHERE taken_by_id = $1 AND finished = true AND finished_time IS NOT NULL
+		ORDER BY day DESC
+		LIMIT 366`, userID)
+	if err != nil {
+		return err
+	}
+	var days []time.Time
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return err
+		}
+		days = append(days, day)
+	}
+	rows.Close()
+
+	var finishedToday int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM test_sessions
+		WHERE taken_by_id = $1 AND finished = true AND finished_time::date = $2`,
+		userID, result.FinishedTime.Format("2006-01-02")).Scan(&finishedToday)
+	if err != nil {
+		return err
+	}
+	streak := currentStreak(days, result.FinishedTime)
+	if finishedToday != 1 || !streakMilestones[streak] {
+		return nil
+	}
+	content = fmt.Sprintf("Reached a %d-day practice streak", streak)
+	return insertShoutout(tx, userID, content, "all-connections", "streak_milestone", nil)
+}
+
+func CreateShoutout(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var input struct {
+		Content    string `json:"content"`
+		Visibility string `json:"visibility"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	input.Content = strings.TrimSpace(input.Content)
+	if input.Content == "" || len(input.Content) > maxShoutoutLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("content must be between 1 and %d characters", maxShoutoutLength),
+		})
+	}
+	if input.Visibility == "" {
+		input.Visibility = "all-connections"
+	}
+	if !shoutoutVisibilities[input.Visibility] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "visibility must be all-connections, friends-only, mentors-only or mentees-only",
+		})
+	}
+
+	var id int
+	var createdAt time.Time
+	err := util.DB.QueryRow(`
+		INSERT INTO shoutouts (user_id, content, visibility, kind, created_at)
+		VALUES ($1, $2, $3, 'post', $4)
+		RETURNING id, created_at`, user.ID, input.Content, input.Visibility, time.Now().UTC()).Scan(&id, &createdAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to post shoutout"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status": "success",
+		"shoutout": fiber.Map{
+			"id":         id,
+			"user_id":    user.ID,
+			"content":    input.Content,
+			"visibility": input.Visibility,
+			"kind":       "post",
+			"created_at": createdAt,
+		},
+	})
+}
+
+// DeleteShoutout removes one of the user's own shoutouts; admins can remove any.
+func DeleteShoutout(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid shoutout ID"})
+	}
+	isAdmin := user.Role == "admin" || user.Role == "owner"
+	res, err := util.DB.Exec(`DELETE FROM shoutouts WHERE id = $1 AND (user_id = $2 OR $3)`, id, user.ID, isAdmin)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete shoutout"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Shoutout not found"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Shoutout deleted"})
+}
+
+// GetShoutouts lists one user's shoutouts (the caller's own by default) that the caller may see.
+func GetShoutouts(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	authorID := user.ID
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user_id"})
+		}
+		authorID = id
+	}
+	return listShoutouts(c, user.ID, &authorID)
+}
+
+// GetShoutoutFeed merges the caller's shoutouts with those of their accepted connections,
+// newest first. Pass next_cursor from the previous page as cursor to continue.
+func GetShoutoutFeed(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	return listShoutouts(c, user.ID, nil)
+}
+
+func listShoutouts(c *fiber.Ctx, viewerID int, authorID *int) error {
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	where := []string{"u.deleted = false", shoutoutVisibleSQL}
+	args := []interface{}{viewerID}
+	if authorID != nil {
+		args = append(args, *authorID)
+		where = append(where, fmt.Sprintf("s.user_id = $%d", len(args)))
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, id, err := decodeFeedCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		args = append(args, createdAt, id)
+		where = append(where, fmt.Sprintf("(s.created_at, s.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, limit+1)
+
+	rows, err := util.DB.Query(`
+		SELECT s.id, s.user_id, u.name, u.profile_pic, s.content, s.visibility, COALESCE(s.kind, 'post'),
+		       s.test_session_id, s.created_at
+		FROM shoutouts s
+		JOIN users u ON u.id = s.user_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY s.created_at DESC, s.id DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch shoutouts"})
+	}
+	defer rows.Close()
+
+	shoutouts := []map[string]interface{}{}
+	var lastCreated time.Time
+	var lastID int
+	hasMore := false
+	for rows.Next() {
+		if len(shoutouts) == limit {
+			hasMore = true
+			break
+		}
+		var (
+			id, userID                int
+			name, content, visibility string
+			kind                      string
+			profilePic, testSessionID *string
+			createdAt                 time.Time
+		)
+		if err := rows.Scan(&id, &userID, &name, &profilePic, &content, &visibility, &kind, &testSessionID, &createdAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read shoutout"})
+		}
+		shoutouts = append(shoutouts, map[string]interface{}{
+			"id":              id,
+			"user_id":         userID,
+			"user_name":       name,
+			"profile_pic":     profilePic,
+			"content":         content,
+			"visibility":      visibility,
+			"kind":            kind,
+			"test_session_id": testSessionID,
+			"created_at":      createdAt,
+		})
+		lastCreated, lastID = createdAt, id
+	}
+
+	var nextCursor *string
+	if hasMore {
+		cursor := encodeFeedCursor(lastCreated, lastID)
+		nextCursor = &cursor
+	}
+	return c.JSON(fiber.Map{
+		"status":      "success",
+		"shoutouts":   shoutouts,
+		"next_cursor": nextCursor,
+	})
+}
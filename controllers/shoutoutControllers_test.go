@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2025, 3, 4, 10, 20, 30, 123456000, time.UTC)
+	gotTime, gotID, err := decodeFeedCursor(encodeFeedCursor(createdAt, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotTime.Equal(createdAt) || gotID != 42 {
+		t.Fatalf("got (%v, %d), want (%v, 42)", gotTime, gotID, createdAt)
+	}
+	for _, bad := range []string{"!!", "bm9wZQ", encodeFeedCursor(createdAt, 0)} {
+		if _, _, err := decodeFeedCursor(bad); err == nil {
+			t.Fatalf("cursor %q should be rejected", bad)
+		}
+	}
+}
+
+func TestCurrentStreak(t *testing.T) {
+	today := time.Date(2025, 3, 4, 18, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	if got := currentStreak([]time.Time{day(4), day(3), day(2), day(1)}, today); got != 4 {
+		t.Fatalf("got %d, want 4", got)
+	}
+	if got := currentStreak([]time.Time{day(4), day(2), day(1)}, today); got != 1 {
+		t.Fatalf("a gap should end the streak, got %d", got)
+	}
+	if got := currentStreak([]time.Time{day(3), day(2)}, today); got != 0 {
+		t.Fatalf("no test today means no current streak, got %d", got)
+	}
+}
@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/models"
+	"github.com/ShijuPJohn/synapticz_backend/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Fixed sessions can also be taken one question at a time: the server keeps the position,
+// serves only the current question and grades each answer as it arrives, so the client never
+// holds the answer key. Sessions created with delivery "stepwise" keep the key out of
+// GetTestSession too until they finish. Adaptive sessions are answered here as well, but only
+// NextAdaptiveQuestion moves them on.
+
+// stepwiseSession is the state of a session as a one-question-at-a-time request finds it.
+type stepwiseSession struct {
+	Finished      bool
+	Paused        bool
+	Adaptive      bool
+	PausedSeconds int
+	Scheme        markingScheme
+	Timer         sessionTimer
+	Now           time.Time
+}
+
+// lockStepwiseSession loads and locks the user's session and brings its clock up to date. On
+// error, status is the HTTP status to answer with.
+func lockStepwiseSession(tx *sql.Tx, testSessionID string, userID int) (stepwiseSession, int, error) {
+	var s stepwiseSession
+	var takenByID int
+	var selectionMode string
+	err := tx.QueryRow(
+		`SELECT taken_by_id, finished, paused_at IS NOT NULL, paused_seconds, selection_mode,
+                marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, `+sessionTimerColumns+`
+         FROM test_sessions
+         WHERE id = $1
+         FOR UPDATE`, testSessionID).Scan(append([]interface{}{&takenByID, &s.Finished, &s.Paused, &s.PausedSeconds, &selectionMode,
+		&s.Scheme.MSelectPolicy, &s.Scheme.NegativeMarkRatio, &s.Scheme.UnansweredPenaltyRatio},
+		s.Timer.scanTargets(&s.Now)...)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return s, fiber.StatusNotFound, errors.New("Test session not found")
+		}
+		return s, fiber.StatusInternalServerError, errors.New("Failed to fetch test session")
+	}
+	if takenByID != userID {
+		return s, fiber.StatusUnauthorized, errors.New("Unauthorized")
+	}
+	s.Adaptive = selectionMode == "adaptive"
+	s.Timer.advance(s.Now)
+	return s, 0, nil
+}
+
+// finishedStepwiseResponse answers for a session that is over, finishing it first if its time
+// just ran out.
+func finishedStepwiseResponse(c *fiber.Ctx, tx *sql.Tx, testSessionID string, s stepwiseSession) error {
+	if s.Finished {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "finished", "message": "Test session already finished"})
+	}
+	result, err := finalizeTestSession(tx, testSessionID, "time_up")
+	if err != nil && err != errSessionAlreadyFinished {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish test session"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":        "finished",
+		"message":       "Time is up, the test session has been finished",
+		"finish_reason": "time_up",
+		"scored_marks":  result.ScoredMarks,
+		"total_marks":   result.TotalMarks,
+	})
+}
+
+// loadStepwiseQuestion is the question at index as the learner sees it: options in the
+// session's order and their own answer so far, without the key or the marks scored.
+func loadStepwiseQuestion(tx *sql.Tx, testSessionID string, index int) (map[string]interface{}, error) {
+	var (
+		id            int
+		question      string
+		questionType  string
+		options       []string
+		orderList     []int64
+		selectedAns   pq.Int64Array
+		numericAnswer *string
+		totalMark     float64
+		answered      bool
+	)
+	err := tx.QueryRow(`
+		SELECT q.id, q.question, q.question_type, q.options, tsqa.order_list,
+		       tsqa.selected_answer_list, tsqa.numeric_answer, tsqa.questions_total_mark, tsqa.answered
+		FROM test_session_question_answers tsqa
+		JOIN questions q ON q.id = tsqa.question_id
+		WHERE tsqa.test_session_id = $1 AND tsqa.index_num = $2`, testSessionID, index).Scan(
+		&id, &question, &questionType, pq.Array(&options), pq.Array(&orderList),
+		&selectedAns, &numericAnswer, &totalMark, &answered)
+	if err != nil {
+		return nil, err
+	}
+	reorderedOptions := make([]string, 0, len(orderList))
+	for _, orderInd := range orderList {
+		reorderedOptions = append(reorderedOptions, options[orderInd])
+	}
+	return map[string]interface{}{
+		"id":                   id,
+		"question":             question,
+		"question_type":        questionType,
+		"options":              reorderedOptions,
+		"index_num":            index,
+		"questions_total_mark": totalMark,
+		"selected_answer_list": convertToIntSlice(selectedAns),
+		"numeric_answer":       numericAnswer,
+		"answered":             answered,
+	}, nil
+}
+
+func GetCurrentSessionQuestion(c *fiber.Ctx) error {
+	return moveSessionQuestion(c, 0)
+}
+
+func NextSessionQuestion(c *fiber.Ctx) error {
+	return moveSessionQuestion(c, 1)
+}
+
+func PrevSessionQuestion(c *fiber.Ctx) error {
+	return moveSessionQuestion(c, -1)
+}
+
+// moveSessionQuestion moves the session step questions along (0 stays put) and serves the
+// question it lands on. q_timed sessions only move forward.
+func moveSessionQuestion(c *fiber.Ctx, step int) error {
+	testSessionID := c.Params("test_session_id")
+	user := c.Locals("user").(models.User)
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	s, status, err := lockStepwiseSession(tx, testSessionID, user.ID)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if s.Finished || s.Timer.expired(s.Now) {
+		return finishedStepwiseResponse(c, tx, testSessionID, s)
+	}
+
+	timer := &s.Timer
+	if step != 0 {
+		if s.Adaptive {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Adaptive sessions move on at /test_session/next/:test_session_id"})
+		}
+		if s.Paused {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Test session is paused"})
+		}
+		target := timer.CurrentQuestionNum + step
+		switch {
+		case target < 0:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Already at the first question"})
+		case target >= timer.NTotalQuestions:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Already at the last question"})
+		case step < 0 && timer.Mode == "q_timed":
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "q_timed sessions cannot go back"})
+		}
+		timer.moveTo(target, s.Now)
+	}
+	if timer.CurrentQuestionNum >= timer.NTotalQuestions {
+		// Every question of a q_timed session has run out, but the grace period hasn't.
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "No questions left; finish the test session"})
+	}
+
+	_, err = tx.Exec(`
+		UPDATE test_sessions
+		SET current_question_num = $1,
+		    current_question_started_at = $2,
+		    started = true,
+		    updated_time = CURRENT_TIMESTAMP
+		WHERE id = $3`, timer.CurrentQuestionNum, timer.QuestionStartedAt, testSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update test session"})
+	}
+	question, err := loadStepwiseQuestion(tx, testSessionID, timer.CurrentQuestionNum)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":               "success",
+		"current_question_num": timer.CurrentQuestionNum,
+		"n_total_questions":    timer.NTotalQuestions,
+		"remaining_time":       timer.remainingSeconds(s.Now),
+		"paused":               s.Paused,
+		"question":             question,
+	})
+}
+
+// AnswerSessionQuestion grades and saves one answer, to the current question unless
+// question_id says otherwise. The body is a single question_answer_data entry. Marks stay on
+// the server until the session finishes. Adaptive sessions only take the current question,
+// since the earlier ones already moved the ability estimate. Telemetry comes in events, as
+// with UpdateTestSession.
+func AnswerSessionQuestion(c *fiber.Ctx) error {
+	testSessionID := c.Params("test_session_id")
+	user := c.Locals("user").(models.User)
+
+	var body map[string]interface{}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	answer, err := parseSubmittedAnswer(body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid answer format: " + err.Error()})
+	}
+	var telemetry struct {
+		Events []sessionEvent `json:"events"`
+	}
+	if err := json.Unmarshal(c.Body(), &telemetry); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid events: " + err.Error()})
+	}
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	s, status, err := lockStepwiseSession(tx, testSessionID, user.ID)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if s.Finished || s.Timer.expired(s.Now) {
+		return finishedStepwiseResponse(c, tx, testSessionID, s)
+	}
+	if s.Paused {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Test session is paused"})
+	}
+
+	elapsed := activeSeconds(s.Timer.StartedTime, s.Now, s.PausedSeconds) + timerGraceSeconds
+	if err := recordSessionEvents(tx, testSessionID, telemetry.Events, elapsed); err != nil {
+		var invalid invalidEventsError
+		if errors.As(err, &invalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid events: " + err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save events: " + err.Error()})
+	}
+
+	var qid, currentID int
+	err = tx.QueryRow(`
+		SELECT question_id FROM test_session_question_answers
+		WHERE test_session_id = $1 AND index_num = $2`, testSessionID, s.Timer.CurrentQuestionNum).Scan(&currentID)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch current question"})
+	}
+	if raw, ok := body["question_id"].(float64); ok {
+		qid = int(raw)
+		if s.Adaptive && qid != currentID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Only the current question of an adaptive session can be answered"})
+		}
+	} else if err == nil {
+		qid = currentID
+	} else {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "No current question to answer"})
+	}
+
+	saved, err := saveSessionAnswer(tx, testSessionID, qid, answer, s.Scheme, &s.Timer, s.Now)
+	if err != nil {
+		var invalid invalidAnswerError
+		switch {
+		case errors.Is(err, errQuestionNotInSession):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Question %d is not part of this test session", qid),
+			})
+		case errors.As(err, &invalid):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid answer for question %d: %v", qid, err),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to save answer for question %d: %v", qid, err),
+		})
+	}
+	if saved.Late {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Time for this question is up"})
+	}
+	if saved.NewlyAnswered {
+		quota, err := lockDailyQuota(tx, user, time.Now().UTC())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check daily activity"})
+		}
+		if !quota.allows(1) {
+			return quotaExceeded(c, quota)
+		}
+		if err := recordAnsweredQuestion(tx, user.ID, testSessionID, qid, saved.Outcome, s.Now); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to record answered question : " + err.Error(),
+			})
+		}
+	}
+
+	// The session's score is only totalled when it finishes
+	var answeredCount int
+	err = tx.QueryRow(`
+		UPDATE test_sessions
+		SET started = true,
+		    updated_time = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING (SELECT COUNT(*) FROM test_session_question_answers WHERE test_session_id = $1 AND answered)`,
+		testSessionID).Scan(&answeredCount)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update test session"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":            "success",
+		"question_id":       qid,
+		"answered":          answer.Answered,
+		"answered_count":    answeredCount,
+		"n_total_questions": s.Timer.NTotalQuestions,
+	})
+}
@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ShijuPJohn/synapticz_backend/models"
 	"github.com/ShijuPJohn/synapticz_backend/util"
@@ -15,65 +17,167 @@ import (
 	"time"
 )
 
-func getRandomOrderList() []int {
-	list := []int{0, 1, 2, 3}
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	r.Shuffle(len(list), func(i, j int) {
-		list[i], list[j] = list[j], list[i]
-	})
-	return list
-}
-
 func CreateTestSession(c *fiber.Ctx) error {
 	type CreateTestSessionInput struct {
-		QuestionSetID      int    `json:"question_set_id"`
-		Mode               string `json:"mode"` // practice, exam, timed-practice
-		RandomizeQuestions bool   `json:"randomize_questions"`
-		SecondsPerQuestion int    `json:"seconds_per_question"`
-		TimeCapSeconds     int    `json:"time_cap_seconds"`
+		QuestionSetID      int          `json:"question_set_id"`
+		Mode               string       `json:"mode"` // untimed, q_timed or t_timed
+		RandomizeQuestions bool         `json:"randomize_questions"`
+		SecondsPerQuestion int          `json:"seconds_per_question"`
+		TimeCapSeconds     int          `json:"time_cap_seconds"`
+		SelectionMode      string       `json:"selection_mode"` // fixed (default) or adaptive
+		Pool               adaptivePool `json:"pool"`
+		MaxQuestions       int          `json:"max_questions"`
+		TargetSE           float64      `json:"target_se"`
+		// Without a question set, a fixed session can be drawn from filters instead
+		Filters *questionFilterSpec `json:"filters"`
+		// stepwise sessions are served one question at a time and keep the answer key until they finish
+		Delivery string `json:"delivery"`
+		// Samples the first questions of a set the user can't start yet
+		Preview bool `json:"preview"`
 	}
 
 	var input CreateTestSessionInput
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input " + err.Error()})
 	}
+	if input.Mode == "" {
+		input.Mode = "untimed"
+	}
+	switch input.Mode {
+	case "untimed":
+	case "q_timed":
+		if input.SecondsPerQuestion <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "seconds_per_question is required for q_timed sessions"})
+		}
+	case "t_timed":
+		if input.TimeCapSeconds <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "time_cap_seconds is required for t_timed sessions"})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mode must be one of untimed, q_timed or t_timed"})
+	}
+	if input.Delivery == "" {
+		input.Delivery = "full"
+	}
+	if input.Delivery != "full" && input.Delivery != "stepwise" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "delivery must be full or stepwise"})
+	}
 	user := c.Locals("user").(models.User)
+	previewLimit := 0
+	if input.QuestionSetID > 0 {
+		canStart, lockedReason, err := questionSetAccess(util.DB, input.QuestionSetID, &user)
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Question set not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access to the question set"})
+		}
+		if !canStart {
+			adaptive := input.SelectionMode == "adaptive"
+			if !input.Preview || adaptive {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":             "This question set is locked",
+					"locked_reason":     lockedReason,
+					"preview_available": !adaptive,
+				})
+			}
+			previewLimit = previewQuestionCount()
+		}
+	}
+	switch input.SelectionMode {
+	case "", "fixed":
+	case "adaptive":
+		return createAdaptiveTestSession(c, user, adaptiveSessionInput{
+			QuestionSetID:  input.QuestionSetID,
+			Pool:           input.Pool,
+			Mode:           input.Mode,
+			TimeCapSeconds: input.TimeCapSeconds,
+			MaxQuestions:   input.MaxQuestions,
+			TargetSE:       input.TargetSE,
+		})
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "selection_mode must be fixed or adaptive"})
+	}
+	if input.QuestionSetID <= 0 {
+		if input.Filters == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "question_set_id or filters is required"})
+		}
+		return createCustomTestSession(c, user, *input.Filters, newTestSession{
+			Mode:               input.Mode,
+			SecondsPerQuestion: input.SecondsPerQuestion,
+			TimeCapSeconds:     input.TimeCapSeconds,
+			Delivery:           input.Delivery,
+		})
+	}
 	// Get question IDs for the set
 	rows, err := util.DB.Query(`
-		SELECT question_id,mark FROM question_set_questions WHERE question_set_id = $1
+		SELECT qsq.question_id, qsq.mark, COALESCE(array_length(q.options, 1), 0), q.question_type
+		FROM question_set_questions qsq
+		JOIN questions q ON q.id = qsq.question_id
+		WHERE qsq.question_set_id = $1
+		ORDER BY qsq.question_id
 	`, input.QuestionSetID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question IDs"})
 	}
 	defer rows.Close()
 
-	var questionIDs []int
-	var marks []float64
+	var questions []sessionQuestion
 	for rows.Next() {
-		var id int
-		var mark float64
-		if err := rows.Scan(&id, &mark); err != nil {
+		var q sessionQuestion
+		if err := rows.Scan(&q.ID, &q.Mark, &q.NOptions, &q.QuestionType); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read question ID"})
 		}
-		questionIDs = append(questionIDs, id)
-		marks = append(marks, mark)
+		questions = append(questions, q)
 	}
 
-	if len(questionIDs) == 0 {
+	if len(questions) == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No questions found in the set"})
 	}
+	if previewLimit > 0 && len(questions) > previewLimit {
+		questions = questions[:previewLimit]
+	}
 	if input.RandomizeQuestions {
 		r := rand.New(rand.NewSource(time.Now().UnixNano()))
-		r.Shuffle(len(questionIDs), func(i, j int) {
-			questionIDs[i], questionIDs[j] = questionIDs[j], questionIDs[i]
+		r.Shuffle(len(questions), func(i, j int) {
+			questions[i], questions[j] = questions[j], questions[i]
 		})
 	}
-	// Get question set name
-	var qsetName string
-	err = util.DB.QueryRow("SELECT name FROM question_sets WHERE id = $1", input.QuestionSetID).Scan(&qsetName)
+	questionIDs := make([]int, len(questions))
+	for i, q := range questions {
+		questionIDs[i] = q.ID
+	}
+	// Get question set name and the marking scheme the session will be graded with
+	var qsetName, subject, exam, language string
+	var scheme markingScheme
+	err = util.DB.QueryRow("SELECT name, marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, subject, exam, language FROM question_sets WHERE id = $1", input.QuestionSetID).
+		Scan(&qsetName, &scheme.MSelectPolicy, &scheme.NegativeMarkRatio, &scheme.UnansweredPenaltyRatio, &subject, &exam, &language)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set name"})
 	}
+	session := newTestSession{
+		Name:               qsetName,
+		QuestionSetID:      &input.QuestionSetID,
+		SourceType:         "question_set",
+		UserID:             user.ID,
+		Mode:               input.Mode,
+		SecondsPerQuestion: input.SecondsPerQuestion,
+		TimeCapSeconds:     input.TimeCapSeconds,
+		Scheme:             scheme,
+		Delivery:           input.Delivery,
+	}
+	// A preview isn't an attempt at the set, so it stays out of its ranks, reviews and analysis
+	if previewLimit > 0 {
+		spec, err := json.Marshal(fiber.Map{"question_set_id": input.QuestionSetID, "subject": subject, "exam": exam, "language": language})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode preview"})
+		}
+		sourceSpec := string(spec)
+		session.Name = qsetName + " (preview)"
+		session.QuestionSetID = nil
+		session.SourceType = "preview"
+		session.SourceSpec = &sourceSpec
+	}
 
 	// Start a transaction
 	tx, err := util.DB.Begin()
@@ -82,14 +186,62 @@ func CreateTestSession(c *fiber.Ctx) error {
 	}
 	defer tx.Rollback()
 
+	sessionID, err := insertTestSession(tx, session, questions)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create test session " + err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":       "success",
+		"test_session": sessionID,
+		"question_ids": questionIDs,
+		"randomized":   input.RandomizeQuestions,
+		"question_set": qsetName,
+		"preview":      previewLimit > 0,
+	})
+}
+
+// sessionQuestion is a question as it is placed into a new fixed-order session.
+type sessionQuestion struct {
+	ID           int
+	Mark         float64
+	NOptions     int
+	QuestionType string
+}
+
+type newTestSession struct {
+	Name               string
+	QuestionSetID      *int    // nil for sessions not built from a question set
+	SourceType         string  // question_set, filters, review, mistakes or preview
+	SourceSpec         *string // JSON filters of a filters session, or the set a preview samples
+	UserID             int
+	Mode               string
+	SecondsPerQuestion int
+	TimeCapSeconds     int
+	Scheme             markingScheme
+	Delivery           string // full (default) or stepwise
+}
+
+// insertTestSession creates a fixed-order session with the questions in the given order and
+// returns its ID.
+func insertTestSession(tx *sql.Tx, s newTestSession, questions []sessionQuestion) (string, error) {
+	if s.Delivery == "" {
+		s.Delivery = "full"
+	}
 	var sessionID string
-	err = tx.QueryRow(`
-		INSERT INTO test_sessions (name, question_set_id, taken_by_id, n_total_questions, current_question_num, mode, seconds_per_question, time_cap_seconds, remaining_time_seconds)
-		VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $7)
+	err := tx.QueryRow(`
+		INSERT INTO test_sessions (name, question_set_id, taken_by_id, n_total_questions, current_question_num, mode, seconds_per_question, time_cap_seconds, remaining_time_seconds,
+		                           marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, current_question_started_at, source_type, pool_spec, delivery)
+		VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $7, $8, $9, $10, LOCALTIMESTAMP, $11, $12, $13)
 		RETURNING id
-	`, qsetName, input.QuestionSetID, user.ID, len(questionIDs), input.Mode, input.SecondsPerQuestion, input.TimeCapSeconds).Scan(&sessionID)
+	`, s.Name, s.QuestionSetID, s.UserID, len(questions), s.Mode, s.SecondsPerQuestion, s.TimeCapSeconds,
+		s.Scheme.MSelectPolicy, s.Scheme.NegativeMarkRatio, s.Scheme.UnansweredPenaltyRatio, s.SourceType, s.SourceSpec, s.Delivery).Scan(&sessionID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create test session " + err.Error()})
+		return "", err
 	}
 
 	// Prepare for inserting initial answer data
@@ -101,38 +253,27 @@ func CreateTestSession(c *fiber.Ctx) error {
 		) VALUES ($1, $2, $3, $4, $5, $6, $7,$8)
 	`)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to prepare insert for test_session_question_answers"})
+		return "", fmt.Errorf("failed to prepare insert for test_session_question_answers: %w", err)
 	}
 	defer stmtAnswers.Close()
 
-	for i, qid := range questionIDs {
-		orderList := getRandomOrderList()
+	for i, q := range questions {
+		orderList := getRandomOrderList(q.NOptions, q.QuestionType)
 		_, err = stmtAnswers.Exec(
 			sessionID,
-			qid,
+			q.ID,
 			pq.Array(orderList),
 			pq.Array([]int{}), // selected_answer_list empty
-			marks[i],          // total mark per question
+			q.Mark,            // total mark per question
 			0.0,               // scored mark initially 0
 			false,             // not answered yet
 			i,
 		)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to insert into test_session_question_answers : " + err.Error()})
+			return "", fmt.Errorf("failed to insert into test_session_question_answers: %w", err)
 		}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
-	}
-
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"status":       "success",
-		"test_session": sessionID,
-		"question_ids": questionIDs,
-		"randomized":   input.RandomizeQuestions,
-		"question_set": qsetName,
-	})
+	return sessionID, nil
 }
 
 func GetTestSession(c *fiber.Ctx) error {
@@ -148,29 +289,81 @@ func GetTestSession(c *fiber.Ctx) error {
 
 	var session models.TestSession
 	var finishedTime sql.NullTime
+	var pausedSeconds int
+	var sourceSpec []byte // pool_spec, NULL for question set sessions
 	err := util.DB.QueryRow(
 		`SELECT id, finished, started, name, question_set_id, taken_by_id,
                 n_total_questions, current_question_num, n_correctly_answered,
                 rank, total_marks, scored_marks, started_time, finished_time, mode,
-                seconds_per_question, time_cap_seconds, remaining_time_seconds
+                seconds_per_question, time_cap_seconds, remaining_time_seconds,
+                marking_scheme, negative_mark_ratio, unanswered_penalty_ratio, finish_reason,
+                selection_mode, ability_estimate, ability_se, source_type, pool_spec, delivery, paused_seconds
          FROM test_sessions
          WHERE id = $1`, testSessionID).Scan(
 		&session.ID, &session.Finished, &session.Started, &session.Name, &session.QuestionSetID,
 		&session.TakenByID, &session.NTotalQuestions, &session.CurrentQuestionNum,
 		&session.NCorrectlyAnswered, &session.Rank, &session.TotalMarks, &session.ScoredMarks,
 		&session.StartedTime, &finishedTime, &session.Mode, &session.SecondsPerQuestion,
-		&session.TimeCapSeconds, &session.RemainingTime)
+		&session.TimeCapSeconds, &session.RemainingTime,
+		&session.MarkingScheme, &session.NegativeMarkRatio, &session.UnansweredPenaltyRatio, &session.FinishReason,
+		&session.SelectionMode, &session.AbilityEstimate, &session.AbilitySE, &session.SourceType, &sourceSpec,
+		&session.Delivery, &pausedSeconds)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Test session not found"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch session"})
 	}
-	if session.TakenByID != user.ID {
+	// Mentors may read sessions their mentees shared with them; only the learner's own view can finish a session.
+	allowed, err := canViewTestSession(user.ID, testSessionID, session.TakenByID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check access"})
+	}
+	if !allowed {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
+
+	// A timed session whose time ran out is finished before anyone looks at it again.
+	var timer sessionTimer
+	var now time.Time
+	err = util.DB.QueryRow(`SELECT `+sessionTimerColumns+` FROM test_sessions WHERE id = $1`, testSessionID).
+		Scan(timer.scanTargets(&now)...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch session"})
+	}
+	timer.advance(now)
+	if !session.Finished && timer.expired(now) {
+		tx, err := util.DB.Begin()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start transaction"})
+		}
+		defer tx.Rollback()
+		result, err := finalizeTestSession(tx, testSessionID, "time_up")
+		if err != nil && err != errSessionAlreadyFinished {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish test session"})
+		}
+		if err := tx.Commit(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
+		}
+		session.Finished = true
+		session.CurrentQuestionNum = 0
+		timeUp := "time_up"
+		session.FinishReason = &timeUp
+		if err == nil {
+			finishedTime = sql.NullTime{Time: result.FinishedTime, Valid: true}
+			session.TotalMarks, session.ScoredMarks, session.Rank = result.TotalMarks, result.ScoredMarks, result.Rank
+			pausedSeconds = result.PausedSeconds
+		}
+	}
+	var timeTakenSeconds *int
 	if finishedTime.Valid {
 		session.FinishedTime = finishedTime.Time
+		taken := activeSeconds(session.StartedTime, session.FinishedTime, pausedSeconds)
+		timeTakenSeconds = &taken
+	}
+	if !session.Finished && timer.timed() {
+		session.CurrentQuestionNum = timer.CurrentQuestionNum
+		session.RemainingTime = timer.remainingSeconds(now)
 	}
 
 	var questionSet struct {
@@ -179,18 +372,22 @@ func GetTestSession(c *fiber.Ctx) error {
 		CoverImage  *string
 		Subject     string
 	}
-	err = util.DB.QueryRow(
-		`SELECT name, description, cover_image, subject 
+	// Sessions drawn from a subject/tag pool have no question set.
+	questionSet.Name = session.Name
+	if session.QuestionSetID != nil {
+		err = util.DB.QueryRow(
+			`SELECT name, description, cover_image, subject 
          FROM question_sets 
-         WHERE id = $1`, session.QuestionSetID).Scan(
-		&questionSet.Name, &questionSet.Description, &questionSet.CoverImage, &questionSet.Subject)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set"})
+         WHERE id = $1`, *session.QuestionSetID).Scan(
+			&questionSet.Name, &questionSet.Description, &questionSet.CoverImage, &questionSet.Subject)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set"})
+		}
 	}
 
 	var testStats map[string]interface{}
 	if session.Finished {
-		testStats, err = GetTestStats(session.ID, session.QuestionSetID)
+		testStats, err = GetTestStats(session.ID, rankedSetID(session.QuestionSetID, session.SelectionMode))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to calculate test statistics",
@@ -198,12 +395,24 @@ func GetTestSession(c *fiber.Ctx) error {
 		}
 	}
 
+	var telemetry map[int]*questionTelemetry
+	var visitOrder []int
+	if session.Finished {
+		telemetry, visitOrder, err = loadSessionTelemetry(session.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load answer telemetry"})
+		}
+	}
+
+	hideKey := session.Delivery == "stepwise" && !session.Finished
+
 	// Get all questions with answers
 	rows, err := util.DB.Query(
 		`SELECT 
             q.id, q.question, q.question_type, q.options, q.correct_options, q.explanation,
             tsqa.selected_answer_list, tsqa.questions_total_mark, tsqa.questions_scored_mark,
-            tsqa.answered, tsqa.index_num, tsqa.order_list
+            tsqa.answered, tsqa.index_num, tsqa.order_list, q.numeric_answer, tsqa.numeric_answer,
+            tsqa.question_version
          FROM test_session_question_answers tsqa
          JOIN questions q ON tsqa.question_id = q.id
          WHERE tsqa.test_session_id = $1 AND q.deleted<>true ORDER BY tsqa.index_num`, testSessionID)
@@ -228,11 +437,15 @@ func GetTestSession(c *fiber.Ctx) error {
 			answered       bool
 			indexNum       int
 			orderList      []int64
+			numericJSON    []byte
+			numericAnswer  *string
+			gradedVersion  *int
 		)
 
 		err := rows.Scan(
 			&id, &question, &questionType, pq.Array(&options), &correctOptions, &explanation,
 			&selectedAns, &totalMark, &scoredMark, &answered, &indexNum, pq.Array(&orderList),
+			&numericJSON, &numericAnswer, &gradedVersion,
 		)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to scan question"})
@@ -240,6 +453,17 @@ func GetTestSession(c *fiber.Ctx) error {
 
 		questionIDs = append(questionIDs, id)
 
+		// Until a stepwise session finishes, questions are only served one at a time by
+		// GetCurrentSessionQuestion, so the list is just for navigation.
+		if hideKey {
+			questions = append(questions, map[string]interface{}{
+				"id":        id,
+				"index_num": indexNum,
+				"answered":  answered,
+			})
+			continue
+		}
+
 		reorderedOptions := make([]string, 0)
 		reorderedCorrectOptions := make([]int, 0)
 		for i, orderInd := range orderList {
@@ -249,19 +473,30 @@ func GetTestSession(c *fiber.Ctx) error {
 			}
 		}
 
-		questions = append(questions, map[string]interface{}{
-			"id":                    id,
-			"question":              question,
-			"question_type":         questionType,
-			"options":               reorderedOptions,
-			"correct_options":       reorderedCorrectOptions,
-			"explanation":           explanation,
-			"selected_answer_list":  convertToIntSlice(selectedAns),
-			"questions_total_mark":  totalMark,
-			"questions_scored_mark": scoredMark,
-			"answered":              answered,
-			"is_correct":            scoredMark > 0,
-		})
+		questionData := map[string]interface{}{
+			"id":                     id,
+			"question":               question,
+			"question_type":          questionType,
+			"options":                reorderedOptions,
+			"correct_options":        reorderedCorrectOptions,
+			"explanation":            explanation,
+			"selected_answer_list":   convertToIntSlice(selectedAns),
+			"questions_total_mark":   totalMark,
+			"questions_scored_mark":  scoredMark,
+			"answered":               answered,
+			"is_correct":             scoredMark > 0,
+			"numeric_answer":         numericAnswer,
+			"correct_numeric_answer": json.RawMessage(numericJSON),
+			"question_version":       gradedVersion, // the version the answer was graded against
+		}
+		if session.Finished {
+			if t, ok := telemetry[id]; ok {
+				questionData["telemetry"] = t
+			} else {
+				questionData["telemetry"] = &questionTelemetry{}
+			}
+		}
+		questions = append(questions, questionData)
 	}
 
 	// Fetch bookmarked questions for the user
@@ -302,22 +537,39 @@ func GetTestSession(c *fiber.Ctx) error {
 		savedExplanationIDs = append(savedExplanationIDs, qid)
 	}
 
+	var totalMarks, scoredMarks interface{} = session.TotalMarks, session.ScoredMarks
+	if marksHidden(session.Delivery, session.SelectionMode, session.Finished) {
+		totalMarks, scoredMarks = nil, nil
+	}
+
 	response := fiber.Map{
 		"status": "success",
 		"test_session": fiber.Map{
-			"id":                   session.ID,
-			"name":                 session.Name,
-			"mode":                 session.Mode,
-			"finished":             session.Finished,
-			"started_time":         session.StartedTime,
-			"finished_time":        session.FinishedTime,
-			"total_marks":          session.TotalMarks,
-			"scored_marks":         session.ScoredMarks,
-			"current_question_num": session.CurrentQuestionNum,
-			"rank":                 session.Rank,
-			"seconds_per_question": session.SecondsPerQuestion,
-			"time_cap_seconds":     session.TimeCapSeconds,
-			"remaining_time":       session.RemainingTime,
+			"id":                       session.ID,
+			"name":                     session.Name,
+			"mode":                     session.Mode,
+			"finished":                 session.Finished,
+			"started_time":             session.StartedTime,
+			"finished_time":            session.FinishedTime,
+			"time_taken_seconds":       timeTakenSeconds,
+			"total_marks":              totalMarks,
+			"scored_marks":             scoredMarks,
+			"current_question_num":     session.CurrentQuestionNum,
+			"rank":                     session.Rank,
+			"seconds_per_question":     session.SecondsPerQuestion,
+			"time_cap_seconds":         session.TimeCapSeconds,
+			"remaining_time":           session.RemainingTime,
+			"marking_scheme":           session.MarkingScheme,
+			"negative_mark_ratio":      session.NegativeMarkRatio,
+			"unanswered_penalty_ratio": session.UnansweredPenaltyRatio,
+			"finish_reason":            session.FinishReason,
+			"selection_mode":           session.SelectionMode,
+			"ability_estimate":         session.AbilityEstimate,
+			"ability_se":               session.AbilitySE,
+			"source_type":              session.SourceType,
+			"source_spec":              json.RawMessage(sourceSpec),
+			"delivery":                 session.Delivery,
+			"viewed_by_mentor":         session.TakenByID != user.ID,
 		},
 		"question_set": fiber.Map{
 			"id":          session.QuestionSetID,
@@ -333,6 +585,7 @@ func GetTestSession(c *fiber.Ctx) error {
 
 	if session.Finished {
 		response["test_stats"] = testStats
+		response["visit_order"] = visitOrder
 	}
 
 	return c.Status(fiber.StatusOK).JSON(response)
@@ -352,6 +605,7 @@ func UpdateTestSession(c *fiber.Ctx) error {
 		QuestionAnswerData   map[string]interface{} `json:"question_answer_data"`
 		CurrentQuestionIndex int                    `json:"current_question_index"`
 		RemainingTime        *int                   `json:"remaining_time"`
+		Events               []sessionEvent         `json:"events"`
 	}
 
 	testSessionID := c.Params("test_session_id")
@@ -371,11 +625,27 @@ func UpdateTestSession(c *fiber.Ctx) error {
 
 	var takenByID int
 	var finished bool
-	var questionSetID int
-	err := util.DB.QueryRow(
-		`SELECT taken_by_id, finished, question_set_id 
+	var scheme markingScheme
+	var paused bool
+	var pausedSeconds int
+	var delivery, selectionMode string
+	var timer sessionTimer
+	var now time.Time
+
+	tx, err := util.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`SELECT taken_by_id, finished, marking_scheme, negative_mark_ratio, unanswered_penalty_ratio,
+                paused_at IS NOT NULL, paused_seconds, delivery, selection_mode, `+sessionTimerColumns+`
          FROM test_sessions 
-         WHERE id = $1`, testSessionID).Scan(&takenByID, &finished, &questionSetID)
+         WHERE id = $1
+         FOR UPDATE`, testSessionID).Scan(append([]interface{}{&takenByID, &finished,
+		&scheme.MSelectPolicy, &scheme.NegativeMarkRatio, &scheme.UnansweredPenaltyRatio, &paused, &pausedSeconds,
+		&delivery, &selectionMode}, timer.scanTargets(&now)...)...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Test session not found"})
@@ -388,236 +658,452 @@ func UpdateTestSession(c *fiber.Ctx) error {
 	if finished {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "finished", "message": "Test session already finished"})
 	}
-
-	tx, err := util.DB.Begin()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction begin failed"})
+	if delivery == "stepwise" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Stepwise sessions are answered one question at a time at /test_session/:test_session_id/question/answer"})
+	}
+	if paused {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Test session is paused"})
 	}
-	defer tx.Rollback()
-
-	// Check daily question limit for non-premium users
-	if !user.IsPremium {
-		var answeredToday int
-		err := tx.QueryRow(
-			`SELECT COUNT(*) 
-			 FROM user_daily_questions 
-			 WHERE user_id = $1 AND answered_at::date = CURRENT_DATE`, user.ID).Scan(&answeredToday)
 
-		if err != nil && err != sql.ErrNoRows {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to check daily activity " + err.Error(),
-			})
+	// Out of time: nothing in this request counts, the session just ends.
+	timer.advance(now)
+	if timer.expired(now) {
+		result, err := finalizeTestSession(tx, testSessionID, "time_up")
+		if err != nil && err != errSessionAlreadyFinished {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish test session"})
+		}
+		if err := tx.Commit(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
 		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":        "finished",
+			"message":       "Time is up, the test session has been finished",
+			"finish_reason": "time_up",
+			"scored_marks":  result.ScoredMarks,
+			"total_marks":   result.TotalMarks,
+		})
+	}
 
-		//var questionLimit int
-		//err = tx.QueryRow(
-		//	`SELECT questions_limit
-		//     FROM user_daily_activity
-		//     WHERE user_id = $1 AND activity_date = CURRENT_DATE`, user.ID).Scan(&questionLimit)
-		//if err != nil {
-		//	if err == sql.ErrNoRows {
-		//		questionLimit = 20
-		//	} else {
-		//		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-		//			"error": "Failed to get question limit",
-		//		})
-		//	}
-		//}
+	// Answers count against the daily quota once they are graded for the first time
+	quota, err := lockDailyQuota(tx, user, time.Now().UTC())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check daily activity " + err.Error(),
+		})
+	}
 
-		newAnswers := 0
-		for _, val := range dto.QuestionAnswerData {
-			answer, ok := val.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			if answered, ok := answer["answered"].(bool); ok && answered {
-				newAnswers++
-			}
+	// Telemetry events are stored as sent, once they make sense for this session.
+	elapsed := activeSeconds(timer.StartedTime, now, pausedSeconds) + timerGraceSeconds
+	if err := recordSessionEvents(tx, testSessionID, dto.Events, elapsed); err != nil {
+		var invalid invalidEventsError
+		if errors.As(err, &invalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid events: " + err.Error()})
 		}
-
-		//if answeredToday+newAnswers > questionLimit {
-		//	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-		//		"error": fmt.Sprintf("Daily question limit reached (%d/%d)", answeredToday, questionLimit),
-		//	})
-		//}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save events: " + err.Error()})
 	}
 
-	var totalScored float64
-	var totalMarks float64
-	var newlyAnsweredQuestions []int
+	newlyAnswered := make(map[int]answerOutcome)
+	// Answers that arrive after their question's time ran out are ignored, not graded.
+	lateQuestionIDs := []int{}
 
 	for qidStr, val := range dto.QuestionAnswerData {
 		qid, err := strconv.Atoi(qidStr)
 		if err != nil {
 			continue
 		}
-		answer, ok := val.(map[string]interface{})
-		if !ok {
+		answer, err := parseSubmittedAnswer(val)
+		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("Invalid answer format for question ID: %s", qidStr),
+				"error": fmt.Sprintf("Invalid answer format for question ID %s: %v", qidStr, err),
 			})
 		}
 
-		selectedListRaw, ok := answer["selected_answer_list"].([]interface{})
-		if !ok {
-			selectedListRaw = []interface{}{}
-		}
-
-		correctListRaw, ok := answer["correct_options"].([]interface{})
-		if !ok {
-			correctListRaw = []interface{}{}
+		saved, err := saveSessionAnswer(tx, testSessionID, qid, answer, scheme, &timer, now)
+		if err != nil {
+			var invalid invalidAnswerError
+			switch {
+			case errors.Is(err, errQuestionNotInSession):
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("Question %d is not part of this test session", qid),
+				})
+			case errors.As(err, &invalid):
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("Invalid answer for question %d: %v", qid, err),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Failed to save answer for question %d: %v", qid, err),
+			})
 		}
-
-		selectedList := make([]int64, len(selectedListRaw))
-		for i, v := range selectedListRaw {
-			selectedList[i] = int64(v.(float64))
+		if saved.Late {
+			lateQuestionIDs = append(lateQuestionIDs, qid)
+			continue
 		}
-		correctList := make([]int64, len(correctListRaw))
-		for i, v := range correctListRaw {
-			correctList[i] = int64(v.(float64))
+		if saved.NewlyAnswered {
+			newlyAnswered[qid] = saved.Outcome
 		}
+	}
+	if !quota.allows(len(newlyAnswered)) {
+		return quotaExceeded(c, quota)
+	}
 
-		totalMark := answer["questions_total_mark"].(float64)
-		answered := answer["answered"].(bool)
+	totalScored, totalMarks, err := sessionTotals(tx, testSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to total session marks"})
+	}
 
-		totalMarks += totalMark
+	// The clock of timed sessions belongs to the server; the client's remaining_time only
+	// matters for untimed sessions.
+	timer.moveTo(dto.CurrentQuestionIndex, now)
+	remainingTime := dto.RemainingTime
+	if timer.timed() {
+		remainingTime = timer.remainingSeconds(now)
+	}
 
-		var previouslyAnswered bool
-		err = tx.QueryRow(
-			`SELECT answered 
-			 FROM test_session_question_answers 
-			 WHERE test_session_id = $1 AND question_id = $2`,
-			testSessionID, qid).Scan(&previouslyAnswered)
-		if err != nil && err != sql.ErrNoRows {
+	_, err = tx.Exec(`
+		UPDATE test_sessions
+		SET current_question_num = $1,
+		    scored_marks = $2,
+		    total_marks = $3,
+		    updated_time = CURRENT_TIMESTAMP,
+		    remaining_time_seconds=$4,
+		    current_question_started_at = $5
+		WHERE id = $6
+	`, timer.CurrentQuestionNum, totalScored, totalMarks, remainingTime, timer.QuestionStartedAt, testSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update test session"})
+	}
+
+	for qid, outcome := range newlyAnswered {
+		if err := recordAnsweredQuestion(tx, user.ID, testSessionID, qid, outcome, now); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": fmt.Sprintf("Failed to check previous answer status for question %d", qid),
+				"error": "Failed to record answered question : " + err.Error(),
 			})
 		}
+	}
 
-		if answered && !previouslyAnswered {
-			newlyAnsweredQuestions = append(newlyAnsweredQuestions, qid)
-		}
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	}
 
-		var qType string
-		err = tx.QueryRow(`SELECT question_type FROM questions WHERE id = $1`, qid).Scan(&qType)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": fmt.Sprintf("Failed to get question type for question %d: %v", qid, err),
-			})
-		}
+	response := fiber.Map{
+		"status":               "success",
+		"current_question_num": timer.CurrentQuestionNum,
+		"scored_marks":         totalScored,
+		"total_marks":          totalMarks,
+		"remaining_time":       remainingTime,
+		"late_question_ids":    lateQuestionIDs,
+	}
+	if marksHidden(delivery, selectionMode, false) {
+		response["scored_marks"], response["total_marks"] = nil, nil
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
 
-		var scored float64 = 0
-		if qType == "m-choice" {
-			if len(selectedList) == 1 && len(correctList) == 1 && selectedList[0] == correctList[0] {
-				scored = totalMark
-			}
-		} else if qType == "m-select" {
-			if len(selectedList) > 0 {
-				hasWrong := false
-				correctMap := make(map[int64]bool)
-				for _, c := range correctList {
-					correctMap[c] = true
-				}
-				for _, selected := range selectedList {
-					if !correctMap[selected] {
-						hasWrong = true
-						break
-					}
-				}
-				if !hasWrong {
-					fraction := float64(len(selectedList)) / float64(len(correctList))
-					scored = totalMark * fraction
-				}
-			}
-		}
+// marksHidden reports whether a session's running score is withheld. Sessions served one
+// question at a time only show it once they finish, or answers could be tried until the
+// score goes up.
+func marksHidden(delivery, selectionMode string, finished bool) bool {
+	return !finished && (delivery == "stepwise" || selectionMode == "adaptive")
+}
 
-		totalScored += scored
+// rankedSetID is the question set a session is ranked and compared within. Adaptive sessions
+// pick their own questions from the set, so they're only compared against themselves.
+func rankedSetID(questionSetID *int, selectionMode string) *int {
+	if selectionMode == "adaptive" {
+		return nil
+	}
+	return questionSetID
+}
 
-		_, err = tx.Exec(`
-			UPDATE test_session_question_answers
-			SET selected_answer_list = $1,
-			    questions_scored_mark = $2,
-			    answered = $3
-			WHERE test_session_id = $4 AND question_id = $5
-		`, pq.Array(selectedList), scored, answered, testSessionID, qid)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": fmt.Sprintf("Failed to update answer for question %d: %v", qid, err),
-			})
+var errQuestionNotInSession = errors.New("question is not part of this test session")
+
+// invalidAnswerError is an answer that can't be graded against its question.
+type invalidAnswerError struct{ err error }
+
+func (e invalidAnswerError) Error() string { return e.err.Error() }
+
+// savedAnswer is what saveSessionAnswer did with one answer.
+type savedAnswer struct {
+	Late          bool // the question's time had run out, so nothing was saved
+	NewlyAnswered bool // answered now for the first time; Outcome says how it went
+	Outcome       answerOutcome
+}
+
+// saveSessionAnswer grades an answer to question qid of a session and stores it. Scores come
+// only from the stored answer key and the session's order_list; the client is trusted for
+// nothing but its selections.
+func saveSessionAnswer(tx *sql.Tx, testSessionID string, qid int, answer submittedAnswer, scheme markingScheme, timer *sessionTimer, now time.Time) (savedAnswer, error) {
+	var (
+		saved              savedAnswer
+		previouslyAnswered bool
+		indexNum           int
+		orderList          pq.Int64Array
+		totalMark          float64
+		key                answerKey
+		correctOptions     pq.Int64Array
+		numericJSON        []byte
+		questionVersion    int
+	)
+	err := tx.QueryRow(
+		`SELECT tsqa.answered, tsqa.index_num, tsqa.order_list, tsqa.questions_total_mark,
+		        q.question_type, q.options, q.correct_options, q.numeric_answer, q.version
+		 FROM test_session_question_answers tsqa
+		 JOIN questions q ON q.id = tsqa.question_id
+		 WHERE tsqa.test_session_id = $1 AND tsqa.question_id = $2`,
+		testSessionID, qid).Scan(&previouslyAnswered, &indexNum, &orderList, &totalMark,
+		&key.QuestionType, pq.Array(&key.Options), &correctOptions, &numericJSON, &questionVersion)
+	if err == sql.ErrNoRows {
+		return saved, errQuestionNotInSession
+	}
+	if err != nil {
+		return saved, fmt.Errorf("failed to load question: %w", err)
+	}
+	if !timer.acceptsAnswer(indexNum, now) {
+		saved.Late = true
+		return saved, nil
+	}
+	key.CorrectOptions = correctOptions
+	if key.Numeric, err = parseNumericAnswerJSON(numericJSON); err != nil {
+		return saved, fmt.Errorf("failed to read numeric answer key: %w", err)
+	}
+
+	scored, correct, err := gradeAnswer(key, orderList, answer, totalMark, scheme)
+	if err != nil {
+		return saved, invalidAnswerError{err}
+	}
+	// A selection the learner hasn't committed to yet is not charged negative marks.
+	if !answer.Answered && scored < 0 {
+		scored = 0
+	}
+
+	if answer.Answered && !previouslyAnswered {
+		saved.NewlyAnswered = true
+		saved.Outcome = answerOutcome{Correct: correct}
+		if totalMark > 0 {
+			saved.Outcome.ScoredFraction = scored / totalMark
 		}
 	}
 
 	_, err = tx.Exec(`
-		UPDATE test_sessions
-		SET current_question_num = $1,
-		    scored_marks = $2,
-		    total_marks = $3,
-		    updated_time = CURRENT_TIMESTAMP,
-		    remaining_time_seconds=$4
-		WHERE id = $5
-	`, dto.CurrentQuestionIndex, totalScored, totalMarks, dto.RemainingTime, testSessionID)
+		UPDATE test_session_question_answers
+		SET selected_answer_list = $1,
+		    questions_scored_mark = $2,
+		    answered = $3,
+		    numeric_answer = $4,
+		    question_version = $5,
+		    answered_correct = $6
+		WHERE test_session_id = $7 AND question_id = $8
+	`, pq.Array(answer.Selected), scored, answer.Answered, answer.NumericAnswer, questionVersion, correct, testSessionID, qid)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update test session"})
+		return saved, fmt.Errorf("failed to update answer: %w", err)
 	}
+	return saved, nil
+}
 
-	// Log individual question entries (no activity_date)
-	if len(newlyAnsweredQuestions) > 0 {
-		for _, qid := range newlyAnsweredQuestions {
-			var answeredCorrect bool
+// sessionTotals sums the scored and total marks of a session's questions.
+func sessionTotals(tx *sql.Tx, testSessionID string) (scored, total float64, err error) {
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(questions_scored_mark), 0), COALESCE(SUM(questions_total_mark), 0)
+		FROM test_session_question_answers
+		WHERE test_session_id = $1
+	`, testSessionID).Scan(&scored, &total)
+	return scored, total, err
+}
 
-			// Look up selected/correct lists again (already parsed before)
-			answer := dto.QuestionAnswerData[strconv.Itoa(qid)].(map[string]interface{})
-			selectedListRaw, _ := answer["selected_answer_list"].([]interface{})
-			correctListRaw, _ := answer["correct_options"].([]interface{})
+// recordAnsweredQuestion logs a newly answered question for the daily stats, the review
+// schedule and the mistake notebook.
+func recordAnsweredQuestion(tx *sql.Tx, userID int, testSessionID string, qid int, outcome answerOutcome, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_daily_questions (user_id, question_id, answered_correct, taken_duration_seconds)
+		VALUES ($1, $2, $3, (
+		    SELECT SUM(duration_seconds) FROM test_session_events
+		    WHERE test_session_id = $4 AND question_id = $2 AND event_type = 'visit'
+		))
+		ON CONFLICT (user_id, question_id, answered_at) DO UPDATE
+		SET answered_correct = EXCLUDED.answered_correct,
+		    taken_duration_seconds = EXCLUDED.taken_duration_seconds
+	`, userID, qid, outcome.Correct, testSessionID)
+	if err != nil {
+		return err
+	}
+	if err := recordReview(tx, userID, qid, reviewQuality(outcome.Correct, outcome.ScoredFraction), now); err != nil {
+		return fmt.Errorf("failed to schedule review: %w", err)
+	}
+	if err := updateMistakeStreak(tx, userID, qid, now); err != nil {
+		return fmt.Errorf("failed to update mistake notebook: %w", err)
+	}
+	return nil
+}
 
-			selectedList := make([]int64, len(selectedListRaw))
-			for i, v := range selectedListRaw {
-				selectedList[i] = int64(v.(float64))
-			}
-			correctList := make([]int64, len(correctListRaw))
-			for i, v := range correctListRaw {
-				correctList[i] = int64(v.(float64))
-			}
+func PauseTestSession(c *fiber.Ctx) error {
+	return setTestSessionPaused(c, true)
+}
 
-			if len(selectedList) == len(correctList) {
-				match := true
-				correctMap := make(map[int64]bool)
-				for _, c := range correctList {
-					correctMap[c] = true
-				}
-				for _, s := range selectedList {
-					if !correctMap[s] {
-						match = false
-						break
-					}
-				}
-				answeredCorrect = match
-			}
+func ResumeTestSession(c *fiber.Ctx) error {
+	return setTestSessionPaused(c, false)
+}
 
-			_, err = tx.Exec(`
-			INSERT INTO user_daily_questions (user_id, question_id, answered_correct)
-			VALUES ($1, $2, $3)
-			ON CONFLICT (user_id, question_id, answered_at) DO UPDATE SET answered_correct = EXCLUDED.answered_correct
-		`, user.ID, qid, answeredCorrect)
+// setTestSessionPaused pauses or resumes a session if its mode allows it (see pauseAllowed).
+// Time spent paused is kept in paused_seconds and left out of the time the session took.
+func setTestSessionPaused(c *fiber.Ctx, pause bool) error {
+	testSessionID := c.Params("test_session_id")
+	user := c.Locals("user").(models.User)
 
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to record answered question : " + err.Error(),
-				})
-			}
+	var takenByID int
+	var finished, paused bool
+	var mode string
+	err := util.DB.QueryRow(
+		`SELECT taken_by_id, finished, mode, paused_at IS NOT NULL
+         FROM test_sessions
+         WHERE id = $1`, testSessionID).Scan(&takenByID, &finished, &mode, &paused)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Test session not found"})
 		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch test session"})
+	}
+	if takenByID != user.ID {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	if finished {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Test session is already finished"})
+	}
+	if !pauseAllowed[mode] {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": fmt.Sprintf("%s test sessions cannot be paused", mode)})
+	}
+	if paused && pause {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Test session is already paused"})
+	}
+	if !paused && !pause {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Test session is not paused"})
 	}
 
-	if err := tx.Commit(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Transaction commit failed"})
+	if pause {
+		_, err = util.DB.Exec(`UPDATE test_sessions SET paused_at = LOCALTIMESTAMP WHERE id = $1`, testSessionID)
+	} else {
+		_, err = util.DB.Exec(`
+			UPDATE test_sessions
+			SET paused_seconds = paused_seconds + EXTRACT(EPOCH FROM LOCALTIMESTAMP - paused_at)::int,
+			    paused_at = NULL,
+			    updated_time = CURRENT_TIMESTAMP
+			WHERE id = $1`, testSessionID)
 	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update test session"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "paused": pause})
+}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"status":               "success",
-		"current_question_num": dto.CurrentQuestionIndex,
-		"scored_marks":         totalScored,
-		"total_marks":          totalMarks,
-	})
+// sessionResult is what finalizing a test session produces.
+type sessionResult struct {
+	QuestionSetID *int
+	TotalMarks    float64
+	ScoredMarks   float64
+	TotalAnswered int
+	Correct       int
+	Wrong         int
+	Unanswered    int
+	Rank          *int // nil for sessions without a question set to rank against
+	PausedSeconds int
+	RankedSetID   *int // the set the session is ranked within; nil for pool and adaptive sessions
+	FinishedTime  time.Time
+}
+
+var errSessionAlreadyFinished = errors.New("test session is already finished")
+
+// finalizeTestSession finishes a test session inside tx: it applies the unanswered penalty,
+// totals the marks, ranks the session among the finished attempts of its question set and
+// records why it finished (submitted, time_up, ...). FinishTestSession and the timers share it.
+// Sessions that weren't abandoned also get the user's automatic shoutouts.
+func finalizeTestSession(tx *sql.Tx, testSessionID string, reason string) (sessionResult, error) {
+	var result sessionResult
+	var finished bool
+	var unansweredPenaltyRatio float64
+	var selectionMode string
+	err := tx.QueryRow(
+		`SELECT question_set_id, finished, unanswered_penalty_ratio, selection_mode
+         FROM test_sessions
+         WHERE id = $1
+         FOR UPDATE`, testSessionID).Scan(&result.QuestionSetID, &finished, &unansweredPenaltyRatio, &selectionMode)
+	if err != nil {
+		return result, err
+	}
+	result.RankedSetID = rankedSetID(result.QuestionSetID, selectionMode)
+	if finished {
+		return result, errSessionAlreadyFinished
+	}
+
+	// Questions still unanswered at finish cost the session's unanswered penalty
+	if unansweredPenaltyRatio > 0 {
+		_, err = tx.Exec(
+			`UPDATE test_session_question_answers
+             SET questions_scored_mark = -($1 * questions_total_mark)
+             WHERE test_session_id = $2 AND NOT answered`, unansweredPenaltyRatio, testSessionID)
+		if err != nil {
+			return result, fmt.Errorf("failed to apply unanswered penalty: %w", err)
+		}
+	}
+
+	err = tx.QueryRow(
+		`SELECT 
+            COALESCE(SUM(questions_total_mark), 0) as total_marks,
+            COALESCE(SUM(questions_scored_mark), 0) as scored_marks,
+            COUNT(CASE WHEN answered THEN 1 END) as total_answered,
+            COUNT(CASE WHEN questions_scored_mark > 0 THEN 1 END) as correct,
+            COUNT(CASE WHEN answered AND questions_scored_mark <= 0 THEN 1 END) as wrong,
+            COUNT(CASE WHEN NOT answered THEN 1 END) as unanswered
+         FROM test_session_question_answers
+         WHERE test_session_id = $1`, testSessionID).Scan(
+		&result.TotalMarks, &result.ScoredMarks, &result.TotalAnswered,
+		&result.Correct, &result.Wrong, &result.Unanswered)
+	if err != nil {
+		return result, fmt.Errorf("failed to calculate test results: %w", err)
+	}
+
+	if result.RankedSetID != nil {
+		var rank int
+		err = tx.QueryRow(
+			`SELECT COUNT(*) + 1 FROM test_sessions
+         WHERE question_set_id = $1 AND selection_mode = 'fixed' AND finished = true AND scored_marks > $2`,
+			*result.RankedSetID, result.ScoredMarks).Scan(&rank)
+		if err != nil {
+			return result, fmt.Errorf("failed to rank test session: %w", err)
+		}
+		result.Rank = &rank
+	}
+
+	// finished_time is on the database clock, like started_time and the pause columns it is
+	// compared with. A session finished while paused stops its pause there.
+	err = tx.QueryRow(
+		`UPDATE test_sessions
+         SET finished = true,
+             finished_time = LOCALTIMESTAMP,
+             total_marks = $1,
+             scored_marks = $2,
+             current_question_num = 0,
+             rank = $3,
+             finish_reason = $4,
+             remaining_time_seconds = CASE WHEN mode = 'untimed' THEN remaining_time_seconds ELSE 0 END,
+             paused_seconds = paused_seconds + COALESCE(EXTRACT(EPOCH FROM LOCALTIMESTAMP - paused_at)::int, 0),
+             paused_at = NULL
+         WHERE id = $5
+         RETURNING finished_time, paused_seconds`,
+		result.TotalMarks, result.ScoredMarks, result.Rank, reason, testSessionID).Scan(&result.FinishedTime, &result.PausedSeconds)
+	if err != nil {
+		return result, fmt.Errorf("failed to finish test session: %w", err)
+	}
+	// An abandoned session's untouched questions weren't really skipped, so only its wrong
+	// answers go to the mistake notebook.
+	if err := collectMistakes(tx, testSessionID, reason != "abandoned", result.FinishedTime); err != nil {
+		return result, fmt.Errorf("failed to collect mistakes: %w", err)
+	}
+	if reason != "abandoned" {
+		if err := postAutoShoutouts(tx, testSessionID, result); err != nil {
+			return result, fmt.Errorf("failed to post shoutouts: %w", err)
+		}
+	}
+	return result, nil
 }
 
 func FinishTestSession(c *fiber.Ctx) error {
@@ -633,14 +1119,15 @@ func FinishTestSession(c *fiber.Ctx) error {
 	// Verify test session ownership and status
 	var takenByID int
 	var finished bool
-	var startedTime time.Time
-	var questionSetID int
+	var questionSetID *int
 	var sessionName string
-	var sessionMode string
+	var timer sessionTimer
+	var now time.Time
 	err := util.DB.QueryRow(
-		`SELECT taken_by_id, finished, started_time, question_set_id, name, mode 
+		`SELECT taken_by_id, finished, question_set_id, name, `+sessionTimerColumns+`
          FROM test_sessions 
-         WHERE id = $1`, testSessionID).Scan(&takenByID, &finished, &startedTime, &questionSetID, &sessionName, &sessionMode)
+         WHERE id = $1`, testSessionID).Scan(append([]interface{}{&takenByID, &finished, &questionSetID, &sessionName},
+		timer.scanTargets(&now)...)...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -663,32 +1150,18 @@ func FinishTestSession(c *fiber.Ctx) error {
 	}
 	defer tx.Rollback()
 
-	// Get basic test results
-	var testResult struct {
-		TotalMarks    float64
-		ScoredMarks   float64
-		TotalAnswered int
-		Correct       int
-		Wrong         int
-		Unanswered    int
+	reason := "submitted"
+	if timer.expired(now) {
+		reason = "time_up"
 	}
-
-	err = tx.QueryRow(
-		`SELECT 
-            COALESCE(SUM(questions_total_mark), 0) as total_marks,
-            COALESCE(SUM(questions_scored_mark), 0) as scored_marks,
-            COUNT(CASE WHEN answered THEN 1 END) as total_answered,
-            COUNT(CASE WHEN questions_scored_mark > 0 THEN 1 END) as correct,
-            COUNT(CASE WHEN answered AND questions_scored_mark = 0 THEN 1 END) as wrong,
-            COUNT(CASE WHEN NOT answered THEN 1 END) as unanswered
-         FROM test_session_question_answers
-         WHERE test_session_id = $1`, testSessionID).Scan(
-		&testResult.TotalMarks, &testResult.ScoredMarks, &testResult.TotalAnswered,
-		&testResult.Correct, &testResult.Wrong, &testResult.Unanswered)
-
+	testResult, err := finalizeTestSession(tx, testSessionID, reason)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to calculate test results"})
+		if err == errSessionAlreadyFinished {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Test session is already finished"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish test session"})
 	}
+	finishedTime := testResult.FinishedTime
 
 	// Get question set details
 	var questionSet struct {
@@ -698,37 +1171,29 @@ func FinishTestSession(c *fiber.Ctx) error {
 		Subject     string
 		TotalQs     int
 	}
-	err = tx.QueryRow(
-		`SELECT qs.name, qs.description, qs.cover_image, qs.subject,
+	if questionSetID != nil {
+		err = tx.QueryRow(
+			`SELECT qs.name, qs.description, qs.cover_image, qs.subject,
             (SELECT COUNT(*) FROM question_set_questions WHERE question_set_id = qs.id) as total_questions
          FROM question_sets qs
-         WHERE qs.id = $1`, questionSetID).Scan(
-		&questionSet.Name, &questionSet.Description, &questionSet.CoverImage,
-		&questionSet.Subject, &questionSet.TotalQs)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set details"})
+         WHERE qs.id = $1`, *questionSetID).Scan(
+			&questionSet.Name, &questionSet.Description, &questionSet.CoverImage,
+			&questionSet.Subject, &questionSet.TotalQs)
+	} else {
+		// Pool sessions: the session itself is the "set".
+		questionSet.Name = sessionName
+		err = tx.QueryRow(
+			`SELECT COALESCE(pool_spec->>'subject', ''), n_total_questions FROM test_sessions WHERE id = $1`,
+			testSessionID).Scan(&questionSet.Subject, &questionSet.TotalQs)
 	}
-
-	// First mark the test session as finished
-	finishedTime := time.Now().UTC()
-	_, err = tx.Exec(
-		`UPDATE test_sessions
-         SET finished = true,
-             finished_time = $1,
-             total_marks = $2,
-             scored_marks = $3,
-             current_question_num = 0
-         WHERE id = $4`,
-		finishedTime, testResult.TotalMarks, testResult.ScoredMarks, testSessionID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish test session"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch question set details"})
 	}
 
 	// Now get historical stats (including this test session)
 	var stats struct {
 		Attempts int
 		AvgScore float64
-		UserRank int
 		TopScore float64
 	}
 
@@ -736,31 +1201,20 @@ func FinishTestSession(c *fiber.Ctx) error {
 		`SELECT 
             COUNT(*) as attempts,
             COALESCE(AVG(scored_marks), 0) as avg_score,
-            (SELECT COUNT(*) FROM test_sessions 
-             WHERE question_set_id = $1 AND finished = true AND scored_marks > $2) + 1 as user_rank,
             COALESCE(MAX(scored_marks), 0) as top_score
          FROM test_sessions 
-         WHERE question_set_id = $1 AND finished = true`, questionSetID, testResult.ScoredMarks).Scan(
-		&stats.Attempts, &stats.AvgScore, &stats.UserRank, &stats.TopScore)
+         WHERE finished = true AND ((question_set_id = $1 AND selection_mode = 'fixed') OR ($1 IS NULL AND id = $2))`, testResult.RankedSetID, testSessionID).Scan(
+		&stats.Attempts, &stats.AvgScore, &stats.TopScore)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch historical stats"})
 	}
 
-	// Update the rank now that we've calculated it
-	_, err = tx.Exec(
-		`UPDATE test_sessions
-         SET rank = $1
-         WHERE id = $2`,
-		stats.UserRank, testSessionID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update test session rank"})
-	}
-
 	// Get all questions with answers for response
 	rows, err := tx.Query(
 		`SELECT 
 	q.id, q.question, q.question_type, q.options, q.correct_options, q.explanation,
-	tsqa.selected_answer_list, tsqa.questions_total_mark, tsqa.questions_scored_mark, tsqa.answered, tsqa.index_num, tsqa.order_list
+	tsqa.selected_answer_list, tsqa.questions_total_mark, tsqa.questions_scored_mark, tsqa.answered, tsqa.index_num, tsqa.order_list,
+	q.numeric_answer, tsqa.numeric_answer, tsqa.question_version
          FROM test_session_question_answers tsqa
          JOIN questions q ON tsqa.question_id = q.id
          WHERE tsqa.test_session_id = $1
@@ -785,11 +1239,15 @@ func FinishTestSession(c *fiber.Ctx) error {
 			answered       bool
 			indexNum       int
 			orderList      []int64
+			numericJSON    []byte
+			numericAnswer  *string
+			gradedVersion  *int
 		)
 
 		err := rows.Scan(
 			&id, &question, &questionType, pq.Array(&options), &correctOptions, &explanation,
 			&selectedAns, &totalMark, &scoredMark, &answered, &indexNum, pq.Array(&orderList),
+			&numericJSON, &numericAnswer, &gradedVersion,
 		)
 		if err != nil {
 			fmt.Println(err.Error())
@@ -817,17 +1275,20 @@ func FinishTestSession(c *fiber.Ctx) error {
 		}
 
 		questions = append(questions, map[string]interface{}{
-			"id":                    id,
-			"question":              question,
-			"question_type":         questionType,
-			"options":               reorderedOptions,
-			"correct_options":       reorderedCorrectOptions,
-			"explanation":           explanation,
-			"selected_answer_list":  convertToIntSlice(selectedAns),
-			"questions_total_mark":  totalMark,
-			"questions_scored_mark": scoredMark,
-			"answered":              answered,
-			"is_correct":            scoredMark > 0,
+			"id":                     id,
+			"question":               question,
+			"question_type":          questionType,
+			"options":                reorderedOptions,
+			"correct_options":        reorderedCorrectOptions,
+			"explanation":            explanation,
+			"selected_answer_list":   convertToIntSlice(selectedAns),
+			"questions_total_mark":   totalMark,
+			"questions_scored_mark":  scoredMark,
+			"answered":               answered,
+			"is_correct":             scoredMark > 0,
+			"numeric_answer":         numericAnswer,
+			"correct_numeric_answer": json.RawMessage(numericJSON),
+			"question_version":       gradedVersion,
 		})
 	}
 
@@ -835,8 +1296,8 @@ func FinishTestSession(c *fiber.Ctx) error {
 	var allScores []float64
 	rows, err = tx.Query(
 		`SELECT scored_marks FROM test_sessions 
-         WHERE question_set_id = $1 AND finished = true 
-         ORDER BY scored_marks`, questionSetID)
+         WHERE finished = true AND ((question_set_id = $1 AND selection_mode = 'fixed') OR ($1 IS NULL AND id = $2))
+         ORDER BY scored_marks`, testResult.RankedSetID, testSessionID)
 	if err != nil {
 		fmt.Println(err.Error())
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -880,14 +1341,16 @@ func FinishTestSession(c *fiber.Ctx) error {
 		"test_session": fiber.Map{
 			"id":                   testSessionID,
 			"name":                 sessionName,
-			"mode":                 sessionMode,
+			"mode":                 timer.Mode,
 			"finished":             true,
-			"started_time":         startedTime,
+			"finish_reason":        reason,
+			"started_time":         timer.StartedTime,
 			"finished_time":        finishedTime,
+			"time_taken_seconds":   activeSeconds(timer.StartedTime, finishedTime, testResult.PausedSeconds),
 			"total_marks":          testResult.TotalMarks,
 			"scored_marks":         testResult.ScoredMarks,
 			"current_question_num": 0, // Reset to 0 for finished tests
-			"rank":                 stats.UserRank,
+			"rank":                 testResult.Rank,
 		},
 		"question_set": fiber.Map{
 			"id":          questionSetID,
@@ -921,8 +1384,12 @@ func GetTestHistory(c *fiber.Ctx) error {
 	// Base query
 	query := `
 	SELECT ts.id,ts.name,ts.finished, ts.started, ts.started_time, ts.finished_time,
-	       ts.mode,ts.total_marks, ts.scored_marks, qs.subject, qs.exam, qs.language, qs.cover_image,ts.updated_time
-	FROM test_sessions ts join question_sets qs on ts.question_set_id = qs.id 
+	       ts.mode,ts.total_marks,
+	       CASE WHEN ts.finished OR (ts.delivery = 'full' AND ts.selection_mode = 'fixed') THEN ts.scored_marks ELSE 0 END,
+	       COALESCE(qs.subject, ts.pool_spec->>'subject', ''), COALESCE(qs.exam, ts.pool_spec->>'exam', ''),
+	       COALESCE(qs.language, ts.pool_spec->>'language', ''), qs.cover_image,ts.updated_time,
+	       ts.finish_reason, ts.selection_mode, ts.source_type
+	FROM test_sessions ts left join question_sets qs on ts.question_set_id = qs.id 
 	WHERE ts.taken_by_id = $1
 	`
 	args := []interface{}{userID}
@@ -930,13 +1397,13 @@ func GetTestHistory(c *fiber.Ctx) error {
 
 	// Add filters dynamically
 	if subject != "" {
-		query += fmt.Sprintf(" AND qs.subject ILIKE $%d", argIdx)
+		query += fmt.Sprintf(" AND COALESCE(qs.subject, ts.pool_spec->>'subject') ILIKE $%d", argIdx)
 		args = append(args, "%"+subject+"%")
 		argIdx++
 	}
 
 	if exam != "" {
-		query += fmt.Sprintf(" AND qs.exam ILIKE $%d", argIdx)
+		query += fmt.Sprintf(" AND COALESCE(qs.exam, ts.pool_spec->>'exam') ILIKE $%d", argIdx)
 		args = append(args, "%"+exam+"%")
 		argIdx++
 	}
@@ -961,20 +1428,23 @@ func GetTestHistory(c *fiber.Ctx) error {
 
 	// Result structure
 	type TestHistory struct {
-		ID           uuid.UUID  `json:"id"`
-		Name         string     `json:"qSetName"`
-		Finished     bool       `json:"finished"`
-		Started      bool       `json:"started"`
-		StartedTime  time.Time  `json:"startedTime"`
-		FinishedTime *time.Time `json:"finishedTime"`
-		Mode         string     `json:"mode"`
-		TotalMarks   float64    `json:"totalMarks"`
-		ScoredMarks  float64    `json:"scoredMarks"`
-		Subject      string     `json:"subject"`
-		Exam         string     `json:"exam"`
-		Language     string     `json:"language"`
-		CoverImage   *string    `json:"coverImage"`
-		UpdatedTime  time.Time  `json:"updatedTime"`
+		ID            uuid.UUID  `json:"id"`
+		Name          string     `json:"qSetName"`
+		Finished      bool       `json:"finished"`
+		Started       bool       `json:"started"`
+		StartedTime   time.Time  `json:"startedTime"`
+		FinishedTime  *time.Time `json:"finishedTime"`
+		Mode          string     `json:"mode"`
+		TotalMarks    float64    `json:"totalMarks"`
+		ScoredMarks   float64    `json:"scoredMarks"`
+		Subject       string     `json:"subject"`
+		Exam          string     `json:"exam"`
+		Language      string     `json:"language"`
+		CoverImage    *string    `json:"coverImage"`
+		UpdatedTime   time.Time  `json:"updatedTime"`
+		FinishReason  *string    `json:"finishReason"`
+		SelectionMode string     `json:"selectionMode"`
+		SourceType    string     `json:"sourceType"`
 	}
 
 	history := []TestHistory{}
@@ -983,6 +1453,7 @@ func GetTestHistory(c *fiber.Ctx) error {
 		if err := rows.Scan(
 			&h.ID, &h.Name, &h.Finished, &h.Started, &h.StartedTime, &h.FinishedTime, &h.Mode,
 			&h.TotalMarks, &h.ScoredMarks, &h.Subject, &h.Exam, &h.Language, &h.CoverImage, &h.UpdatedTime,
+			&h.FinishReason, &h.SelectionMode, &h.SourceType,
 		); err != nil {
 			log.Println("Row scan error:", err)
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan test history"})
@@ -999,7 +1470,9 @@ func GetTestHistory(c *fiber.Ctx) error {
 	})
 }
 
-func GetTestStats(testSessionID string, questionSetID int) (map[string]interface{}, error) {
+// GetTestStats summarises a finished session against the fixed attempts at questionSetID.
+// With no set (pool and adaptive sessions) it's only compared against itself.
+func GetTestStats(testSessionID string, questionSetID *int) (map[string]interface{}, error) {
 	var sessionData struct {
 		ScoredMarks float64
 		TotalMarks  float64
@@ -1022,7 +1495,7 @@ func GetTestStats(testSessionID string, questionSetID int) (map[string]interface
 		`SELECT 
             COUNT(CASE WHEN answered THEN 1 END) as total_answered,
             COUNT(CASE WHEN questions_scored_mark > 0 THEN 1 END) as correct,
-            COUNT(CASE WHEN answered AND questions_scored_mark = 0 THEN 1 END) as wrong,
+            COUNT(CASE WHEN answered AND questions_scored_mark <= 0 THEN 1 END) as wrong,
             COUNT(CASE WHEN NOT answered THEN 1 END) as unanswered
          FROM test_session_question_answers
          WHERE test_session_id = $1`, testSessionID).Scan(
@@ -1043,7 +1516,7 @@ func GetTestStats(testSessionID string, questionSetID int) (map[string]interface
             COALESCE(AVG(scored_marks), 0) as avg_score,
             COALESCE(MAX(scored_marks), 0) as top_score
          FROM test_sessions 
-         WHERE question_set_id = $1 AND finished = true`, questionSetID).Scan(
+         WHERE finished = true AND ((question_set_id = $1 AND selection_mode = 'fixed') OR ($1 IS NULL AND id = $2))`, questionSetID, testSessionID).Scan(
 		&history.Attempts, &history.AvgScore, &history.TopScore)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch historical stats: %w", err)
@@ -1053,8 +1526,8 @@ func GetTestStats(testSessionID string, questionSetID int) (map[string]interface
 	var allScores []string
 	rows, err := util.DB.Query(
 		`SELECT scored_marks FROM test_sessions 
-         WHERE question_set_id = $1 AND finished = true 
-         ORDER BY scored_marks`, questionSetID)
+         WHERE finished = true AND ((question_set_id = $1 AND selection_mode = 'fixed') OR ($1 IS NULL AND id = $2))
+         ORDER BY scored_marks`, questionSetID, testSessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch all test scores: %w", err)
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/ShijuPJohn/synapticz_backend/controllers"
 	"github.com/ShijuPJohn/synapticz_backend/routers"
 	"github.com/ShijuPJohn/synapticz_backend/util"
 	"github.com/gofiber/fiber/v2"
@@ -24,6 +25,13 @@ func main() {
 		log.Fatal("Couldn't create tables", err)
 	}
 	log.Println("Tables Created")
+	controllers.StartSessionFinalizer()
+	controllers.StartItemAnalysisRefresher()
+	controllers.StartDifficultyCalibration()
+	if err = controllers.InitPayments(); err != nil {
+		log.Fatal("Couldn't set up payments: ", err)
+	}
+	controllers.StartPremiumExpiry()
 	app := fiber.New()
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "https://synapticz.com, http://localhost:3000", // or your frontend domain
@@ -6,6 +6,7 @@ import (
 	"github.com/ShijuPJohn/synapticz_backend/util"
 	"github.com/gofiber/fiber/v2"
 	"strconv"
+	"time"
 )
 
 func NotFound(c *fiber.Ctx) error {
@@ -46,15 +47,17 @@ func Protected() fiber.Handler {
 
 		// 4. Fetch user manually using SQL
 		var user models.User
-		query := `SELECT id, name, email, password, role, password_changed_at, verified, linkedin, facebook, instagram, profile_pic, about, deleted, created_at, updated_at
+		// Premium that has run out doesn't count, even before the expiry sweep clears the flag.
+		query := `SELECT id, name, email, password, role, password_changed_at, verified, linkedin, facebook, instagram, profile_pic, about, deleted, created_at, updated_at,
+		                 COALESCE(is_premium, false) AND (premium_expiry IS NULL OR premium_expiry > $2), timezone
 		          FROM users WHERE id = $1 AND deleted = false`
 
-		row := util.DB.QueryRow(query, userID)
+		row := util.DB.QueryRow(query, userID, time.Now().UTC())
 		err = row.Scan(
 			&user.ID, &user.Name, &user.Email, &user.Password, &user.Role,
 			&user.PasswordChangedAt, &user.Verified, &user.LinkedIn, &user.Facebook,
 			&user.Instagram, &user.ProfilePic, &user.About, &user.Deleted,
-			&user.CreatedAt, &user.UpdatedAt,
+			&user.CreatedAt, &user.UpdatedAt, &user.IsPremium, &user.Timezone,
 		)
 		if err != nil {
 			if err == sql.ErrNoRows {
@@ -86,6 +89,18 @@ func Protected() fiber.Handler {
 	}
 }
 
+// OptionalAuth identifies the caller like Protected when a token is sent, and lets requests
+// without one through anonymously.
+func OptionalAuth() fiber.Handler {
+	protected := Protected()
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			return c.Next()
+		}
+		return protected(c)
+	}
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	if err.Error() == "Missing or malformed JWT" {
 		c.Status(fiber.StatusBadRequest)
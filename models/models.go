@@ -23,23 +23,44 @@ type User struct {
 	CountryCode       *string   `json:"country_code"`
 	MobileNumber      *string   `json:"mobile_number"`
 	Goal              *string   `json:"goal"`
+	ProfileVisibility string    `json:"profile_visibility"` // public or private
+	AllowMentorView   bool      `json:"allow_mentor_view"`
+	AutoShoutouts     bool      `json:"auto_shoutouts"` // post a shoutout on finishing tests and streak milestones
+	Timezone          string    `json:"timezone"`       // IANA name; the user's days, and so their daily quota, follow it
 }
 
 type Question struct {
-	ID             int       `json:"id" db:"id"`
-	Question       string    `json:"question" db:"question"`
-	Subject        string    `json:"subject" db:"subject"`
-	Exam           *string   `json:"exam,omitempty" db:"exam"`
-	Language       string    `json:"language" db:"language"`
-	Tags           []string  `json:"tags" db:"tags"`
-	Difficulty     int       `json:"difficulty" db:"difficulty"`
-	QuestionType   string    `json:"question_type" db:"question_type"`
-	Options        []string  `json:"options" db:"options"`
-	CorrectOptions []int     `json:"correct_options" db:"correct_options"`
-	Explanation    *string   `json:"explanation,omitempty" db:"explanation"`
-	CreatedByID    int       `json:"created_by_id" db:"created_by_id"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	ID             int            `json:"id" db:"id"`
+	Question       string         `json:"question" db:"question"`
+	Subject        string         `json:"subject" db:"subject"`
+	Exam           *string        `json:"exam,omitempty" db:"exam"`
+	Language       string         `json:"language" db:"language"`
+	Tags           []string       `json:"tags" db:"tags"`
+	Difficulty     int            `json:"difficulty" db:"difficulty"`
+	QuestionType   string         `json:"question_type" db:"question_type"`
+	Options        []string       `json:"options" db:"options"`
+	CorrectOptions []int          `json:"correct_options" db:"correct_options"`
+	NumericAnswer  *NumericAnswer `json:"numeric_answer,omitempty" db:"numeric_answer"`
+	Explanation    *string        `json:"explanation,omitempty" db:"explanation"`
+	CreatedByID    int            `json:"created_by_id" db:"created_by_id"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// NumericAnswer is the answer key of a numeric question, stored as JSON in questions.numeric_answer.
+type NumericAnswer struct {
+	Value         float64       `json:"value"`
+	Tolerance     float64       `json:"tolerance"`
+	ToleranceType string        `json:"tolerance_type"` // absolute or relative
+	SigFigs       *int          `json:"sig_figs,omitempty"`
+	Units         []NumericUnit `json:"units,omitempty"`
+	UnitRequired  bool          `json:"unit_required"`
+}
+
+// NumericUnit is an accepted unit and the factor that converts it to the unit of Value.
+type NumericUnit struct {
+	Unit   string  `json:"unit"`
+	Factor float64 `json:"factor"`
 }
 
 type UserQuestionEditor struct {
@@ -73,27 +94,6 @@ type QuestionSetQuestion struct {
 	QuestionID    int `json:"question_id" db:"question_id"`
 }
 
-type QTest struct {
-	ID                 string    `json:"id" db:"id"` // UUID
-	Finished           bool      `json:"finished" db:"finished"`
-	Started            bool      `json:"started" db:"started"`
-	Name               string    `json:"name" db:"name"`
-	Tags               []string  `json:"tags" db:"tags"`
-	QuestionSetID      int       `json:"question_set_id" db:"question_set_id"`
-	TakenByID          int       `json:"taken_by_id" db:"taken_by_id"`
-	NTotalQuestions    int       `json:"n_total_questions" db:"n_total_questions"`
-	CurrentQuestionNum int       `json:"current_question_num" db:"current_question_num"`
-	NCorrectlyAnswered int       `json:"n_correctly_answered" db:"n_correctly_answered"`
-	Rank               *int      `json:"rank,omitempty" db:"rank"`
-	TakenAtTime        time.Time `json:"taken_at_time" db:"taken_at_time"`
-	Mode               string    `json:"mode" db:"mode"`
-}
-
-type QTestQuestion struct {
-	QTestID    string `json:"qtest_id" db:"qtest_id"`
-	QuestionID int    `json:"question_id" db:"question_id"`
-}
-
 type QuestionTag struct {
 	ID   int    `json:"id" db:"id"`
 	Name string `json:"name" db:"name"`
@@ -126,7 +126,7 @@ type TestSession struct {
 	Started            bool      `json:"started" db:"started"`
 	Name               string    `json:"name" db:"name"`
 	TakenByID          int       `json:"taken_by_id" db:"taken_by_id"`
-	QuestionSetID      int       `json:"question_set_id" db:"question_set_id"`
+	QuestionSetID      *int      `json:"question_set_id" db:"question_set_id"` // nil for sessions drawn from a subject/tag pool
 	NTotalQuestions    int       `json:"n_total_questions" db:"n_total_questions"`
 	CurrentQuestionNum int       `json:"current_question_num" db:"current_question_num"`
 	NCorrectlyAnswered int       `json:"n_correctly_answered" db:"n_correctly_answered"`
@@ -140,4 +140,15 @@ type TestSession struct {
 	SecondsPerQuestion int       `json:"seconds_per_question"`
 	TimeCapSeconds     int       `json:"time_cap_seconds"`
 	RemainingTime      *int      `json:"remaining_time"`
+	// Marking scheme copied from the question set when the session started
+	MarkingScheme          string  `json:"marking_scheme" db:"marking_scheme"`
+	NegativeMarkRatio      float64 `json:"negative_mark_ratio" db:"negative_mark_ratio"`
+	UnansweredPenaltyRatio float64 `json:"unanswered_penalty_ratio" db:"unanswered_penalty_ratio"`
+	FinishReason           *string `json:"finish_reason" db:"finish_reason"` // submitted, time_up, abandoned, or an adaptive stop reason
+	// Adaptive sessions pick each next question from the learner's running ability estimate
+	SelectionMode   string   `json:"selection_mode" db:"selection_mode"` // fixed or adaptive
+	AbilityEstimate *float64 `json:"ability_estimate" db:"ability_estimate"`
+	AbilitySE       *float64 `json:"ability_se" db:"ability_se"`
+	SourceType      string   `json:"source_type" db:"source_type"` // question_set, filters, review or mistakes
+	Delivery        string   `json:"delivery" db:"delivery"`       // full, or stepwise for one question at a time
 }
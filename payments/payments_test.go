@@ -0,0 +1,65 @@
+package payments
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMockWebhook(t *testing.T) {
+	m := NewMock("secret")
+	body, _ := json.Marshal(MockWebhook{Type: "payment.succeeded", OrderID: "order_1", PaymentID: "pay_1", Amount: 49900, Currency: "INR"})
+
+	event, err := m.VerifyWebhook(body, m.Sign(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Status != "success" || event.OrderID != "order_1" || event.Amount != 49900 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if _, err := m.VerifyWebhook(body, NewMock("other").Sign(body)); err != ErrInvalidSignature {
+		t.Fatalf("a body signed with another secret should be rejected, got %v", err)
+	}
+}
+
+func TestRazorpayWebhook(t *testing.T) {
+	r := NewRazorpay("rzp_key", "rzp_secret", "hook_secret")
+	body := []byte(`{"event":"payment.failed","payload":{"payment":{"entity":{"id":"pay_9","order_id":"order_9","amount":100,"currency":"INR"}}}}`)
+
+	event, err := r.VerifyWebhook(body, signHMAC("hook_secret", body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Status != "failed" || event.PaymentID != "pay_9" || event.OrderID != "order_9" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if _, err := r.VerifyWebhook(body, "deadbeef"); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestRazorpayCreateOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "rzp_key" || pass != "rzp_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var in map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&in)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "order_abc", "amount": in["amount"], "currency": in["currency"], "receipt": in["receipt"],
+		})
+	}))
+	defer server.Close()
+
+	r := NewRazorpay("rzp_key", "rzp_secret", "hook_secret")
+	r.ordersURL = server.URL
+	order, err := r.CreateOrder(49900, "INR", "payment_7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.ID != "order_abc" || order.Amount != 49900 || order.ClientKey != "rzp_key" {
+		t.Fatalf("unexpected order %+v", order)
+	}
+}
@@ -0,0 +1,77 @@
+// Package payments talks to payment providers. Checkout creates an order with the provider;
+// the provider later reports the outcome through a signed webhook, which VerifyWebhook turns
+// into an Event.
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Order is a payment the provider has been asked to collect. Amounts are in minor units
+// (paise, cents).
+type Order struct {
+	ID        string `json:"order_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Receipt   string `json:"receipt"`
+	ClientKey string `json:"client_key,omitempty"` // public key the client's checkout widget needs
+}
+
+// Event is a verified webhook notification about an order.
+type Event struct {
+	Type      string // the provider's event name
+	OrderID   string
+	PaymentID string
+	Amount    int64
+	Currency  string
+	Status    string // success, failed, or "" for events that don't settle a payment
+}
+
+type Provider interface {
+	Name() string
+	CreateOrder(amount int64, currency, receipt string) (Order, error)
+	// SignatureHeader is the request header the provider signs its webhooks in.
+	SignatureHeader() string
+	VerifyWebhook(body []byte, signature string) (Event, error)
+}
+
+// FromEnv builds the provider named by PAYMENT_PROVIDER. It returns nil when payments are
+// not configured.
+func FromEnv() (Provider, error) {
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "":
+		return nil, nil
+	case "mock":
+		secret := os.Getenv("MOCK_PAYMENT_SECRET")
+		if secret == "" {
+			return nil, errors.New("MOCK_PAYMENT_SECRET is required for the mock payment provider")
+		}
+		return NewMock(secret), nil
+	case "razorpay":
+		keyID, keySecret, webhookSecret := os.Getenv("RAZORPAY_KEY_ID"), os.Getenv("RAZORPAY_KEY_SECRET"), os.Getenv("RAZORPAY_WEBHOOK_SECRET")
+		if keyID == "" || keySecret == "" || webhookSecret == "" {
+			return nil, errors.New("RAZORPAY_KEY_ID, RAZORPAY_KEY_SECRET and RAZORPAY_WEBHOOK_SECRET are required")
+		}
+		return NewRazorpay(keyID, keySecret, webhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
+
+// signHMAC is the hex HMAC-SHA256 of body, the signature scheme both providers use.
+func signHMAC(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validHMAC(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signHMAC(secret, body)), []byte(signature))
+}
@@ -0,0 +1,110 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const razorpayOrdersURL = "https://api.razorpay.com/v1/orders"
+
+// Razorpay creates orders through the Orders API and reads payment.captured and
+// payment.failed webhooks, which are signed with the webhook secret.
+type Razorpay struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	ordersURL     string
+	client        *http.Client
+}
+
+func NewRazorpay(keyID, keySecret, webhookSecret string) *Razorpay {
+	return &Razorpay{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		ordersURL:     razorpayOrdersURL,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *Razorpay) Name() string { return "razorpay" }
+
+func (r *Razorpay) SignatureHeader() string { return "X-Razorpay-Signature" }
+
+func (r *Razorpay) CreateOrder(amount int64, currency, receipt string) (Order, error) {
+	body, err := json.Marshal(map[string]interface{}{"amount": amount, "currency": currency, "receipt": receipt})
+	if err != nil {
+		return Order{}, err
+	}
+	req, err := http.NewRequest("POST", r.ordersURL, bytes.NewBuffer(body))
+	if err != nil {
+		return Order{}, err
+	}
+	req.SetBasicAuth(r.keyID, r.keySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return Order{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Order{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Order{}, fmt.Errorf("razorpay: creating order failed with status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var order struct {
+		ID       string `json:"id"`
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+		Receipt  string `json:"receipt"`
+	}
+	if err := json.Unmarshal(respBody, &order); err != nil {
+		return Order{}, err
+	}
+	return Order{ID: order.ID, Amount: order.Amount, Currency: order.Currency, Receipt: order.Receipt, ClientKey: r.keyID}, nil
+}
+
+func (r *Razorpay) VerifyWebhook(body []byte, signature string) (Event, error) {
+	if !validHMAC(r.webhookSecret, body, signature) {
+		return Event{}, ErrInvalidSignature
+	}
+	var hook struct {
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity struct {
+					ID       string `json:"id"`
+					OrderID  string `json:"order_id"`
+					Amount   int64  `json:"amount"`
+					Currency string `json:"currency"`
+				} `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return Event{}, err
+	}
+	payment := hook.Payload.Payment.Entity
+	event := Event{
+		Type:      hook.Event,
+		OrderID:   payment.OrderID,
+		PaymentID: payment.ID,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+	}
+	switch hook.Event {
+	case "payment.captured":
+		event.Status = "success"
+	case "payment.failed":
+		event.Status = "failed"
+	}
+	return event, nil
+}
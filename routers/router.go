@@ -23,6 +23,7 @@ func SetupRoutes(app *fiber.App) {
 	auth.Post("/users/verify", controllers.VerifyUserEmail)
 	auth.Post("/users/resend-verification", controllers.ResendVerificationCode)
 	auth.Get("/users/overview", middlewares.Protected(), controllers.GetUserActivityOverview)
+	auth.Get("/users/quota", middlewares.Protected(), controllers.GetDailyQuota)
 	auth.Post("/login", controllers.LoginUser)
 	auth.Post("/password-reset", controllers.SendPasswordResetCode)
 	auth.Post("/reset-code", controllers.VerifyPasswordResetCode)
@@ -32,22 +33,57 @@ func SetupRoutes(app *fiber.App) {
 	questions.Post("/", middlewares.Protected(), controllers.CreateQuestion)
 	questions.Get("/", middlewares.Protected(), controllers.GetQuestions)
 	questions.Get("/:id", middlewares.Protected(), controllers.GetQuestionByID)
+	questions.Get("/:id/analytics", middlewares.Protected(), controllers.GetQuestionAnalytics)
 	questions.Delete("/", middlewares.Protected(), controllers.DeleteQuestions)
 	questions.Put("/:id", middlewares.Protected(), controllers.EditQuestion)
+	questions.Get("/:id/collaborators", middlewares.Protected(), controllers.GetQuestionCollaborators)
+	questions.Post("/:id/collaborators", middlewares.Protected(), controllers.InviteQuestionCollaborator)
+	questions.Post("/:id/collaborators/accept", middlewares.Protected(), controllers.AcceptQuestionCollaboration)
+	questions.Put("/:id/collaborators/:user_id", middlewares.Protected(), controllers.UpdateQuestionCollaborator)
+	questions.Delete("/:id/collaborators/:user_id", middlewares.Protected(), controllers.RemoveQuestionCollaborator)
+	questions.Get("/:id/revisions", middlewares.Protected(), controllers.GetQuestionRevisions)
+	questions.Get("/:id/revisions/diff", middlewares.Protected(), controllers.DiffQuestionRevisions)
+	questions.Get("/:id/revisions/:version", middlewares.Protected(), controllers.GetQuestionRevision)
+	questions.Post("/:id/revisions/:version/restore", middlewares.Protected(), controllers.RestoreQuestionRevision)
 
 	questionSet := api.Group("/questionsets")
 	questionSet.Post("/", middlewares.Protected(), controllers.CreateQuestionSet)
-	questionSet.Get("/", controllers.GetQuestionSets)
-	questionSet.Get("/unverified", controllers.GetUnverifiedQuestionSets)
-	questionSet.Get("/verified", controllers.GetVerifiedQuestionSets)
-	questionSet.Get("/:id", controllers.GetQuestionSetByID)
+	questionSet.Get("/", middlewares.OptionalAuth(), controllers.GetQuestionSets)
+	questionSet.Get("/unverified", middlewares.OptionalAuth(), controllers.GetUnverifiedQuestionSets)
+	questionSet.Get("/verified", middlewares.OptionalAuth(), controllers.GetVerifiedQuestionSets)
+	questionSet.Get("/:id", middlewares.OptionalAuth(), controllers.GetQuestionSetByID)
+	questionSet.Get("/:id/analytics", middlewares.Protected(), controllers.GetQuestionSetAnalytics)
+	questionSet.Get("/:id/reviews", controllers.GetQuestionSetReviews)
+	questionSet.Post("/:id/reviews", middlewares.Protected(), controllers.CreateQuestionSetReview)
+	questionSet.Put("/:id/reviews", middlewares.Protected(), controllers.UpdateQuestionSetReview)
+	questionSet.Delete("/:id/reviews", middlewares.Protected(), controllers.DeleteQuestionSetReview)
 	questionSet.Delete("/:id", middlewares.Protected(), controllers.SoftDeleteQuestionSet)
 	questionSet.Put("/:id", middlewares.Protected(), controllers.UpdateQuestionSet)
+	questionSet.Get("/:id/collaborators", middlewares.Protected(), controllers.GetQuestionSetCollaborators)
+	questionSet.Post("/:id/collaborators", middlewares.Protected(), controllers.InviteQuestionSetCollaborator)
+	questionSet.Post("/:id/collaborators/accept", middlewares.Protected(), controllers.AcceptQuestionSetCollaboration)
+	questionSet.Put("/:id/collaborators/:user_id", middlewares.Protected(), controllers.UpdateQuestionSetCollaborator)
+	questionSet.Delete("/:id/collaborators/:user_id", middlewares.Protected(), controllers.RemoveQuestionSetCollaborator)
+	questionSet.Get("/:id/revisions", middlewares.Protected(), controllers.GetQuestionSetRevisions)
+	questionSet.Get("/:id/revisions/diff", middlewares.Protected(), controllers.DiffQuestionSetRevisions)
+	questionSet.Get("/:id/revisions/:version", middlewares.Protected(), controllers.GetQuestionSetRevision)
+	questionSet.Post("/:id/revisions/:version/restore", middlewares.Protected(), controllers.RestoreQuestionSetRevision)
+
+	collaborations := api.Group("/collaborations")
+	collaborations.Get("/", middlewares.Protected(), controllers.GetMyCollaborations)
 
 	testSession := api.Group("/test_session")
 	testSession.Post("/", middlewares.Protected(), controllers.CreateTestSession)
 	testSession.Put("/finish/:test_session_id", middlewares.Protected(), controllers.FinishTestSession)
 	testSession.Get("/history", middlewares.Protected(), controllers.GetTestHistory)
+	testSession.Put("/pause/:test_session_id", middlewares.Protected(), controllers.PauseTestSession)
+	testSession.Put("/resume/:test_session_id", middlewares.Protected(), controllers.ResumeTestSession)
+	testSession.Put("/next/:test_session_id", middlewares.Protected(), controllers.NextAdaptiveQuestion)
+	testSession.Get("/:test_session_id/regrades", middlewares.Protected(), controllers.GetTestSessionRegrades)
+	testSession.Get("/:test_session_id/question", middlewares.Protected(), controllers.GetCurrentSessionQuestion)
+	testSession.Put("/:test_session_id/question/next", middlewares.Protected(), controllers.NextSessionQuestion)
+	testSession.Put("/:test_session_id/question/prev", middlewares.Protected(), controllers.PrevSessionQuestion)
+	testSession.Put("/:test_session_id/question/answer", middlewares.Protected(), controllers.AnswerSessionQuestion)
 	testSession.Put("/:test_session_id", middlewares.Protected(), controllers.UpdateTestSession)
 	testSession.Get("/:test_session_id", middlewares.Protected(), controllers.GetTestSession)
 
@@ -56,6 +92,68 @@ func SetupRoutes(app *fiber.App) {
 	bookmarks.Get("/", middlewares.Protected(), controllers.GetAllBookmarks)
 	bookmarks.Delete("/:qid", middlewares.Protected(), controllers.RemoveBookmark)
 
+	review := api.Group("/review")
+	review.Get("/due", middlewares.Protected(), controllers.GetDueReviews)
+	review.Post("/session", middlewares.Protected(), controllers.StartReviewSession)
+
+	mistakes := api.Group("/mistakes")
+	mistakes.Get("/", middlewares.Protected(), controllers.GetMistakes)
+	mistakes.Post("/session", middlewares.Protected(), controllers.StartMistakeSession)
+	mistakes.Delete("/:qid", middlewares.Protected(), controllers.RemoveMistake)
+
+	decks := api.Group("/decks")
+	decks.Post("/", middlewares.Protected(), controllers.CreateDeck)
+	decks.Get("/", middlewares.Protected(), controllers.GetDecks)
+	decks.Get("/:id", middlewares.Protected(), controllers.GetDeck)
+	decks.Delete("/:id", middlewares.Protected(), controllers.DeleteDeck)
+	decks.Post("/:id/cards", middlewares.Protected(), controllers.AddDeckCards)
+	decks.Delete("/:id/cards/:qid", middlewares.Protected(), controllers.RemoveDeckCard)
+	decks.Put("/:id/sync", middlewares.Protected(), controllers.SyncDeck)
+	decks.Get("/:id/due", middlewares.Protected(), controllers.GetDueDeckCards)
+	decks.Post("/:id/review", middlewares.Protected(), controllers.ReviewDeckCard)
+	decks.Get("/:id/export", middlewares.Protected(), controllers.ExportDeck)
+
+	reports := api.Group("/reports")
+	reports.Post("/", middlewares.Protected(), controllers.CreateQuestionReport)
+	reports.Get("/", middlewares.Protected(), controllers.GetQuestionReports)
+	reports.Get("/mine", middlewares.Protected(), controllers.GetMyQuestionReports)
+	reports.Put("/:id", middlewares.Protected(), controllers.UpdateQuestionReport)
+
+	connections := api.Group("/connections")
+	connections.Post("/", middlewares.Protected(), controllers.CreateConnectionRequest)
+	connections.Get("/", middlewares.Protected(), controllers.GetConnections)
+	connections.Get("/requests", middlewares.Protected(), controllers.GetConnectionRequests)
+	connections.Put("/:id/accept", middlewares.Protected(), controllers.AcceptConnectionRequest)
+	connections.Put("/:id/reject", middlewares.Protected(), controllers.RejectConnectionRequest)
+	connections.Delete("/:id", middlewares.Protected(), controllers.RemoveConnection)
+
+	mentor := api.Group("/mentor")
+	mentor.Post("/share", middlewares.Protected(), controllers.ShareWithMentor)
+	mentor.Delete("/share", middlewares.Protected(), controllers.UnshareWithMentor)
+	mentor.Get("/mentees", middlewares.Protected(), controllers.GetMentees)
+	mentor.Get("/mentees/:mentee_id", middlewares.Protected(), controllers.GetMenteeActivity)
+
+	shoutouts := api.Group("/shoutouts")
+	shoutouts.Post("/", middlewares.Protected(), controllers.CreateShoutout)
+	shoutouts.Get("/", middlewares.Protected(), controllers.GetShoutouts)
+	shoutouts.Get("/feed", middlewares.Protected(), controllers.GetShoutoutFeed)
+	shoutouts.Delete("/:id", middlewares.Protected(), controllers.DeleteShoutout)
+
+	notifications := api.Group("/notifications")
+	notifications.Get("/", middlewares.Protected(), controllers.GetNotifications)
+	notifications.Put("/:id/read", middlewares.Protected(), controllers.MarkNotificationRead)
+
+	plans := api.Group("/plans")
+	plans.Get("/", controllers.GetPlans)
+	plans.Post("/", middlewares.Protected(), controllers.CreatePlan)
+	plans.Put("/:id", middlewares.Protected(), controllers.UpdatePlan)
+	plans.Delete("/:id", middlewares.Protected(), controllers.DeletePlan)
+
+	paymentRoutes := api.Group("/payments")
+	paymentRoutes.Post("/checkout", middlewares.Protected(), controllers.CreateCheckout)
+	paymentRoutes.Get("/", middlewares.Protected(), controllers.GetMyPayments)
+	paymentRoutes.Post("/webhook/:provider", controllers.PaymentWebhook)
+
 	explanation := api.Group("/explanations")
 	explanation.Post("/", middlewares.Protected(), controllers.SaveExplanation)
 	explanation.Get("/", middlewares.Protected(), controllers.GetAllSavedExplanations)
@@ -68,5 +166,12 @@ func SetupRoutes(app *fiber.App) {
 	admin := api.Group("/admin")
 	admin.Get("/users", middlewares.Protected(), controllers.GetAllUsers)
 	admin.Get("/users/:uid", middlewares.Protected(), controllers.GetUserDetailsAdmin)
+	admin.Put("/users/:uid/quota", middlewares.Protected(), controllers.GrantDailyQuota)
+	admin.Delete("/users/:uid/quota", middlewares.Protected(), controllers.RevokeDailyQuota)
+	admin.Post("/calibrate-difficulty", middlewares.Protected(), controllers.CalibrateQuestionDifficulty)
+	admin.Post("/regrade", middlewares.Protected(), controllers.RegradeQuestions)
+	admin.Get("/reviews", middlewares.Protected(), controllers.GetReviewsForModeration)
+	admin.Put("/reviews/:review_id", middlewares.Protected(), controllers.ModerateQuestionSetReview)
+	admin.Delete("/reviews/:review_id", middlewares.Protected(), controllers.ModerateQuestionSetReview)
 
 }
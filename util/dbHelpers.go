@@ -276,7 +276,243 @@ CREATE TABLE IF NOT EXISTS question_set_reviews (
 		shared_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		PRIMARY KEY (mentor_id, mentee_id, test_session_id)
 	);
-	`)
+	`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_answer JSONB`,
+		`ALTER TABLE test_session_question_answers ADD COLUMN IF NOT EXISTS numeric_answer TEXT`,
+		`ALTER TABLE question_sets ADD COLUMN IF NOT EXISTS marking_scheme VARCHAR(20) NOT NULL DEFAULT 'proportional' CHECK (marking_scheme IN ('all-or-nothing', 'proportional', 'per-option'))`,
+		`ALTER TABLE question_sets ADD COLUMN IF NOT EXISTS negative_mark_ratio FLOAT NOT NULL DEFAULT 0`,
+		`ALTER TABLE question_sets ADD COLUMN IF NOT EXISTS unanswered_penalty_ratio FLOAT NOT NULL DEFAULT 0`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS marking_scheme VARCHAR(20) NOT NULL DEFAULT 'proportional'`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS negative_mark_ratio FLOAT NOT NULL DEFAULT 0`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS unanswered_penalty_ratio FLOAT NOT NULL DEFAULT 0`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS current_question_started_at TIMESTAMP`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS paused_at TIMESTAMP`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS paused_seconds INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS finish_reason VARCHAR(30)`,
+		`CREATE INDEX IF NOT EXISTS idx_test_sessions_unfinished ON test_sessions (updated_time) WHERE NOT finished`,
+		`CREATE TABLE IF NOT EXISTS test_session_events (
+    id BIGSERIAL PRIMARY KEY,
+    test_session_id UUID NOT NULL REFERENCES test_sessions(id) ON DELETE CASCADE,
+    question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('visit', 'answer')),
+    duration_seconds INT,
+    selected_answer_list INT[],
+    numeric_answer TEXT,
+    client_time TIMESTAMPTZ,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_test_session_events_session ON test_session_events (test_session_id, question_id)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS calibrated_difficulty FLOAT`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS calibrated_logit FLOAT`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS calibration_attempts INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS calibrated_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS question_set_item_analysis (
+    question_set_id INT PRIMARY KEY REFERENCES question_sets(id) ON DELETE CASCADE,
+    finished_sessions INT NOT NULL,
+    computed_at TIMESTAMP NOT NULL,
+    analysis JSONB NOT NULL
+)`,
+		`ALTER TABLE test_sessions ALTER COLUMN question_set_id DROP NOT NULL`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS selection_mode VARCHAR(20) NOT NULL DEFAULT 'fixed' CHECK (selection_mode IN ('fixed', 'adaptive'))`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS pool_spec JSONB`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS max_questions INT`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS target_se FLOAT`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS ability_estimate FLOAT`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS ability_se FLOAT`,
+		`CREATE TABLE IF NOT EXISTS review_states (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    ease_factor FLOAT NOT NULL DEFAULT 2.5,
+    interval_days INT NOT NULL DEFAULT 0,
+    repetitions INT NOT NULL DEFAULT 0,
+    lapses INT NOT NULL DEFAULT 0,
+    last_quality INT,
+    last_reviewed_at TIMESTAMP,
+    due_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, question_id)
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_review_states_due ON review_states (user_id, due_at)`,
+		`CREATE TABLE IF NOT EXISTS flashcard_decks (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    source_type VARCHAR(30) NOT NULL DEFAULT 'manual' CHECK (source_type IN ('manual', 'question_set', 'bookmarks', 'saved_explanations')),
+    question_set_id INT REFERENCES question_sets(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`,
+		`CREATE TABLE IF NOT EXISTS flashcard_cards (
+    deck_id INT NOT NULL REFERENCES flashcard_decks(id) ON DELETE CASCADE,
+    question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    ease_factor FLOAT NOT NULL DEFAULT 2.5,
+    interval_days INT NOT NULL DEFAULT 0,
+    repetitions INT NOT NULL DEFAULT 0,
+    lapses INT NOT NULL DEFAULT 0,
+    last_rating VARCHAR(10) CHECK (last_rating IN ('again', 'hard', 'good', 'easy')),
+    last_reviewed_at TIMESTAMP,
+    due_at TIMESTAMP NOT NULL,
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (deck_id, question_id)
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_flashcard_decks_user ON flashcard_decks (user_id)`,
+		`CREATE TABLE IF NOT EXISTS user_mistakes (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    first_session_id UUID REFERENCES test_sessions(id) ON DELETE SET NULL,
+    last_session_id UUID REFERENCES test_sessions(id) ON DELETE SET NULL,
+    question_set_id INT REFERENCES question_sets(id) ON DELETE SET NULL,
+    times_wrong INT NOT NULL DEFAULT 0,
+    times_skipped INT NOT NULL DEFAULT 0,
+    correct_streak INT NOT NULL DEFAULT 0,
+    added_at TIMESTAMP NOT NULL,
+    last_missed_at TIMESTAMP NOT NULL,
+    graduated_at TIMESTAMP,
+    PRIMARY KEY (user_id, question_id)
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_mistakes_open ON user_mistakes (user_id, last_missed_at) WHERE graduated_at IS NULL`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS source_type VARCHAR(20) NOT NULL DEFAULT 'question_set' CHECK (source_type IN ('question_set', 'filters', 'review', 'mistakes'))`,
+		`ALTER TABLE question_error_reports ADD COLUMN IF NOT EXISTS test_session_id UUID REFERENCES test_sessions(id) ON DELETE SET NULL`,
+		`ALTER TABLE question_error_reports ADD COLUMN IF NOT EXISTS resolution_note TEXT`,
+		`ALTER TABLE question_error_reports ADD COLUMN IF NOT EXISTS reviewed_by_id INT REFERENCES users(id) ON DELETE SET NULL`,
+		`ALTER TABLE question_error_reports ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP`,
+		`ALTER TABLE question_error_reports ADD COLUMN IF NOT EXISTS key_changed BOOLEAN NOT NULL DEFAULT false`,
+		`CREATE INDEX IF NOT EXISTS idx_question_error_reports_question ON question_error_reports (question_id, status)`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    message TEXT NOT NULL,
+    data JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, created_at DESC)`,
+		`CREATE TABLE IF NOT EXISTS regrade_runs (
+    id SERIAL PRIMARY KEY,
+    question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('admin', 'key_correction', 'report')),
+    triggered_by_id INT REFERENCES users(id) ON DELETE SET NULL,
+    answers_regraded INT NOT NULL DEFAULT 0,
+    sessions_changed INT NOT NULL DEFAULT 0,
+    ranks_changed INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+)`,
+		`CREATE TABLE IF NOT EXISTS test_session_regrades (
+    regrade_id INT NOT NULL REFERENCES regrade_runs(id) ON DELETE CASCADE,
+    test_session_id UUID NOT NULL REFERENCES test_sessions(id) ON DELETE CASCADE,
+    question_id INT NOT NULL,
+    old_question_mark FLOAT,
+    new_question_mark FLOAT,
+    old_scored_marks FLOAT NOT NULL,
+    new_scored_marks FLOAT NOT NULL,
+    old_rank INT,
+    new_rank INT,
+    PRIMARY KEY (regrade_id, test_session_id)
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_test_session_regrades_session ON test_session_regrades (test_session_id)`,
+		`ALTER TABLE question_set_reviews ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP`,
+		`ALTER TABLE question_set_reviews ADD COLUMN IF NOT EXISTS hidden BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE question_set_reviews ADD COLUMN IF NOT EXISTS moderation_reason TEXT`,
+		`ALTER TABLE question_set_reviews ADD COLUMN IF NOT EXISTS moderated_by_id INT REFERENCES users(id) ON DELETE SET NULL`,
+		`ALTER TABLE question_set_reviews ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_question_set_reviews_user ON question_set_reviews (question_set_id, user_id)`,
+		`ALTER TABLE user_connections ADD COLUMN IF NOT EXISTS mentor_id INT REFERENCES users(id) ON DELETE CASCADE`,
+		`CREATE INDEX IF NOT EXISTS idx_user_connections_target ON user_connections (target_id, status)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS auto_shoutouts BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE shoutouts ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'post'`, // post, test_finished, streak_milestone
+		`ALTER TABLE shoutouts ADD COLUMN IF NOT EXISTS test_session_id UUID REFERENCES test_sessions(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_shoutouts_created ON shoutouts (created_at DESC, id DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_shoutouts_user ON shoutouts (user_id, created_at DESC)`,
+		`ALTER TABLE test_sessions ADD COLUMN IF NOT EXISTS delivery VARCHAR(20) NOT NULL DEFAULT 'full' CHECK (delivery IN ('full', 'stepwise'))`,
+		`ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS description TEXT`,
+		`ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS currency VARCHAR(10) NOT NULL DEFAULT 'INR'`,
+		`ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true`,
+		`ALTER TABLE subscription_plans ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT now()`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS plan_id INT REFERENCES subscription_plans(id) ON DELETE SET NULL`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS order_id TEXT`, // the provider's order; transaction_id is its payment
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS failure_reason TEXT`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT now()`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT now()`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_provider_order ON payments (payment_provider, order_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_payments_user ON payments (user_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_premium_expiry ON users (premium_expiry) WHERE is_premium`,
+		`ALTER TABLE question_sets ADD COLUMN IF NOT EXISTS price NUMERIC(10,2)`, // only charged for paid sets
+		`ALTER TABLE question_sets ADD COLUMN IF NOT EXISTS currency VARCHAR(10) NOT NULL DEFAULT 'INR'`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS question_set_id INT REFERENCES question_sets(id) ON DELETE SET NULL`,
+		`CREATE TABLE IF NOT EXISTS question_set_purchases (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    question_set_id INT NOT NULL REFERENCES question_sets(id) ON DELETE CASCADE,
+    payment_id INT REFERENCES payments(id) ON DELETE SET NULL,
+    purchased_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, question_set_id)
+)`,
+		// Widen the source_type check for preview sessions once, not on every start.
+		`DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'test_sessions'::regclass AND conname = 'test_sessions_source_type_check'
+          AND pg_get_constraintdef(oid) LIKE '%preview%'
+    ) THEN
+        ALTER TABLE test_sessions DROP CONSTRAINT IF EXISTS test_sessions_source_type_check;
+        ALTER TABLE test_sessions ADD CONSTRAINT test_sessions_source_type_check
+            CHECK (source_type IN ('question_set', 'filters', 'review', 'mistakes', 'preview'));
+    END IF;
+END $$`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC'`,
+		`ALTER TABLE user_daily_activity ALTER COLUMN questions_limit DROP DEFAULT`, // a limit on a day is an admin grant
+		`ALTER TABLE user_questionsets_editors ADD COLUMN IF NOT EXISTS role VARCHAR(10) NOT NULL DEFAULT 'editor' CHECK (role IN ('editor', 'viewer'))`,
+		`ALTER TABLE user_questionsets_editors ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'accepted' CHECK (status IN ('pending', 'accepted'))`,
+		`ALTER TABLE user_questionsets_editors ADD COLUMN IF NOT EXISTS invited_by_id INT REFERENCES users(id) ON DELETE SET NULL`,
+		`ALTER TABLE user_questionsets_editors ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now()`,
+		`ALTER TABLE user_questionsets_editors ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMP`,
+		`ALTER TABLE user_questions_editors ADD COLUMN IF NOT EXISTS role VARCHAR(10) NOT NULL DEFAULT 'editor' CHECK (role IN ('editor', 'viewer'))`,
+		`ALTER TABLE user_questions_editors ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'accepted' CHECK (status IN ('pending', 'accepted'))`,
+		`ALTER TABLE user_questions_editors ADD COLUMN IF NOT EXISTS invited_by_id INT REFERENCES users(id) ON DELETE SET NULL`,
+		`ALTER TABLE user_questions_editors ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now()`,
+		`ALTER TABLE user_questions_editors ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_user_questionsets_editors_set ON user_questionsets_editors (question_set_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_questions_editors_question ON user_questions_editors (question_id)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+		`ALTER TABLE question_sets ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+		`CREATE TABLE IF NOT EXISTS question_revisions (
+    id SERIAL PRIMARY KEY,
+    question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    snapshot JSONB NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('baseline', 'create', 'edit', 'restore')),
+    restored_from INT,
+    edited_by_id INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (question_id, version)
+)`,
+		`CREATE TABLE IF NOT EXISTS question_set_revisions (
+    id SERIAL PRIMARY KEY,
+    question_set_id INT NOT NULL REFERENCES question_sets(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    snapshot JSONB NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('baseline', 'create', 'edit', 'restore')),
+    restored_from INT,
+    edited_by_id INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (question_set_id, version)
+)`,
+		`ALTER TABLE test_session_question_answers ADD COLUMN IF NOT EXISTS question_version INT`,     // the question version the answer was graded against
+		`ALTER TABLE test_session_question_answers ADD COLUMN IF NOT EXISTS answered_correct BOOLEAN`, // gradeAnswer's verdict, apart from partial marks
+		`ALTER TABLE user_daily_activity ADD COLUMN IF NOT EXISTS limit_granted_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+    name VARCHAR(100) PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT now()
+)`,
+		// Days stored before the default was dropped still carry it; they were never granted anything.
+		// Runs once: later days with no grant and a limit of 20 are left alone.
+		`DO $$
+BEGIN
+    INSERT INTO schema_migrations (name) VALUES ('clear_default_questions_limit') ON CONFLICT DO NOTHING;
+    IF FOUND THEN
+        UPDATE user_daily_activity SET questions_limit = NULL WHERE questions_limit = 20 AND limit_granted_at IS NULL;
+    END IF;
+END $$`,
+	)
 	return sqlStrings
 }
 func CreateTableIfNotExists() error {